@@ -0,0 +1,17 @@
+--------------------------------------------------------------------------------
+-- OUTBOX - messages written in the same transaction as the state change that
+-- produced them, relayed to Kafka by cmd/outbox-relay (at-least-once)
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    message_key TEXT NOT NULL DEFAULT '',
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    sent_at TIMESTAMPTZ NULL
+);
+
+-- relay scans unsent rows in insertion order
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE events DROP COLUMN IF EXISTS venue_id;
+DROP TABLE IF EXISTS venue_seats;
+DROP TABLE IF EXISTS venue_sections;
+DROP TABLE IF EXISTS venues;
@@ -0,0 +1,44 @@
+--------------------------------------------------------------------------------
+-- VENUES - reusable seat-map templates (venue -> sections -> rows -> seats)
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS venues (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TRIGGER venues_set_updated_at BEFORE UPDATE ON venues
+FOR EACH ROW EXECUTE FUNCTION set_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS venue_sections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id UUID NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price_zone TEXT NOT NULL DEFAULT '',     -- default zone for seats in this section
+    position INT NOT NULL DEFAULT 0,         -- display order
+    created_at TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT unique_venue_section UNIQUE (venue_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS venue_seats (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id UUID NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    section_id UUID NOT NULL REFERENCES venue_sections(id) ON DELETE CASCADE,
+    row_label TEXT NOT NULL,
+    row_position INT NOT NULL DEFAULT 0,     -- row order within the section
+    seat_number INT NOT NULL,
+    label TEXT NOT NULL,                     -- becomes seats.seat_label for events at this venue
+    x DOUBLE PRECISION NOT NULL DEFAULT 0,
+    y DOUBLE PRECISION NOT NULL DEFAULT 0,
+    accessible BOOLEAN NOT NULL DEFAULT FALSE,
+    price_zone TEXT NOT NULL DEFAULT '',
+    CONSTRAINT unique_venue_seat_label UNIQUE (venue_id, label)
+);
+CREATE INDEX IF NOT EXISTS idx_venue_seats_section ON venue_seats (section_id, row_position, seat_number);
+
+-- events can be attached to a venue; their seats rows are generated from the template
+ALTER TABLE events ADD COLUMN IF NOT EXISTS venue_id UUID NULL REFERENCES venues(id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS idx_events_venue ON events (venue_id);
@@ -0,0 +1,3 @@
+ALTER TABLE bookings DROP COLUMN IF EXISTS tier_id;
+ALTER TABLE seats DROP COLUMN IF EXISTS tier_id;
+DROP TABLE IF EXISTS ticket_tiers;
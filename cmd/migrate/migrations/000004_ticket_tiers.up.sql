@@ -0,0 +1,27 @@
+--------------------------------------------------------------------------------
+-- TICKET_TIERS - priced ticket types per event (VIP, standard, student, ...)
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS ticket_tiers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price NUMERIC(12,2) NOT NULL CHECK (price >= 0),
+    quota INT NOT NULL CHECK (quota > 0),
+    sale_starts_at TIMESTAMPTZ NULL,
+    sale_ends_at TIMESTAMPTZ NULL,
+    max_per_booking INT NOT NULL DEFAULT 0,  -- 0 = only the event limit applies
+    price_zone TEXT NOT NULL DEFAULT '',     -- non-empty binds the tier to the venue seats of that zone
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT unique_event_tier UNIQUE (event_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_ticket_tiers_event ON ticket_tiers (event_id);
+
+CREATE TRIGGER ticket_tiers_set_updated_at BEFORE UPDATE ON ticket_tiers
+FOR EACH ROW EXECUTE FUNCTION set_updated_at_column();
+
+-- seats bound to a zone tier are always sold at that tier
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS tier_id UUID NULL REFERENCES ticket_tiers(id) ON DELETE SET NULL;
+
+-- tier chosen by the buyer for seats that are not bound to a tier
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS tier_id UUID NULL REFERENCES ticket_tiers(id) ON DELETE SET NULL;
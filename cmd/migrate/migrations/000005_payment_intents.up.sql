@@ -0,0 +1,2 @@
+-- gateway payment intent a booking was paid with, needed to refund it later
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS payment_intent_id TEXT NULL;
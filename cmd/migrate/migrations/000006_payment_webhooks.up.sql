@@ -0,0 +1,9 @@
+--------------------------------------------------------------------------------
+-- PAYMENT_WEBHOOK_EVENTS - provider webhook events already applied, for deduplication
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+    event_id TEXT PRIMARY KEY,               -- provider event ID
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMPTZ DEFAULT now()
+);
@@ -0,0 +1,45 @@
+--------------------------------------------------------------------------------
+-- LEDGER - append-only double-entry record of money moving through payments
+--------------------------------------------------------------------------------
+-- Accounts:
+--   provider_cash     money held at the payment provider
+--   customer_funds    money paid for a booking and still owed to the customer
+--   fee_revenue       cancellation fees earned
+--   adjustments       manual corrections by finance
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('charge','refund','cancellation_fee','adjustment')),
+    event_id UUID NOT NULL,
+    booking_id UUID NULL,
+    provider_ref TEXT NULL,                  -- payment intent or refund ID at the provider
+    amount NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    memo TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_transactions_booking ON ledger_transactions (booking_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_transactions_event ON ledger_transactions (event_id, created_at);
+
+-- Every transaction has entries summing to zero: debits positive, credits negative
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES ledger_transactions(id),
+    account TEXT NOT NULL CHECK (account IN ('provider_cash','customer_funds','fee_revenue','adjustments')),
+    event_id UUID NOT NULL,
+    booking_id UUID NULL,
+    amount NUMERIC(12,2) NOT NULL CHECK (amount <> 0),
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_booking ON ledger_entries (booking_id, account);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_event ON ledger_entries (event_id, account);
+
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only: % on % is not allowed', TG_OP, TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transactions_append_only BEFORE UPDATE OR DELETE ON ledger_transactions
+FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+CREATE TRIGGER ledger_entries_append_only BEFORE UPDATE OR DELETE ON ledger_entries
+FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
@@ -0,0 +1,18 @@
+--------------------------------------------------------------------------------
+-- WAITLIST_OFFERS - freed seats offered to a waitlisted user until expires_at
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS waitlist_offers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    waitlist_id UUID NOT NULL,               -- waitlist entry the offer was made to
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seats JSONB NOT NULL,                    -- held with held_by_booking = offer id while open
+    tier_id UUID NULL REFERENCES ticket_tiers(id) ON DELETE SET NULL,
+    status TEXT NOT NULL DEFAULT 'offered' CHECK (status IN ('offered','accepted','declined','expired')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    booking_id UUID NULL,                    -- booking created on acceptance
+    responded_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_waitlist_offers_open ON waitlist_offers (expires_at) WHERE status = 'offered';
+CREATE INDEX IF NOT EXISTS idx_waitlist_offers_user ON waitlist_offers (user_id, status);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS unique_waitlist_active_user;
+DROP TABLE IF EXISTS waitlist_counters;
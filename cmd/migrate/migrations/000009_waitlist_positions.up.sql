@@ -0,0 +1,23 @@
+--------------------------------------------------------------------------------
+-- WAITLIST_COUNTERS - last position handed out per event, bumped atomically on join
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS waitlist_counters (
+    event_id UUID PRIMARY KEY REFERENCES events(id) ON DELETE CASCADE,
+    last_position INT NOT NULL DEFAULT 0
+);
+
+INSERT INTO waitlist_counters (event_id, last_position)
+SELECT event_id, MAX(position) FROM waitlist WHERE event_id IS NOT NULL GROUP BY event_id
+ON CONFLICT (event_id) DO NOTHING;
+
+-- keep only the earliest active entry of users who joined the same waitlist more than once
+UPDATE waitlist w SET opted_out = true
+FROM (
+    SELECT event_id, id, ROW_NUMBER() OVER (PARTITION BY event_id, user_id ORDER BY position, created_at) AS n
+    FROM waitlist
+    WHERE opted_out = false
+) d
+WHERE w.event_id = d.event_id AND w.id = d.id AND d.n > 1;
+
+-- a user has at most one active entry per event; opted-out entries are kept as history
+CREATE UNIQUE INDEX IF NOT EXISTS unique_waitlist_active_user ON waitlist (event_id, user_id) WHERE opted_out = false;
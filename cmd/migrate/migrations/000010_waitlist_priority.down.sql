@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_waitlist_event_promotion;
+ALTER TABLE waitlist DROP COLUMN IF EXISTS priority_group;
+ALTER TABLE waitlist DROP COLUMN IF EXISTS priority;
+DROP TABLE IF EXISTS waitlist_priority_rules;
+ALTER TABLE users DROP COLUMN IF EXISTS accessibility_needs;
+ALTER TABLE users DROP COLUMN IF EXISTS member;
@@ -0,0 +1,18 @@
+--------------------------------------------------------------------------------
+-- WAITLIST PRIORITY - per-event priority for groups of users, promoted ahead of others
+--------------------------------------------------------------------------------
+ALTER TABLE users ADD COLUMN IF NOT EXISTS member BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS accessibility_needs BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS waitlist_priority_rules (
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    grp TEXT CHECK (grp IN ('member','previous_attendee','accessibility')) NOT NULL,
+    priority INT NOT NULL CHECK (priority > 0),
+    PRIMARY KEY (event_id, grp)
+);
+
+-- priority is the highest rule the user qualified for when joining or when the rules last changed
+ALTER TABLE waitlist ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0;
+ALTER TABLE waitlist ADD COLUMN IF NOT EXISTS priority_group TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_event_promotion ON waitlist (event_id, priority DESC, position) WHERE opted_out = false;
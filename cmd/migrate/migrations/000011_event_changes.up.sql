@@ -0,0 +1,11 @@
+--------------------------------------------------------------------------------
+-- EVENT_CHANGES - audit trail of admin edits to events, one row per update
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS event_changes (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    changed_by UUID NULL,                    -- admin user; NULL for system changes
+    changes JSONB NOT NULL,                  -- {"field": {"from": ..., "to": ...}}
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_event_changes_event ON event_changes (event_id, id);
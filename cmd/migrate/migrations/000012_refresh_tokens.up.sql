@@ -0,0 +1,17 @@
+--------------------------------------------------------------------------------
+-- REFRESH_TOKENS - rotating refresh tokens, one family per sign-in
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    family_id UUID NOT NULL,                 -- shared by every rotation of one sign-in
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,         -- sha256 of the token, the token itself is never stored
+    access_jti TEXT NOT NULL,                -- access token issued alongside, denylisted on revocation
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    rotated_at TIMESTAMPTZ NULL,             -- set once exchanged; presenting it again revokes the family
+    revoked_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens (user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,4 @@
+-- An external identity signs in to exactly one account
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oauth_identity
+    ON users(oauth_provider, oauth_sub)
+    WHERE oauth_sub <> '';
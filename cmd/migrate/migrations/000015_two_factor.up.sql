@@ -0,0 +1,17 @@
+-- TOTP second factor. The secret is encrypted by the application; it is set at enrollment
+-- and only takes effect once totp_enabled_at is set by confirming a first code.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ,
+    -- Last accepted time step, so a code cannot be replayed
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Single-use codes for signing in without the authenticator; only hashes are stored
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,18 @@
+--------------------------------------------------------------------------------
+-- API_KEYS - server-to-server credentials for partners, acting as user_id
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,              -- public part of the key, identifies it in logs and lists
+    key_hash TEXT NOT NULL,                   -- sha256 of the full key, the key itself is never stored
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    rate_limit INT NOT NULL DEFAULT 600 CHECK (rate_limit > 0),  -- requests per minute
+    expires_at TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS event_organizers;
+
+UPDATE users SET role = 'user' WHERE role = 'organizer';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user','admin'));
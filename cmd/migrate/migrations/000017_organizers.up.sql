@@ -0,0 +1,17 @@
+-- Organizers manage the events they are members of; admins keep access to everything
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user','organizer','admin'));
+
+--------------------------------------------------------------------------------
+-- EVENT_ORGANIZERS - who may manage an event besides admins. The organizer who
+-- created the event is its owner and may add or remove other members.
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS event_organizers (
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner','member')),
+    added_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (event_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_event_organizers_user ON event_organizers (user_id);
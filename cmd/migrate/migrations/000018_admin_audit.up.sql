@@ -0,0 +1,32 @@
+--------------------------------------------------------------------------------
+-- ADMIN_AUDIT - append-only record of every change made through the admin API
+--------------------------------------------------------------------------------
+-- actor_id has no foreign key: entries must outlive the users they mention, and
+-- ON DELETE SET NULL would be an update the trigger below refuses.
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id UUID NULL,
+    actor_role TEXT NOT NULL,
+    action TEXT NOT NULL,                    -- e.g. 'event.update', 'user.remove'
+    target_type TEXT NOT NULL CHECK (target_type IN ('event','user')),
+    target_id TEXT NOT NULL,
+    before JSONB NULL,                       -- snapshot before the change, NULL for creations
+    after JSONB NULL,                        -- snapshot after the change, NULL for deletions
+    ip TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_created ON admin_audit (created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_actor ON admin_audit (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_target ON admin_audit (target_type, target_id, created_at);
+
+CREATE OR REPLACE FUNCTION admin_audit_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'admin_audit is append-only: % is not allowed', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER admin_audit_append_only BEFORE UPDATE OR DELETE ON admin_audit
+FOR EACH ROW EXECUTE FUNCTION admin_audit_append_only();
+CREATE TRIGGER admin_audit_no_truncate BEFORE TRUNCATE ON admin_audit
+FOR EACH STATEMENT EXECUTE FUNCTION admin_audit_append_only();
@@ -0,0 +1,15 @@
+--------------------------------------------------------------------------------
+-- SEAT_RELEASES - seats freed by a cancelled booking or closed offer whose tokens
+-- still have to be handed to the waitlist or returned to the bucket
+--------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS seat_releases (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    source_id UUID NOT NULL,                 -- booking or waitlist offer the seats came from
+    seats JSONB NOT NULL,
+    tier_id UUID NULL REFERENCES ticket_tiers(id) ON DELETE SET NULL,
+    locked_until TIMESTAMPTZ NOT NULL,       -- lease of the worker handing the seats on
+    done_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_seat_releases_pending ON seat_releases (locked_until) WHERE done_at IS NULL;
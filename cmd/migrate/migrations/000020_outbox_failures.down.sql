@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_outbox_failed;
+DROP INDEX IF EXISTS idx_outbox_unsent;
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS failed_at,
+    DROP COLUMN IF EXISTS next_attempt_at;
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
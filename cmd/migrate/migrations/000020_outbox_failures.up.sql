@@ -0,0 +1,10 @@
+--------------------------------------------------------------------------------
+-- OUTBOX - retry failed publishes with backoff and park messages that keep failing
+--------------------------------------------------------------------------------
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS failed_at TIMESTAMPTZ NULL; -- set once attempts reach the relay's cap
+
+DROP INDEX IF EXISTS idx_outbox_unsent;
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_failed ON outbox (failed_at) WHERE failed_at IS NOT NULL;
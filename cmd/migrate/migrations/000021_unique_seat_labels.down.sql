@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS uq_seats_event_label;
+CREATE INDEX IF NOT EXISTS idx_seats_event_label ON seats (event_id, seat_label);
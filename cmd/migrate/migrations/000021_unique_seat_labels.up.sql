@@ -0,0 +1,14 @@
+--------------------------------------------------------------------------------
+-- SEATS - a label exists at most once per event
+--------------------------------------------------------------------------------
+-- Drop duplicate available seats left by concurrent capacity changes, keeping one row
+-- per label. Duplicates that are held or booked need a manual fix and make this fail.
+DELETE FROM seats s
+USING seats d
+WHERE s.event_id = d.event_id
+  AND s.seat_label = d.seat_label
+  AND s.status = 'available'
+  AND (d.status <> 'available' OR s.id > d.id);
+
+DROP INDEX IF EXISTS idx_seats_event_label;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_seats_event_label ON seats (event_id, seat_label);
@@ -0,0 +1,4 @@
+UPDATE bookings SET payment_status = 'paid' WHERE payment_status = 'refunding';
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_payment_status_check;
+ALTER TABLE bookings ADD CONSTRAINT bookings_payment_status_check
+    CHECK (payment_status IN ('pending','paid','failed','refunded'));
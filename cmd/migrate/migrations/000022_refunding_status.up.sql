@@ -0,0 +1,6 @@
+--------------------------------------------------------------------------------
+-- BOOKINGS - 'refunding' marks a refund claimed and in flight at the provider
+--------------------------------------------------------------------------------
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_payment_status_check;
+ALTER TABLE bookings ADD CONSTRAINT bookings_payment_status_check
+    CHECK (payment_status IN ('pending','paid','failed','refunding','refunded'));
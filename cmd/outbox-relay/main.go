@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/config"
+	kafkax "github.com/samirwankhede/lewly-pgpyewj/internal/kafka"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/logger"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	storeOutbox "github.com/samirwankhede/lewly-pgpyewj/internal/store/outbox"
+)
+
+const (
+	pollInterval  = time.Second
+	batchSize     = 100
+	sentRetention = 24 * time.Hour
+)
+
+func main() {
+	_ = godotenv.Load()
+	cfg := config.Load()
+	log := logger.New(cfg.Env)
+	log.Info("outbox relay starting")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	db, err := store.NewDB(ctx, cfg.PostgresURL, int32(cfg.MaxDBConnections))
+	if err != nil {
+		log.Fatal("db connect", zap.Error(err))
+	}
+	defer db.Close()
+
+	outboxRepo := storeOutbox.NewOutboxRepository(db, log)
+
+	// One producer per topic, created lazily as messages for new topics show up
+	producers := map[string]*kafkax.Producer{}
+	defer func() {
+		for _, p := range producers {
+			_ = p.Close()
+		}
+	}()
+	publish := func(m storeOutbox.Message) error {
+		p, ok := producers[m.Topic]
+		if !ok {
+			p = kafkax.NewProducer([]string{cfg.KafkaBrokers}, m.Topic)
+			producers[m.Topic] = p
+		}
+		return p.Publish(ctx, []byte(m.Key), m.Payload)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+
+		// Drain the backlog before waiting for the next tick
+		for {
+			sent, err := outboxRepo.RelayBatch(ctx, batchSize, publish)
+			if err != nil {
+				log.Error("relay outbox batch", zap.Error(err))
+				break
+			}
+			if sent > 0 {
+				log.Debug("relayed outbox messages", zap.Int("count", sent))
+			}
+			if sent < batchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPurge) > time.Hour {
+			if n, err := outboxRepo.PurgeSent(ctx, time.Now().Add(-sentRetention)); err != nil {
+				log.Error("purge sent outbox messages", zap.Error(err))
+			} else if n > 0 {
+				log.Info("purged sent outbox messages", zap.Int("count", n))
+			}
+			lastPurge = time.Now()
+		}
+	}
+}
@@ -42,7 +42,13 @@ func main() {
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	// Only the configured proxies may set the client address, which the login lockout
+	// and rate limits are keyed on
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("trusted proxies", zap.Error(err))
+	}
 	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
 	r.Use(middleware.RequestLogger(log))
 
 	api.RegisterRoutes(r, log)
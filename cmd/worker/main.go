@@ -13,11 +13,15 @@ import (
 	"github.com/samirwankhede/lewly-pgpyewj/internal/logger"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/mailer"
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
 	mailerService "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	workerService "github.com/samirwankhede/lewly-pgpyewj/internal/service/worker"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
 	storeBookings "github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	storeEvents "github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	storeReleases "github.com/samirwankhede/lewly-pgpyewj/internal/store/releases"
+	storeTiers "github.com/samirwankhede/lewly-pgpyewj/internal/store/tiers"
 	storeUsers "github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
 	storeWaitlist "github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/worker"
@@ -33,6 +37,7 @@ func main() {
 	defer cancel()
 
 	bookingTimeoutStore := redisx.NewTimeoutBucket(cfg.RedisAddr)
+	defer bookingTimeoutStore.Close()
 	db, err := store.NewDB(ctx, cfg.PostgresURL, int32(cfg.MaxDBConnections))
 	if err != nil {
 		log.Fatal("db connect", zap.Error(err))
@@ -44,6 +49,8 @@ func main() {
 	eventsRepo := storeEvents.NewEventsRepository(db, log)
 	waitlistRepo := storeWaitlist.NewWaitlistRepository(db, log)
 	usersRepository := storeUsers.NewUsersRepository(db, log)
+	tiersRepo := storeTiers.NewTiersRepository(db, log)
+	releasesRepo := storeReleases.NewReleasesRepository(db, log)
 
 	// Create mailer service
 	mailerSender := &mailer.SMTPSender{
@@ -54,9 +61,25 @@ func main() {
 		From: cfg.SMTPFrom,
 	}
 	mailerSvc := mailerService.NewMailerService(log, mailerSender)
+	tokens := redisx.NewTokenBucket(cfg.RedisAddr)
+	defer tokens.Close()
+	tiersSvc := tiersService.NewTiersService(log, tiersRepo, tokens)
 
-	// Create finalize service
-	finalizeSvc := workerService.NewFinalizeService(log, bookingsRepo, eventsRepo, usersRepository, waitlistRepo, cfg.PaymentURL, mailerSvc, bookingTimeoutStore)
+	// Create waitlist offers and finalize services
+	offersSvc := bookingsService.NewOffersService(log, bookingsRepo, eventsRepo, usersRepository, waitlistRepo, releasesRepo, tiersSvc, tokens, mailerSvc)
+	finalizeSvc := workerService.NewFinalizeService(log, bookingsRepo, eventsRepo, usersRepository, offersSvc, tiersSvc, cfg.PaymentURL, cfg.CheckoutSigningSecret, mailerSvc, bookingTimeoutStore)
+
+	// Expire unpaid bookings from the durable timeout bucket
+	timeouts := worker.NewTimeoutScheduler(log, finalizeSvc, bookingTimeoutStore)
+	go func() { _ = timeouts.Run(ctx) }()
+
+	// Pass expired waitlist offers on to the next user
+	offerExpiry := worker.NewOfferScheduler(log, offersSvc)
+	go func() { _ = offerExpiry.Run(ctx) }()
+
+	// Hand on freed seats whose release was left pending
+	seatReleases := worker.NewReleaseScheduler(log, offersSvc)
+	go func() { _ = seatReleases.Run(ctx) }()
 
 	// Create Kafka consumer and producer
 	consumer := kafkax.NewConsumer([]string{cfg.KafkaBrokers}, "evently-finalizer", "bookings")
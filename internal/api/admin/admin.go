@@ -1,35 +1,55 @@
 package admin
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/service/admin"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 )
 
 type AdminHandler struct {
-	svc    *admin.AdminService
-	secret string
+	svc  *admin.AdminService
+	auth *jwtMiddleware.Auth
 }
 
-func NewAdminHandler(svc *admin.AdminService, secret string) *AdminHandler {
-	return &AdminHandler{svc: svc, secret: secret}
+func NewAdminHandler(svc *admin.AdminService, auth *jwtMiddleware.Auth) *AdminHandler {
+	return &AdminHandler{svc: svc, auth: auth}
 }
 
+// Register mounts the admin routes. Organizers get through the middleware too; the service
+// keeps them to the events they organize and refuses them everything else.
 func (h *AdminHandler) Register(r *gin.Engine) {
 	g := r.Group("/admin")
-	g.Use(jwtMiddleware.Middleware(h.secret, true))
+	g.Use(h.auth.OrganizerMiddleware())
 	{
 		g.POST("/events", h.createEvent)
+		g.PATCH("/events/:id", h.updateEvent)
 		g.PUT("/events/:id", h.updateEvent)
+		g.GET("/events/:id/changes", h.eventChanges)
+		g.POST("/events/:id/tiers", h.createTier)
 		g.POST("/events/:id/cancel", h.cancelEvent)
+		g.PUT("/events/:id/capacity", h.changeCapacity)
+		g.GET("/events/:id/waitlist", h.listWaitlist)
+		g.GET("/events/:id/waitlist-priorities", h.getWaitlistPriorities)
+		g.PUT("/events/:id/waitlist-priorities", h.setWaitlistPriorities)
+		g.GET("/events/:id/organizers", h.listEventOrganizers)
+		g.POST("/events/:id/organizers", h.addEventOrganizer)
+		g.DELETE("/events/:id/organizers/:user_id", h.removeEventOrganizer)
 		g.GET("/analytics", h.summary)
 		g.POST("/users/:id/admin", h.createAdmin)
 		g.DELETE("/users/:id/admin", h.removeAdmin)
+		g.POST("/users/:id/organizer", h.createOrganizer)
+		g.DELETE("/users/:id/organizer", h.removeOrganizer)
 		g.DELETE("/users/:id", h.removeUser)
+		g.PUT("/users/:id/waitlist-groups", h.setUserWaitlistGroups)
 		g.GET("/users/get-user", h.getUserByEmail)
+		g.GET("/audit", h.listAudit)
 	}
 }
 
@@ -39,14 +59,44 @@ func (h *AdminHandler) createEvent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	e, err := h.svc.CreateEvent(c, in)
+	e, err := h.svc.CreateEvent(c.Request.Context(), actor(c), in)
 	if err != nil {
+		if errors.Is(err, admin.ErrValidation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, e)
 }
 
+func (h *AdminHandler) createTier(c *gin.Context) {
+	var in tiers.TierInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t, err := h.svc.CreateTier(c.Request.Context(), actor(c), c.Param("id"), in)
+	if err != nil {
+		if errors.Is(err, admin.ErrValidation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
 func (h *AdminHandler) summary(c *gin.Context) {
 	fromStr := c.Query("from")
 	toStr := c.Query("to")
@@ -70,8 +120,12 @@ func (h *AdminHandler) summary(c *gin.Context) {
 			return
 		}
 	}
-	a, err := h.svc.GetSummary(c.Request.Context(), from, to)
+	a, err := h.svc.GetSummary(c.Request.Context(), actor(c), from, to)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -79,25 +133,84 @@ func (h *AdminHandler) summary(c *gin.Context) {
 }
 
 func (h *AdminHandler) updateEvent(c *gin.Context) {
-	eventID := c.Param("id")
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	var patch admin.EventPatch
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.svc.UpdateEvent(c.Request.Context(), eventID, updates)
+	e, err := h.svc.UpdateEvent(c.Request.Context(), actor(c), c.Param("id"), patch, c.GetHeader("If-Match"))
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrValidation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrEventNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrVersionRequired):
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrEventStale):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", e.ETag())
+	c.JSON(http.StatusOK, e)
+}
+
+func (h *AdminHandler) eventChanges(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	changes, err := h.svc.EventChanges(c.Request.Context(), actor(c), c.Param("id"), limit, offset)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Event updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"changes": changes, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) changeCapacity(c *gin.Context) {
+	var in admin.CapacityInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.svc.ChangeCapacity(c.Request.Context(), actor(c), c.Param("id"), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrValidation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrEventNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrCapacityReserved), errors.Is(err, admin.ErrCapacityChanged):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 func (h *AdminHandler) cancelEvent(c *gin.Context) {
 	eventID := c.Param("id")
-	err := h.svc.CancelEvent(c.Request.Context(), eventID)
+	err := h.svc.CancelEvent(c.Request.Context(), actor(c), eventID)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -106,8 +219,12 @@ func (h *AdminHandler) cancelEvent(c *gin.Context) {
 
 func (h *AdminHandler) createAdmin(c *gin.Context) {
 	userID := c.Param("id")
-	err := h.svc.CreateAdminFromUser(c.Request.Context(), userID)
+	err := h.svc.CreateAdminFromUser(c.Request.Context(), actor(c), userID)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -116,8 +233,12 @@ func (h *AdminHandler) createAdmin(c *gin.Context) {
 
 func (h *AdminHandler) removeAdmin(c *gin.Context) {
 	userID := c.Param("id")
-	err := h.svc.RemoveAdmin(c.Request.Context(), userID)
+	err := h.svc.RemoveAdmin(c.Request.Context(), actor(c), userID)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -126,8 +247,12 @@ func (h *AdminHandler) removeAdmin(c *gin.Context) {
 
 func (h *AdminHandler) removeUser(c *gin.Context) {
 	userID := c.Param("id")
-	err := h.svc.RemoveUser(c.Request.Context(), userID)
+	err := h.svc.RemoveUser(c.Request.Context(), actor(c), userID)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -143,10 +268,219 @@ func (h *AdminHandler) getUserByEmail(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	user, err := h.svc.GetUserByEmail(c.Request.Context(), email.Email)
+	user, err := h.svc.GetUserByEmail(c.Request.Context(), actor(c), email.Email)
 	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, user)
 }
+
+func (h *AdminHandler) listWaitlist(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	entries, err := h.svc.ListWaitlist(c.Request.Context(), actor(c), c.Param("id"), limit, offset)
+	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event_id": c.Param("id"), "waitlist": entries, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) getWaitlistPriorities(c *gin.Context) {
+	rules, err := h.svc.GetWaitlistPriorities(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event_id": c.Param("id"), "rules": rules})
+}
+
+func (h *AdminHandler) setWaitlistPriorities(c *gin.Context) {
+	var in admin.WaitlistPriorities
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.svc.SetWaitlistPriorities(c.Request.Context(), actor(c), c.Param("id"), in)
+	if err != nil {
+		if errors.Is(err, admin.ErrValidation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *AdminHandler) setUserWaitlistGroups(c *gin.Context) {
+	var in admin.UserWaitlistGroups
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.svc.SetUserWaitlistGroups(c.Request.Context(), actor(c), c.Param("id"), in); err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, in)
+}
+
+func (h *AdminHandler) createOrganizer(c *gin.Context) {
+	err := h.svc.CreateOrganizerFromUser(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User promoted to organizer successfully"})
+}
+
+func (h *AdminHandler) removeOrganizer(c *gin.Context) {
+	err := h.svc.RemoveOrganizer(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organizer role removed successfully"})
+}
+
+func (h *AdminHandler) listEventOrganizers(c *gin.Context) {
+	organizers, err := h.svc.ListEventOrganizers(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, admin.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event_id": c.Param("id"), "organizers": organizers})
+}
+
+func (h *AdminHandler) addEventOrganizer(c *gin.Context) {
+	var in struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.svc.AddEventOrganizer(c.Request.Context(), actor(c), c.Param("id"), in.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrValidation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrEventNotFound), errors.Is(err, admin.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organizer added to event"})
+}
+
+func (h *AdminHandler) removeEventOrganizer(c *gin.Context) {
+	err := h.svc.RemoveEventOrganizer(c.Request.Context(), actor(c), c.Param("id"), c.Param("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrNotEventOrganizer):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organizer removed from event"})
+}
+
+func (h *AdminHandler) listAudit(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	q := admin.AuditQuery{
+		ActorID:    c.Query("actor_id"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad " + p.name})
+				return
+			}
+			*p.dst = &t
+		}
+	}
+	entries, err := h.svc.ListAudit(c.Request.Context(), actor(c), q)
+	if err != nil {
+		switch {
+		case errors.Is(err, admin.ErrValidation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, admin.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "limit": q.Limit, "offset": q.Offset})
+}
+
+// actor is the admin or organizer the middleware let in.
+func actor(c *gin.Context) admin.Actor {
+	return admin.Actor{
+		UserID:    c.GetString("uid"),
+		Role:      c.GetString("role"),
+		IP:        c.ClientIP(),
+		RequestID: c.GetString("request_id"),
+	}
+}
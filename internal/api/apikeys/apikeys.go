@@ -0,0 +1,72 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/service/apikeys"
+)
+
+type APIKeysHandler struct {
+	svc  *apikeys.APIKeysService
+	auth *jwtMiddleware.Auth
+}
+
+func NewAPIKeysHandler(svc *apikeys.APIKeysService, auth *jwtMiddleware.Auth) *APIKeysHandler {
+	return &APIKeysHandler{svc: svc, auth: auth}
+}
+
+func (h *APIKeysHandler) Register(r *gin.Engine) {
+	g := r.Group("/admin/api-keys")
+	g.Use(h.auth.Middleware(true))
+	{
+		g.POST("", h.create)
+		g.GET("", h.list)
+		g.DELETE("/:id", h.revoke)
+	}
+}
+
+func (h *APIKeysHandler) create(c *gin.Context) {
+	var req apikeys.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	k, err := h.svc.Create(c.Request.Context(), c.GetString("uid"), req)
+	if err != nil {
+		if errors.Is(err, apikeys.ErrValidation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, k)
+}
+
+func (h *APIKeysHandler) list(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	keys, err := h.svc.List(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys, "limit": limit, "offset": offset})
+}
+
+func (h *APIKeysHandler) revoke(c *gin.Context) {
+	if err := h.svc.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, apikeys.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
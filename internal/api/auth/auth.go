@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,10 +18,11 @@ type AuthHandler struct {
 	log    *zap.Logger
 	svc    *authService.AuthService
 	secret string
+	auth   *authMiddleware.Auth
 }
 
-func NewAuthHandler(log *zap.Logger, svc *authService.AuthService, secret string) *AuthHandler {
-	return &AuthHandler{log: log, svc: svc, secret: secret}
+func NewAuthHandler(log *zap.Logger, svc *authService.AuthService, secret string, auth *authMiddleware.Auth) *AuthHandler {
+	return &AuthHandler{log: log, svc: svc, secret: secret, auth: auth}
 }
 
 func (h *AuthHandler) Register(r *gin.Engine) {
@@ -25,18 +30,38 @@ func (h *AuthHandler) Register(r *gin.Engine) {
 	{
 		auth.POST("/signup", h.signup)
 		auth.POST("/login", h.login)
+		auth.POST("/refresh", h.refresh)
 		auth.POST("/logout", h.logout)
 		auth.POST("/password/request-otp", h.requestPasswordChangeOTP)
 		auth.POST("/password/verify-otp", h.verifyPasswordChangeOTP)
+		auth.GET("/verify-email", h.verifyEmail)
+		auth.POST("/2fa/verify", h.verifyTwoFactor)
+		auth.POST("/2fa/challenge/enroll", h.enrollWithChallenge)
+		auth.GET("/oauth/:provider/start", h.startOAuth)
+		auth.GET("/oauth/:provider/callback", h.oauthCallback)
 	}
 
 	// Protected routes
 	protected := r.Group("/v1/auth")
-	protected.Use(authMiddleware.Middleware(h.secret, false))
+	protected.Use(h.auth.Middleware(false))
 	{
 		protected.GET("/profile", h.getProfile)
 		protected.PUT("/profile", h.updateProfile)
 		protected.PUT("/password", h.changePassword)
+		protected.POST("/logout-all", h.logoutAll)
+		protected.POST("/verify-email/resend", h.resendVerification)
+		protected.GET("/2fa", h.twoFactorStatus)
+		protected.POST("/2fa/enroll", h.enrollTwoFactor)
+		protected.POST("/2fa/enable", h.enableTwoFactor)
+		protected.POST("/2fa/disable", h.disableTwoFactor)
+		protected.POST("/2fa/recovery-codes", h.regenerateRecoveryCodes)
+	}
+
+	// Forced sign-out of a compromised account
+	admin := r.Group("/admin")
+	admin.Use(h.auth.Middleware(true))
+	{
+		admin.DELETE("/users/:id/sessions", h.revokeSessions)
 	}
 }
 
@@ -68,8 +93,11 @@ func (h *AuthHandler) login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.svc.Login(c.Request.Context(), req)
+	resp, challenge, err := h.svc.Login(c.Request.Context(), req, c.ClientIP())
 	if err != nil {
+		if h.lockedOut(c, err) {
+			return
+		}
 		if err == authService.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
@@ -82,16 +110,288 @@ func (h *AuthHandler) login(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// lockedOut answers 429 with Retry-After if err is a lockout.
+func (h *AuthHandler) lockedOut(c *gin.Context, err error) bool {
+	var locked *authService.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	seconds := int(math.Ceil(locked.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error(), "retry_after": seconds})
+	return true
+}
+
+func (h *AuthHandler) verifyTwoFactor(c *gin.Context) {
+	var req authService.TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := h.svc.VerifyTwoFactor(c.Request.Context(), req, c.ClientIP())
+	if err != nil {
+		if h.lockedOut(c, err) {
+			return
+		}
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) enrollWithChallenge(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enrollment, err := h.svc.EnrollWithChallenge(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *AuthHandler) twoFactorStatus(c *gin.Context) {
+	status, err := h.svc.TwoFactorStatus(c.Request.Context(), c.GetString("uid"))
+	if err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *AuthHandler) enrollTwoFactor(c *gin.Context) {
+	enrollment, err := h.svc.EnrollTwoFactor(c.Request.Context(), c.GetString("uid"))
+	if err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *AuthHandler) enableTwoFactor(c *gin.Context) {
+	var req authService.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := h.svc.EnableTwoFactor(c.Request.Context(), c.GetString("uid"), req.Code)
+	if err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "2FA enabled", "recovery_codes": codes})
+}
+
+func (h *AuthHandler) disableTwoFactor(c *gin.Context) {
+	var req authService.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.svc.DisableTwoFactor(c.Request.Context(), c.GetString("uid"), req.Code); err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "2FA disabled"})
+}
+
+func (h *AuthHandler) regenerateRecoveryCodes(c *gin.Context) {
+	var req authService.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := h.svc.RegenerateRecoveryCodes(c.Request.Context(), c.GetString("uid"), req.Code)
+	if err != nil {
+		h.twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) twoFactorError(c *gin.Context, err error) {
+	switch err {
+	case authService.ErrInvalidChallenge, authService.ErrInvalidTwoFactorCode:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case authService.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case authService.ErrTwoFactorEnabled, authService.ErrTwoFactorNotEnabled, authService.ErrTwoFactorNotEnrolled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case authService.ErrTwoFactorMandatory:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		h.log.Error("2FA request failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+func (h *AuthHandler) verifyEmail(c *gin.Context) {
+	err := h.svc.VerifyEmail(c.Request.Context(), c.Request.URL.Query())
+	if err != nil {
+		switch err {
+		case authService.ErrInvalidVerificationLink, authService.ErrVerificationLinkExpired:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("Email verification failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func (h *AuthHandler) resendVerification(c *gin.Context) {
+	err := h.svc.ResendVerification(c.Request.Context(), c.GetString("uid"))
+	if err != nil {
+		switch err {
+		case authService.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case authService.ErrEmailAlreadyVerified:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case authService.ErrResendRateLimited:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("Resend verification failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func (h *AuthHandler) startOAuth(c *gin.Context) {
+	url, err := h.svc.StartOAuth(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		h.oauthError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+func (h *AuthHandler) oauthCallback(c *gin.Context) {
+	// The user declined, or the provider refused the request
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OAuth login failed: " + e, "description": c.Query("error_description")})
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
 
+	resp, challenge, err := h.svc.CompleteOAuth(c.Request.Context(), c.Param("provider"), code, state)
+	if err != nil {
+		h.oauthError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+func (h *AuthHandler) oauthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, authService.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, authService.ErrInvalidOAuthState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, authService.ErrOAuthEmailUnverified), errors.Is(err, authService.ErrOAuthAccountUnverified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, authService.ErrOAuthAccountLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, authService.ErrOAuthFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": authService.ErrOAuthFailed.Error()})
+	default:
+		h.log.Error("OAuth login failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+func (h *AuthHandler) refresh(c *gin.Context) {
+	var req authService.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.svc.Refresh(c.Request.Context(), req)
+	if err != nil {
+		if err == authService.ErrInvalidRefreshToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		h.log.Error("Refresh failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// logout revokes the refresh token's session and the bearer access token, whichever are sent.
 func (h *AuthHandler) logout(c *gin.Context) {
-	// In a stateless JWT system, logout is typically handled client-side
-	// by removing the token. We could implement token blacklisting here if needed.
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var claims *authMiddleware.Claims
+	if bearer := c.GetHeader("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+		claims, _ = authMiddleware.Parse(h.secret, strings.TrimPrefix(bearer, "Bearer "))
+	}
+	if req.RefreshToken == "" && claims == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token or a bearer token is required"})
+		return
+	}
+
+	if err := h.svc.Logout(c.Request.Context(), req.RefreshToken, claims); err != nil {
+		h.log.Error("Logout failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+func (h *AuthHandler) logoutAll(c *gin.Context) {
+	n, err := h.svc.RevokeSessions(c.Request.Context(), c.GetString("uid"))
+	if err != nil {
+		h.log.Error("Logout everywhere failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "revoked_access_tokens": n})
+}
+
+func (h *AuthHandler) revokeSessions(c *gin.Context) {
+	n, err := h.svc.RevokeSessions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.log.Error("Revoke sessions failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User signed out of all sessions", "revoked_access_tokens": n})
+}
+
 func (h *AuthHandler) getProfile(c *gin.Context) {
 	userID := c.GetString("uid")
 	if userID == "" {
@@ -203,8 +503,11 @@ func (h *AuthHandler) verifyPasswordChangeOTP(c *gin.Context) {
 		return
 	}
 
-	err := h.svc.VerifyPasswordChangeOTP(c.Request.Context(), req)
+	err := h.svc.VerifyPasswordChangeOTP(c.Request.Context(), req, c.ClientIP())
 	if err != nil {
+		if h.lockedOut(c, err) {
+			return
+		}
 		if err == authService.ErrInvalidOTP {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OTP"})
 			return
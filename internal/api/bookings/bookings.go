@@ -12,22 +12,23 @@ import (
 )
 
 type BookingsHandler struct {
-	svc    *bookings.BookingsService
-	secret string
+	svc  *bookings.BookingsService
+	auth *jwtMiddleware.Auth
 }
 
-func NewBookingsHandler(svc *bookings.BookingsService, secret string) *BookingsHandler {
-	return &BookingsHandler{svc: svc, secret: secret}
+func NewBookingsHandler(svc *bookings.BookingsService, auth *jwtMiddleware.Auth) *BookingsHandler {
+	return &BookingsHandler{svc: svc, auth: auth}
 }
 
 func (h *BookingsHandler) Register(r *gin.Engine) {
 	// Protected routes
 	protected := r.Group("/v1/bookings")
-	protected.Use(jwtMiddleware.Middleware(h.secret, false))
+	protected.Use(h.auth.Middleware(false))
 	{
-		protected.POST("/:id/book", h.book)
+		protected.POST("/:id/book", h.auth.VerifiedEmail(), h.book)
 		protected.GET("/:id/status", h.getStatus)
 		protected.POST("/:id/cancel", h.cancel)
+		protected.POST("/:id/cancel-seats", h.cancelSeats)
 		protected.GET("/user-bookings", h.listUserBookings)
 	}
 }
@@ -36,14 +37,21 @@ func (h *BookingsHandler) book(c *gin.Context) {
 	eventID := c.Param("id")
 	userID := c.GetString("uid")
 	IdempotencyKey := uuid.NewString() //This Part should be handled by another service - currently we're just creating a new uuid
+	// Either name exact seats or ask for a quantity and let the server pick the best available
 	type Seats struct {
-		Seats []string `json:"seats" binding:"required"`
+		Seats    []string `json:"seats"`
+		Quantity int      `json:"quantity"`
+		TierID   *string  `json:"tier_id"`
 	}
 	var seats Seats
 	if err := c.ShouldBindJSON(&seats); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if (len(seats.Seats) == 0) == (seats.Quantity == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provide either seats or quantity"})
+		return
+	}
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user id"})
 		return
@@ -52,17 +60,26 @@ func (h *BookingsHandler) book(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing event id"})
 		return
 	}
-	resp, code, err := h.svc.Create(c, eventID, userID, &IdempotencyKey, seats.Seats)
+	var resp *bookings.BookingResponse
+	var code int
+	var err error
+	if seats.Quantity > 0 {
+		resp, code, err = h.svc.CreateBestAvailable(c, eventID, userID, &IdempotencyKey, seats.Quantity, seats.TierID)
+	} else {
+		resp, code, err = h.svc.Create(c, eventID, userID, &IdempotencyKey, seats.Seats, seats.TierID)
+	}
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		if code < http.StatusBadRequest {
+			code = http.StatusConflict
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(code, resp)
 }
 
 func (h *BookingsHandler) getStatus(c *gin.Context) {
-	id := c.Param("id")
-	status, err := h.svc.GetBookingStatus(c.Request.Context(), id)
+	status, err := h.svc.GetBookingStatus(c.Request.Context(), c.Param("id"), c.GetString("uid"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -88,8 +105,23 @@ func (h *BookingsHandler) listUserBookings(c *gin.Context) {
 }
 
 func (h *BookingsHandler) cancel(c *gin.Context) {
-	id := c.Param("id")
-	resp, code, err := h.svc.Cancel(c.Request.Context(), id)
+	resp, code, err := h.svc.Cancel(c.Request.Context(), c.Param("id"), c.GetString("uid"))
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(code, resp)
+}
+
+func (h *BookingsHandler) cancelSeats(c *gin.Context) {
+	var req struct {
+		Seats []string `json:"seats" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, code, err := h.svc.CancelSeats(c.Request.Context(), c.Param("id"), c.GetString("uid"), req.Seats)
 	if err != nil {
 		c.JSON(code, gin.H{"error": err.Error()})
 		return
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -13,26 +14,33 @@ import (
 )
 
 type EventsHandler struct {
-	log    *zap.Logger
-	svc    *events.EventsService
-	secret string
+	log  *zap.Logger
+	svc  *events.EventsService
+	auth *jwtMiddleware.Auth
 }
 
-func NewEventsHandler(log *zap.Logger, svc *events.EventsService, secret string) *EventsHandler {
-	return &EventsHandler{log: log, svc: svc, secret: secret}
+func NewEventsHandler(log *zap.Logger, svc *events.EventsService, auth *jwtMiddleware.Auth) *EventsHandler {
+	return &EventsHandler{log: log, svc: svc, auth: auth}
 }
 
 func (h *EventsHandler) Register(r *gin.Engine) {
-	r.GET("/v1/events", h.list)
-	r.GET("/v1/events/all", h.listAll)
-	r.GET("/v1/events/upcoming", h.listUpcoming)
-	r.GET("/v1/events/popular", h.listPopular)
-	r.GET("/v1/events/:id", h.get)
-	r.GET("/v1/events/:id/seats", h.getAvailableSeats)
+	// Public routes, also open to partners with an events:read API key
+	public := r.Group("/v1/events")
+	public.Use(h.auth.OptionalAPIKey())
+	{
+		public.GET("", h.list)
+		public.GET("/all", h.listAll)
+		public.GET("/upcoming", h.listUpcoming)
+		public.GET("/popular", h.listPopular)
+		public.GET("/:id", h.get)
+		public.GET("/:id/seats", h.getAvailableSeats)
+		public.GET("/:id/seatmap", h.getSeatMap)
+		public.GET("/:id/tiers", h.listTiers)
+	}
 
 	// Protected routes for liking events
 	protected := r.Group("/v1/events")
-	protected.Use(jwtMiddleware.Middleware(h.secret, false))
+	protected.Use(h.auth.Middleware(false))
 	{
 		protected.POST("/:id/like", h.likeEvent)
 		protected.DELETE("/:id/like", h.unlikeEvent)
@@ -105,6 +113,10 @@ func (h *EventsHandler) get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if e != nil {
+		// Admins send the ETag back as If-Match when editing the event
+		c.Header("ETag", e.ETag())
+	}
 	c.JSON(http.StatusOK, gin.H{"event": e, "tokens_remaining": rem})
 }
 
@@ -118,6 +130,34 @@ func (h *EventsHandler) getAvailableSeats(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"seats": seats})
 }
 
+func (h *EventsHandler) getSeatMap(c *gin.Context) {
+	id := c.Param("id")
+	m, err := h.svc.GetSeatMap(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, events.ErrNoSeatMap) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if m == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+func (h *EventsHandler) listTiers(c *gin.Context) {
+	id := c.Param("id")
+	items, err := h.svc.ListTiers(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tiers": items})
+}
+
 func (h *EventsHandler) likeEvent(c *gin.Context) {
 	id := c.Param("id")
 	userID := c.GetString("uid")
@@ -1,6 +1,8 @@
 package payment
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -8,80 +10,149 @@ import (
 	"go.uber.org/zap"
 
 	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	paymentProvider "github.com/samirwankhede/lewly-pgpyewj/internal/payment"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/service/payment"
 )
 
 type PaymentHandler struct {
-	log    *zap.Logger
-	svc    *payment.PaymentService
-	secret string
+	log  *zap.Logger
+	svc  *payment.PaymentService
+	auth *jwtMiddleware.Auth
 }
 
-func NewPaymentHandler(log *zap.Logger, svc *payment.PaymentService, secret string) *PaymentHandler {
-	return &PaymentHandler{log: log, svc: svc, secret: secret}
+func NewPaymentHandler(log *zap.Logger, svc *payment.PaymentService, auth *jwtMiddleware.Auth) *PaymentHandler {
+	return &PaymentHandler{log: log, svc: svc, auth: auth}
 }
 
 func (h *PaymentHandler) Register(r *gin.Engine) {
 	payments := r.Group("/v1/payment")
-	payments.GET("/booking", h.processBookingPayment)
-	payments.GET("/refund", h.processRefund)
-	payments.Use(jwtMiddleware.Middleware(h.secret, true))
+	payments.POST("/webhook", h.handleWebhook)
+	payments.GET("/checkout/pay", h.getCheckout)
+	payments.POST("/checkout/pay", h.payCheckout)
+	payments.POST("/checkout", h.auth.Middleware(false), h.createCheckout)
+	payments.GET("/refund", h.auth.Middleware(false), h.processRefund)
+	payments.Use(h.auth.Middleware(true))
 	{
 		payments.POST("/events/:id/refund", h.processEventCancellationRefund)
+		payments.GET("/bookings/:id", h.getPaymentStatus)
 	}
+
+	ledger := r.Group("/admin/ledger")
+	ledger.Use(h.auth.Middleware(true))
+	{
+		ledger.GET("", h.getLedger)
+		ledger.POST("/adjustments", h.adjustLedger)
+		ledger.POST("/events/:id/reconcile", h.reconcile)
+	}
+}
+
+type checkoutRequest struct {
+	BookingID string `json:"booking_id" binding:"required"`
 }
 
-func (h *PaymentHandler) processBookingPayment(c *gin.Context) {
-	booking_id := c.Query("booking_id")
-	amt, err := strconv.ParseFloat(c.DefaultQuery("amount", "-1"), 64)
-	payment_id := c.Query("payment_id")
-	req := payment.PaymentRequest{
-		BookingID: booking_id,
-		Amount:    amt,
-		PaymentID: payment_id,
-	}
-	if amt == float64(-1) || err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error with amount parameter"})
+func (h *PaymentHandler) createCheckout(c *gin.Context) {
+	userID := c.GetString("uid")
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	resp, err := h.svc.ProcessBookingPayment(c.Request.Context(), req)
+	session, err := h.svc.CreateCheckoutSession(c.Request.Context(), req.BookingID, userID)
 	if err != nil {
-		if err == payment.ErrBookingNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
-			return
-		}
-		if err == payment.ErrInvalidAmount {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount"})
-			return
-		}
-		if err == payment.ErrAlreadyPaid {
-			c.JSON(http.StatusConflict, gin.H{"error": "Booking already paid"})
-			return
-		}
-		h.log.Error("Payment processing failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		h.checkoutError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, session)
+}
+
+// getCheckout and payCheckout stand in for the gateway's hosted checkout page.
+func (h *PaymentHandler) getCheckout(c *gin.Context) {
+	session, err := h.svc.GetCheckoutSession(c.Request.Context(), c.Request.URL.Query())
+	if err != nil {
+		h.checkoutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *PaymentHandler) payCheckout(c *gin.Context) {
+	cardToken := c.PostForm("card_token")
+	if cardToken == "" {
+		cardToken = c.Query("card_token")
+	}
+
+	resp, err := h.svc.PayCheckout(c.Request.Context(), c.Request.URL.Query(), cardToken)
+	if err != nil {
+		h.checkoutError(c, err)
 		return
 	}
 
 	if resp.Success {
-		c.JSON(http.StatusOK, resp)
+		c.JSON(http.StatusAccepted, resp)
 	} else {
 		c.JSON(http.StatusPaymentRequired, resp)
 	}
 }
 
+func (h *PaymentHandler) checkoutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, paymentProvider.ErrInvalidSignature):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid checkout link"})
+	case errors.Is(err, paymentProvider.ErrSignatureExpired), errors.Is(err, payment.ErrBookingExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Checkout session expired"})
+	case errors.Is(err, payment.ErrBookingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+	case errors.Is(err, payment.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount"})
+	case errors.Is(err, payment.ErrAlreadyPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking already paid"})
+	case errors.Is(err, payment.ErrPaymentFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway error, please retry"})
+	default:
+		h.log.Error("Checkout failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+func (h *PaymentHandler) handleWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unreadable body"})
+		return
+	}
+
+	err = h.svc.HandleWebhook(c.Request.Context(), body, c.GetHeader(paymentProvider.SignatureHeader))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	case errors.Is(err, paymentProvider.ErrInvalidSignature), errors.Is(err, paymentProvider.ErrSignatureExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, payment.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		// A 5xx makes the gateway retry the event later
+		h.log.Error("Webhook processing failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
 func (h *PaymentHandler) processRefund(c *gin.Context) {
 	BookingID := c.Query("booking_id")
 	if BookingID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Booking not found"})
+		return
 	}
 
-	resp, err := h.svc.ProcessCancellationRefund(c.Request.Context(), BookingID)
+	resp, err := h.svc.ProcessCancellationRefund(c.Request.Context(), BookingID, c.GetString("uid"))
 	if err != nil {
-		if err == payment.ErrBookingNotFound {
+		switch {
+		case errors.Is(err, payment.ErrBookingNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
 			return
+		case errors.Is(err, payment.ErrNotCancelled), errors.Is(err, payment.ErrNotPaid):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
 		}
 		h.log.Error("Refund processing failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -107,3 +178,64 @@ func (h *PaymentHandler) processEventCancellationRefund(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Event cancellation refunds processed successfully"})
 }
+
+func (h *PaymentHandler) getPaymentStatus(c *gin.Context) {
+	intent, err := h.svc.GetPaymentStatus(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == payment.ErrBookingNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No payment for booking"})
+			return
+		}
+		h.log.Error("Fetching payment status failed", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, intent)
+}
+
+func (h *PaymentHandler) getLedger(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	view, err := h.svc.GetLedger(c.Request.Context(), payment.LedgerQuery{
+		EventID:   c.Query("event_id"),
+		BookingID: c.Query("booking_id"),
+		Kind:      c.Query("kind"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		h.log.Error("Ledger query failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *PaymentHandler) adjustLedger(c *gin.Context) {
+	var in payment.Adjustment
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t, err := h.svc.AdjustLedger(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidAdjustment) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.log.Error("Ledger adjustment failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+func (h *PaymentHandler) reconcile(c *gin.Context) {
+	rec, err := h.svc.Reconcile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.log.Error("Reconciliation failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
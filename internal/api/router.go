@@ -2,34 +2,51 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/admin"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/api/apikeys"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/auth"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/bookings"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/events"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/payment"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/api/venues"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/api/waitlist"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/config"
-	kafkax "github.com/samirwankhede/lewly-pgpyewj/internal/kafka"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/mailer"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/oidc"
+	paymentProvider "github.com/samirwankhede/lewly-pgpyewj/internal/payment"
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
 	adminService "github.com/samirwankhede/lewly-pgpyewj/internal/service/admin"
+	apiKeysService "github.com/samirwankhede/lewly-pgpyewj/internal/service/apikeys"
 	authService "github.com/samirwankhede/lewly-pgpyewj/internal/service/auth"
 	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
 	eventsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/events"
 	mailerService "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
 	paymentService "github.com/samirwankhede/lewly-pgpyewj/internal/service/payment"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
+	venuesService "github.com/samirwankhede/lewly-pgpyewj/internal/service/venues"
+	waitlistService "github.com/samirwankhede/lewly-pgpyewj/internal/service/waitlist"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
 	storeAdmin "github.com/samirwankhede/lewly-pgpyewj/internal/store/admin"
+	storeAPIKeys "github.com/samirwankhede/lewly-pgpyewj/internal/store/apikeys"
+	storeAudit "github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
 	storeBookings "github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	storeEvents "github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	storeLedger "github.com/samirwankhede/lewly-pgpyewj/internal/store/ledger"
+	storePayments "github.com/samirwankhede/lewly-pgpyewj/internal/store/payments"
+	storeReleases "github.com/samirwankhede/lewly-pgpyewj/internal/store/releases"
 	storeSeats "github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+	storeSessions "github.com/samirwankhede/lewly-pgpyewj/internal/store/sessions"
+	storeTiers "github.com/samirwankhede/lewly-pgpyewj/internal/store/tiers"
 	storeUsers "github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+	storeVenues "github.com/samirwankhede/lewly-pgpyewj/internal/store/venues"
 	storeWaitlist "github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
 )
 
@@ -66,6 +83,14 @@ func RegisterRoutes(r *gin.Engine, log *zap.Logger) {
 		waitlistRepo := storeWaitlist.NewWaitlistRepository(db, log)
 		adminRepo := storeAdmin.NewAdminRepository(db, log)
 		seatsRepo := storeSeats.NewSeatsRepository(db, log)
+		venuesRepo := storeVenues.NewVenuesRepository(db, log)
+		tiersRepo := storeTiers.NewTiersRepository(db, log)
+		webhooksRepo := storePayments.NewWebhooksRepository(db, log)
+		ledgerRepo := storeLedger.NewLedgerRepository(db, log)
+		sessionsRepo := storeSessions.NewSessionsRepository(db, log)
+		apiKeysRepo := storeAPIKeys.NewAPIKeysRepository(db, log)
+		auditRepo := storeAudit.NewAuditRepository(db, log)
+		releasesRepo := storeReleases.NewReleasesRepository(db, log)
 
 		// Create Redis client and mailer
 		tokens := redisx.NewTokenBucket(cfg.RedisAddr)
@@ -77,24 +102,70 @@ func RegisterRoutes(r *gin.Engine, log *zap.Logger) {
 			From: cfg.SMTPFrom,
 		}
 		mailerSvc := mailerService.NewMailerService(log, mailerSender)
+		denylist := redisx.NewTokenDenylist(cfg.RedisAddr)
+		roleCache := redisx.NewRoleCache(cfg.RedisAddr, time.Duration(cfg.RoleCacheTTLSeconds)*time.Second, adminRepo.UserRole)
+		adminRepo.SetRoleCache(roleCache)
+		provider, err := newPaymentProvider(cfg)
+		if err != nil {
+			log.Fatal("payment provider", zap.Error(err))
+		}
 
 		// Create services
-		eventsSvc := eventsService.NewEventsService(log, eventsRepo, tokens)
-		authSvc := authService.NewAuthService(log, usersRepo, tokens, cfg.JWTSigningSecret, mailerSvc)
-		producer := kafkax.NewProducer([]string{cfg.KafkaBrokers}, "bookings")
-		bookingsSvc := bookingsService.NewBookingsService(log, bookingsRepo, eventsRepo, usersRepo, tokens, producer, waitlistRepo, mailerSvc, cfg.PaymentURL)
-		paymentSvc := paymentService.NewPaymentService(log, bookingsRepo, eventsRepo)
-		adminSvc := adminService.NewAdminService(log, eventsRepo, usersRepo, bookingsRepo, adminRepo, seatsRepo, tokens, mailerSvc)
+		tiersSvc := tiersService.NewTiersService(log, tiersRepo, tokens)
+		eventsSvc := eventsService.NewEventsService(log, eventsRepo, tokens, venuesRepo, tiersSvc)
+		authSvc := authService.NewAuthService(log, usersRepo, tokens, sessionsRepo, denylist, cfg.JWTSigningSecret,
+			time.Duration(cfg.AccessTokenTTLMinutes)*time.Minute, time.Duration(cfg.RefreshTokenTTLHours)*time.Hour, newOAuthProviders(cfg), cfg.PublicURL, cfg.EmailVerifySecret, cfg.TwoFactorKey, mailerSvc)
+		offersSvc := bookingsService.NewOffersService(log, bookingsRepo, eventsRepo, usersRepo, waitlistRepo, releasesRepo, tiersSvc, tokens, mailerSvc)
+		bookingsSvc := bookingsService.NewBookingsService(log, bookingsRepo, eventsRepo, usersRepo, seatsRepo, tiersSvc, tokens, waitlistRepo, offersSvc, mailerSvc, provider, ledgerRepo, cfg.PaymentURL)
+		paymentSvc := paymentService.NewPaymentService(log, bookingsRepo, eventsRepo, tiersSvc, provider, webhooksRepo, ledgerRepo, cfg.PaymentURL, cfg.CheckoutSigningSecret, cfg.PaymentWebhookSecret)
+		adminSvc := adminService.NewAdminService(log, eventsRepo, usersRepo, bookingsRepo, adminRepo, seatsRepo, venuesRepo, waitlistRepo, tiersSvc, offersSvc, tokens, mailerSvc, auditRepo)
+		venuesSvc := venuesService.NewVenuesService(log, venuesRepo)
+		waitlistSvc := waitlistService.NewWaitlistService(log, waitlistRepo)
+		apiKeysSvc := apiKeysService.NewAPIKeysService(log, apiKeysRepo, usersRepo)
+		authMw := middleware.NewAuth(cfg.JWTSigningSecret, denylist, roleCache, usersRepo, apiKeysSvc, tokens.GetClient())
 
 		// Register handlers
-		events.NewEventsHandler(log, eventsSvc, cfg.JWTSigningSecret).Register(r)
-		auth.NewAuthHandler(log, authSvc, cfg.JWTSigningSecret).Register(r)
-		bookings.NewBookingsHandler(bookingsSvc, cfg.JWTSigningSecret).Register(r)
-		waitlist.NewWaitlistHandler(waitlistRepo, cfg.JWTSigningSecret).Register(r)
-		payment.NewPaymentHandler(log, paymentSvc, cfg.JWTSigningSecret).Register(r)
-		admin.NewAdminHandler(adminSvc, cfg.JWTSigningSecret).Register(r)
+		events.NewEventsHandler(log, eventsSvc, authMw).Register(r)
+		auth.NewAuthHandler(log, authSvc, cfg.JWTSigningSecret, authMw).Register(r)
+		bookings.NewBookingsHandler(bookingsSvc, authMw).Register(r)
+		waitlist.NewWaitlistHandler(waitlistSvc, offersSvc, authMw).Register(r)
+		payment.NewPaymentHandler(log, paymentSvc, authMw).Register(r)
+		admin.NewAdminHandler(adminSvc, authMw).Register(r)
+		venues.NewVenuesHandler(venuesSvc, authMw).Register(r)
+		apikeys.NewAPIKeysHandler(apiKeysSvc, authMw).Register(r)
 
 	} else {
 		log.Warn("db init failed", zap.Error(err))
 	}
 }
+
+// newPaymentProvider picks the payment gateway from config. Only the in-process fake
+// gateway exists so far; real gateways plug in here. An unknown provider is an error, so
+// a misconfigured deployment never takes payments through the fake gateway.
+func newPaymentProvider(cfg config.Config) (paymentProvider.PaymentProvider, error) {
+	switch cfg.PaymentProvider {
+	case "fake":
+		return paymentProvider.NewFakeProvider(paymentProvider.FakeConfig{
+			Delay:         time.Duration(cfg.FakePaymentDelayMs) * time.Millisecond,
+			WebhookURL:    cfg.PaymentURL + "/v1/payment/webhook",
+			WebhookSecret: cfg.PaymentWebhookSecret,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+}
+
+// newOAuthProviders sets up the OpenID Connect providers users can log in with.
+func newOAuthProviders(cfg config.Config) []*oidc.Provider {
+	providers := make([]*oidc.Provider, 0, len(cfg.OAuthProviders))
+	for _, p := range cfg.OAuthProviders {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+		}, nil))
+	}
+	return providers
+}
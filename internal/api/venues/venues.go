@@ -0,0 +1,107 @@
+package venues
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/service/venues"
+	storeVenues "github.com/samirwankhede/lewly-pgpyewj/internal/store/venues"
+)
+
+type VenuesHandler struct {
+	svc  *venues.VenuesService
+	auth *jwtMiddleware.Auth
+}
+
+func NewVenuesHandler(svc *venues.VenuesService, auth *jwtMiddleware.Auth) *VenuesHandler {
+	return &VenuesHandler{svc: svc, auth: auth}
+}
+
+func (h *VenuesHandler) Register(r *gin.Engine) {
+	g := r.Group("/admin/venues")
+	g.Use(h.auth.Middleware(true))
+	{
+		g.POST("", h.create)
+		g.GET("", h.list)
+		g.GET("/:id", h.get)
+		g.PUT("/:id", h.update)
+		g.DELETE("/:id", h.delete)
+	}
+}
+
+func (h *VenuesHandler) create(c *gin.Context) {
+	var in venues.VenueInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	v, err := h.svc.Create(c.Request.Context(), in)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, v)
+}
+
+func (h *VenuesHandler) list(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.List(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"venues": items, "limit": limit, "offset": offset})
+}
+
+func (h *VenuesHandler) get(c *gin.Context) {
+	v, err := h.svc.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+func (h *VenuesHandler) update(c *gin.Context) {
+	var in venues.VenueInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.svc.Update(c.Request.Context(), c.Param("id"), in); err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Venue updated successfully"})
+}
+
+func (h *VenuesHandler) delete(c *gin.Context) {
+	if err := h.svc.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Venue deleted successfully"})
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, venues.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, pgx.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, storeVenues.ErrVenueInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,22 +1,25 @@
 package waitlist
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
-	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/service/waitlist"
 )
 
 type WaitlistHandler struct {
-	repo   *waitlist.WaitlistRepository
-	secret string
+	svc    *waitlist.WaitlistService
+	offers *bookings.OffersService
+	auth   *jwtMiddleware.Auth
 }
 
-func NewWaitlistHandler(repo *waitlist.WaitlistRepository, secret string) *WaitlistHandler {
-	return &WaitlistHandler{repo: repo, secret: secret}
+func NewWaitlistHandler(svc *waitlist.WaitlistService, offers *bookings.OffersService, auth *jwtMiddleware.Auth) *WaitlistHandler {
+	return &WaitlistHandler{svc: svc, offers: offers, auth: auth}
 }
 
 func (h *WaitlistHandler) Register(r *gin.Engine) {
@@ -24,10 +27,14 @@ func (h *WaitlistHandler) Register(r *gin.Engine) {
 	r.GET("/v1/waitlist/:event_id", h.list)
 	// These routes should be kept only for upcoming as default adds to waitlist in booking if capacity full
 	protected := r.Group("/v1/waitlist")
-	protected.Use(jwtMiddleware.Middleware(h.secret, false))
+	protected.Use(h.auth.Middleware(false))
 	{
-		protected.POST("/:event_id/join", h.join)
+		protected.POST("/:event_id/join", h.auth.VerifiedEmail(), h.join)
 		protected.POST("/:event_id/optout", h.optout)
+		protected.GET("/:event_id/me", h.me)
+		protected.GET("/offers", h.listOffers)
+		protected.POST("/offers/:id/accept", h.auth.VerifiedEmail(), h.acceptOffer)
+		protected.POST("/offers/:id/decline", h.declineOffer)
 	}
 
 }
@@ -35,7 +42,7 @@ func (h *WaitlistHandler) Register(r *gin.Engine) {
 func (h *WaitlistHandler) join(c *gin.Context) {
 	eventID := c.Param("event_id")
 	userID := c.GetString("uid")
-	pos, err := h.repo.Add(c.Request.Context(), eventID, userID)
+	pos, err := h.svc.Join(c.Request.Context(), eventID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -46,7 +53,7 @@ func (h *WaitlistHandler) join(c *gin.Context) {
 func (h *WaitlistHandler) optout(c *gin.Context) {
 	eventID := c.Param("event_id")
 	userID := c.GetString("uid")
-	if err := h.repo.OptOut(c.Request.Context(), eventID, userID); err != nil {
+	if err := h.svc.OptOut(c.Request.Context(), eventID, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -55,7 +62,7 @@ func (h *WaitlistHandler) optout(c *gin.Context) {
 
 func (h *WaitlistHandler) getCount(c *gin.Context) {
 	eventID := c.Param("event_id")
-	count, err := h.repo.Count(c.Request.Context(), eventID)
+	count, err := h.svc.Count(c.Request.Context(), eventID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -68,10 +75,50 @@ func (h *WaitlistHandler) list(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	entries, err := h.repo.ListByEvent(c.Request.Context(), eventID, limit, offset)
+	entries, err := h.svc.List(c.Request.Context(), eventID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"waitlist": entries, "limit": limit, "offset": offset})
 }
+
+func (h *WaitlistHandler) listOffers(c *gin.Context) {
+	offers, err := h.offers.ListOffers(c.Request.Context(), c.GetString("uid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"offers": offers})
+}
+
+func (h *WaitlistHandler) acceptOffer(c *gin.Context) {
+	resp, code, err := h.offers.Accept(c.Request.Context(), c.Param("id"), c.GetString("uid"))
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(code, resp)
+}
+
+func (h *WaitlistHandler) declineOffer(c *gin.Context) {
+	offer, code, err := h.offers.Decline(c.Request.Context(), c.Param("id"), c.GetString("uid"))
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(code, offer)
+}
+
+func (h *WaitlistHandler) me(c *gin.Context) {
+	pos, err := h.svc.Position(c.Request.Context(), c.Param("event_id"), c.GetString("uid"))
+	if err != nil {
+		if errors.Is(err, waitlist.ErrNotWaiting) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pos)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds application configuration loaded from environment variables.
@@ -13,6 +14,13 @@ type Config struct {
 	RedisAddr              string
 	KafkaBrokers           string
 	JWTSigningSecret       string
+	AccessTokenTTLMinutes  int
+	RefreshTokenTTLHours   int
+	RoleCacheTTLSeconds    int
+	OAuthProviders         []OAuthProvider
+	PublicURL              string
+	EmailVerifySecret      string
+	TwoFactorKey           string
 	SMTPHost               string
 	SMTPPort               int
 	SMTPUser               string
@@ -23,6 +31,13 @@ type Config struct {
 	MaxWorkerRoutineCount  int
 	MaxDBConnections       int
 	PaymentURL             string
+	PaymentProvider        string
+	FakePaymentDelayMs     int
+	PaymentWebhookSecret   string
+	CheckoutSigningSecret  string
+	// TrustedProxies may set the client address with X-Forwarded-For; with none, the
+	// address is the connection's peer
+	TrustedProxies []string
 }
 
 func Load() Config {
@@ -37,6 +52,13 @@ func Load() Config {
 		RedisAddr:              getenv("REDIS_ADDR", "localhost:6379"),
 		KafkaBrokers:           getenv("KAFKA_BROKERS", "localhost:9092"),
 		JWTSigningSecret:       getenv("JWT_SECRET", "dev-secret"),
+		AccessTokenTTLMinutes:  getenvInt("ACCESS_TOKEN_TTL_MINUTES", 15),
+		RefreshTokenTTLHours:   getenvInt("REFRESH_TOKEN_TTL_HOURS", 720),
+		RoleCacheTTLSeconds:    getenvInt("ROLE_CACHE_TTL_SECONDS", 30),
+		OAuthProviders:         loadOAuthProviders(),
+		PublicURL:              getenv("PUBLIC_URL", "http://localhost:8080"),
+		EmailVerifySecret:      getenv("EMAIL_VERIFY_SECRET", "dev-email-verify-secret"),
+		TwoFactorKey:           getenv("TWO_FACTOR_KEY", "dev-two-factor-key"),
 		SMTPHost:               getenv("SMTP_HOST", "localhost"),
 		SMTPPort:               smtpPort,
 		SMTPUser:               getenv("SMTP_USER", ""),
@@ -47,9 +69,49 @@ func Load() Config {
 		MaxWorkerRoutineCount:  maxWorkerRoutineCount,
 		MaxDBConnections:       maxDBConnections,
 		PaymentURL:             getenv("PAYMENT_URL", "http://localhost:8080"),
+		PaymentProvider:        getenv("PAYMENT_PROVIDER", "fake"),
+		FakePaymentDelayMs:     getenvInt("FAKE_PAYMENT_DELAY_MS", 100),
+		PaymentWebhookSecret:   getenv("PAYMENT_WEBHOOK_SECRET", "dev-webhook-secret"),
+		CheckoutSigningSecret:  getenv("CHECKOUT_SECRET", "dev-checkout-secret"),
+		TrustedProxies:         getenvList("TRUSTED_PROXIES"),
 	}
 }
 
+// OAuthProvider is an OpenID Connect provider users can log in with.
+type OAuthProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// loadOAuthProviders reads the providers named in OAUTH_PROVIDERS, each configured by
+// OAUTH_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _REDIRECT_URL. Providers missing an
+// issuer or client ID are skipped.
+func loadOAuthProviders() []OAuthProvider {
+	var providers []OAuthProvider
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		p := OAuthProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getenv(prefix+"REDIRECT_URL", "http://localhost:8080/v1/auth/oauth/"+name+"/callback"),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 func getenv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -57,6 +119,17 @@ func getenv(key, def string) string {
 	return def
 }
 
+// getenvList splits a comma-separated variable, dropping empty items.
+func getenvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getenvInt(key string, def int) int {
 	if v := os.Getenv(key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
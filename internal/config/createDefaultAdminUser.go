@@ -31,8 +31,8 @@ func CreateDefaultAdmin(cfg *Config, db *store.DB) error {
 
 	// Create the admin user
 	_, err = db.Pool.Exec(ctx, `
-		INSERT INTO users (name, email, password_hash, role) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, role, email_verified_at) 
+		VALUES ($1, $2, $3, $4, now())
 	`, "Admin User", cfg.AdminEmail, string(hashedPassword), "admin")
 
 	if err != nil {
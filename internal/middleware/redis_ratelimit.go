@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -99,65 +100,76 @@ func RedisRateLimitByUser(redisClient *redis.Client, rps int, burst int) gin.Han
 
 		// Create rate limit key for user
 		key := fmt.Sprintf("rate_limit_user:%s", userID)
-
-		// Use Redis sliding window counter
-		ctx := context.Background()
-
-		// Lua script for sliding window rate limiting
-		luaScript := `
-			local key = KEYS[1]
-			local window = tonumber(ARGV[1])
-			local limit = tonumber(ARGV[2])
-			local now = tonumber(ARGV[3])
-			
-			-- Remove old entries
-			redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
-			
-			-- Count current requests
-			local current = redis.call('ZCARD', key)
-			
-			if current < limit then
-				-- Add current request
-				redis.call('ZADD', key, now, now)
-				redis.call('EXPIRE', key, window)
-				return {1, limit - current - 1}
-			else
-				return {0, 0}
-			end
-		`
-
 		window := time.Duration(burst) * time.Second / time.Duration(rps)
-		now := time.Now().Unix()
-
-		result, err := redisClient.Eval(ctx, luaScript, []string{key},
-			int(window.Seconds()), burst, now).Result()
-
-		if err != nil {
-			// If Redis is down, allow the request (fail open)
-			c.Next()
+		if !allowSlidingWindow(c, redisClient, key, window, burst) {
 			return
 		}
 
-		results := result.([]interface{})
-		allowed := results[0].(int64)
-		remaining := results[1].(int64)
-
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", burst))
-		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
-		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", now+int64(window.Seconds())))
+		c.Next()
+	}
+}
 
-		if allowed == 0 {
-			c.Header("Retry-After", fmt.Sprintf("%d", int(window.Seconds())))
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Rate limit exceeded",
-				"retry_after": int(window.Seconds()),
-			})
-			return
-		}
+// allowSlidingWindow counts the request against key, allowing limit requests per window.
+// It sets the rate limit headers, and aborts with 429 and returns false when the limit is
+// reached. If Redis is down the request is allowed (fail open).
+func allowSlidingWindow(c *gin.Context, redisClient *redis.Client, key string, window time.Duration, limit int) bool {
+	// Use Redis sliding window counter
+	ctx := context.Background()
+
+	// Lua script for sliding window rate limiting
+	luaScript := `
+		local key = KEYS[1]
+		local window = tonumber(ARGV[1])
+		local limit = tonumber(ARGV[2])
+		local now = tonumber(ARGV[3])
+		local member = ARGV[4]
+		
+		-- Remove old entries
+		redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+		
+		-- Count current requests
+		local current = redis.call('ZCARD', key)
+		
+		if current < limit then
+			-- Add current request
+			redis.call('ZADD', key, now, member)
+			redis.call('EXPIRE', key, window)
+			return {1, limit - current - 1}
+		else
+			return {0, 0}
+		end
+	`
+
+	now := time.Now().Unix()
+	// Requests within the same second need distinct members to be counted separately
+	member := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	result, err := redisClient.Eval(ctx, luaScript, []string{key},
+		int(window.Seconds()), limit, now, member).Result()
+
+	if err != nil {
+		// If Redis is down, allow the request (fail open)
+		return true
+	}
 
-		c.Next()
+	results := result.([]interface{})
+	allowed := results[0].(int64)
+	remaining := results[1].(int64)
+
+	// Set rate limit headers
+	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+	c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", now+int64(window.Seconds())))
+
+	if allowed == 0 {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(window.Seconds())))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Rate limit exceeded",
+			"retry_after": int(window.Seconds()),
+		})
+		return false
 	}
+	return true
 }
 
 // HybridRateLimit combines Redis and in-memory rate limiting
@@ -13,6 +13,7 @@ func RequestLogger(log *zap.Logger) gin.HandlerFunc {
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
 			zap.Int("status", c.Writer.Status()),
+			zap.String("request_id", c.GetString("request_id")),
 		)
 	}
 }
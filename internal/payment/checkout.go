@@ -0,0 +1,48 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CheckoutLink builds a signed checkout link for the booking that stops working at expires.
+func CheckoutLink(baseURL, secret, bookingID string, amount float64, expires time.Time) string {
+	q := url.Values{}
+	q.Set("booking_id", bookingID)
+	q.Set("amount", formatAmount(amount))
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", checkoutSignature(secret, bookingID, formatAmount(amount), q.Get("expires")))
+	return fmt.Sprintf("%s/v1/payment/checkout/pay?%s", baseURL, q.Encode())
+}
+
+// VerifyCheckout checks the query of a checkout link and returns the signed amount.
+func VerifyCheckout(secret string, q url.Values, now time.Time) (string, float64, error) {
+	bookingID, amount, expires := q.Get("booking_id"), q.Get("amount"), q.Get("expires")
+	want := checkoutSignature(secret, bookingID, amount, expires)
+	if bookingID == "" || !hmac.Equal([]byte(q.Get("sig")), []byte(want)) {
+		return "", 0, ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidSignature
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", 0, ErrSignatureExpired
+	}
+	a, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return "", 0, ErrInvalidSignature
+	}
+	return bookingID, a, nil
+}
+
+func checkoutSignature(secret, bookingID, amount, expires string) string {
+	return hexHMAC(secret, bookingID+"|"+amount+"|"+expires)
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,257 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Card tokens with built-in behaviour in the fake provider, in the spirit of gateway test
+// cards. Any other token is accepted.
+const (
+	FakeTokenDecline = "tok_decline"
+	FakeTokenFail    = "tok_fail"
+	FakeTokenDelay   = "tok_delay"
+)
+
+// ErrFakeFailure is the processing error returned by the fake provider for failing rules.
+var ErrFakeFailure = errors.New("fake payment gateway failure")
+
+const fakeWebhookAttempts = 3
+
+var fakeWebhookClient = &http.Client{Timeout: 5 * time.Second}
+
+type FakeOutcome string
+
+const (
+	FakeSucceed FakeOutcome = "succeed"
+	FakeDecline FakeOutcome = "decline"
+	FakeFail    FakeOutcome = "fail"
+)
+
+// FakeRule changes how the fake provider treats matching intents. A rule matches on the
+// card token, the amount, or both; zero values match anything.
+type FakeRule struct {
+	CardToken string
+	Amount    float64
+	Outcome   FakeOutcome
+	Delay     time.Duration
+	Reason    string
+}
+
+type FakeConfig struct {
+	// Rules are checked in order before the built-in card tokens; the first match wins.
+	Rules []FakeRule
+	// Delay is added to every call, to mimic gateway latency.
+	Delay time.Duration
+	// WebhookURL receives signed events for captures and refunds, as a real gateway would
+	// send them. Empty disables webhooks.
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// FakeProvider is a deterministic in-memory PaymentProvider for local runs and tests.
+// Intent and refund IDs are sequential, so the same calls always give the same IDs.
+type FakeProvider struct {
+	cfg FakeConfig
+
+	mu      sync.Mutex
+	seq     int
+	intents map[string]*Intent
+}
+
+func NewFakeProvider(cfg FakeConfig) *FakeProvider {
+	return &FakeProvider{cfg: cfg, intents: map[string]*Intent{}}
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	rule := p.match(req.CardToken, req.Amount)
+	if err := p.wait(ctx, rule.Delay); err != nil {
+		return nil, err
+	}
+	switch rule.Outcome {
+	case FakeFail:
+		return nil, ErrFakeFailure
+	case FakeDecline:
+		reason := rule.Reason
+		if reason == "" {
+			reason = "card_declined"
+		}
+		return nil, &DeclinedError{Reason: reason}
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidState)
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = "INR"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	in := &Intent{
+		ID:        fmt.Sprintf("pi_fake_%06d", p.seq),
+		BookingID: req.BookingID,
+		Amount:    req.Amount,
+		Currency:  currency,
+		Status:    StatusRequiresCapture,
+		CreatedAt: time.Now(),
+	}
+	p.intents[in.ID] = in
+	return copyIntent(in), nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	if err := p.wait(ctx, 0); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	in, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	switch in.Status {
+	case StatusSucceeded:
+		// Capturing twice is a no-op, like most gateways
+	case StatusRequiresCapture:
+		in.Status = StatusSucceeded
+		p.notifyLocked(EventIntentSucceeded, in, in.Amount)
+	default:
+		return nil, ErrInvalidState
+	}
+	return copyIntent(in), nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount float64) (*Refund, error) {
+	if err := p.wait(ctx, 0); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	in, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if in.Status != StatusSucceeded && in.Status != StatusPartiallyRefunded {
+		return nil, ErrInvalidState
+	}
+	remaining := math.Round((in.Amount-in.AmountRefunded)*100) / 100
+	if amount <= 0 || amount > remaining {
+		return nil, fmt.Errorf("%w: can refund at most %.2f", ErrInvalidState, remaining)
+	}
+
+	in.AmountRefunded = math.Round((in.AmountRefunded+amount)*100) / 100
+	in.Status = StatusPartiallyRefunded
+	if in.AmountRefunded >= in.Amount {
+		in.Status = StatusRefunded
+	}
+	p.seq++
+	refund := &Refund{ID: fmt.Sprintf("re_fake_%06d", p.seq), IntentID: in.ID, Amount: amount}
+	p.notifyLocked(EventRefunded, in, amount)
+	return refund, nil
+}
+
+func (p *FakeProvider) GetIntent(ctx context.Context, intentID string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	in, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	return copyIntent(in), nil
+}
+
+// match returns the first configured rule for the token and amount, falling back to the
+// built-in card tokens.
+func (p *FakeProvider) match(token string, amount float64) FakeRule {
+	for _, r := range p.cfg.Rules {
+		if r.CardToken != "" && r.CardToken != token {
+			continue
+		}
+		if r.Amount != 0 && r.Amount != amount {
+			continue
+		}
+		return r
+	}
+	switch token {
+	case FakeTokenDecline:
+		return FakeRule{Outcome: FakeDecline}
+	case FakeTokenFail:
+		return FakeRule{Outcome: FakeFail}
+	case FakeTokenDelay:
+		return FakeRule{Outcome: FakeSucceed, Delay: 2 * time.Second}
+	}
+	return FakeRule{Outcome: FakeSucceed}
+}
+
+func (p *FakeProvider) wait(ctx context.Context, extra time.Duration) error {
+	d := p.cfg.Delay + extra
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// notifyLocked sends a webhook for the intent in the background. p.mu must be held.
+func (p *FakeProvider) notifyLocked(eventType string, in *Intent, amount float64) {
+	if p.cfg.WebhookURL == "" {
+		return
+	}
+	p.seq++
+	body, err := json.Marshal(WebhookEvent{
+		ID:        fmt.Sprintf("evt_fake_%06d", p.seq),
+		Type:      eventType,
+		IntentID:  in.ID,
+		BookingID: in.BookingID,
+		Amount:    amount,
+		Created:   time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+	go p.deliver(body)
+}
+
+// deliver posts a webhook, retrying a few times like a gateway would.
+func (p *FakeProvider) deliver(body []byte) {
+	for attempt := 0; attempt < fakeWebhookAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		req, err := http.NewRequest(http.MethodPost, p.cfg.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, SignWebhook(p.cfg.WebhookSecret, time.Now(), body))
+		resp, err := fakeWebhookClient.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return
+		}
+	}
+}
+
+func copyIntent(in *Intent) *Intent {
+	c := *in
+	return &c
+}
@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type IntentStatus string
+
+const (
+	// StatusRequiresCapture means the intent was authorised and can be captured.
+	StatusRequiresCapture IntentStatus = "requires_capture"
+	StatusSucceeded       IntentStatus = "succeeded"
+	StatusDeclined        IntentStatus = "declined"
+	StatusRefunded        IntentStatus = "refunded"
+	// StatusPartiallyRefunded means some, but not all, of the captured amount was refunded.
+	StatusPartiallyRefunded IntentStatus = "partially_refunded"
+)
+
+var (
+	ErrIntentNotFound = errors.New("payment intent not found")
+	// ErrInvalidState is returned when an operation does not fit the intent's status, such
+	// as capturing a declined intent or refunding more than was captured.
+	ErrInvalidState = errors.New("payment intent is not in a valid state for this operation")
+)
+
+// DeclinedError is returned when the gateway refuses the payment, as opposed to failing
+// to process it. Declines are final; other errors may be retried.
+type DeclinedError struct {
+	Reason string
+}
+
+func (e *DeclinedError) Error() string {
+	return fmt.Sprintf("payment declined: %s", e.Reason)
+}
+
+type IntentRequest struct {
+	BookingID string
+	Amount    float64
+	Currency  string
+	// CardToken is the tokenised payment method collected by the gateway's checkout.
+	CardToken string
+}
+
+type Intent struct {
+	ID             string       `json:"id"`
+	BookingID      string       `json:"booking_id"`
+	Amount         float64      `json:"amount"`
+	Currency       string       `json:"currency"`
+	Status         IntentStatus `json:"status"`
+	AmountRefunded float64      `json:"amount_refunded"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+type Refund struct {
+	ID       string  `json:"id"`
+	IntentID string  `json:"intent_id"`
+	Amount   float64 `json:"amount"`
+}
+
+// PaymentProvider is a payment gateway. Implementations must be safe for concurrent use.
+type PaymentProvider interface {
+	// CreateIntent authorises the amount on the card. A refused card gives a *DeclinedError.
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	// Capture collects an authorised intent.
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+	// Refund returns part or all of a captured intent.
+	Refund(ctx context.Context, intentID string, amount float64) (*Refund, error)
+	// GetIntent fetches the current state of an intent from the gateway.
+	GetIntent(ctx context.Context, intentID string) (*Intent, error)
+}
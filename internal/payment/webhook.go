@@ -0,0 +1,84 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the webhook signature as "t=<unix seconds>,v1=<hex hmac>",
+// where the HMAC-SHA256 covers "<t>.<raw body>".
+const SignatureHeader = "Payment-Signature"
+
+// WebhookTolerance is how far a webhook timestamp may be from now before it is rejected
+// as a replay.
+const WebhookTolerance = 5 * time.Minute
+
+const (
+	EventIntentSucceeded = "payment_intent.succeeded"
+	EventRefunded        = "charge.refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// WebhookEvent is the body the gateway posts to the webhook endpoint.
+type WebhookEvent struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	IntentID  string  `json:"intent_id"`
+	BookingID string  `json:"booking_id"`
+	Amount    float64 `json:"amount"`
+	Created   int64   `json:"created"`
+}
+
+// SignWebhook returns the SignatureHeader value for body sent at ts.
+func SignWebhook(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, hexHMAC(secret, t+"."+string(body)))
+}
+
+// VerifyWebhook checks the SignatureHeader value against the raw body and rejects
+// timestamps outside WebhookTolerance.
+func VerifyWebhook(secret, header string, body []byte, now time.Time) error {
+	var t, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sig = v
+		}
+	}
+	if t == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(hexHMAC(secret, t+"."+string(body)))) {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > WebhookTolerance || d < -WebhookTolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func hexHMAC(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
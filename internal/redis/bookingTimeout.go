@@ -2,10 +2,56 @@ package redisx
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
+const (
+	timeoutsDueKey      = "booking_timeouts:due"
+	timeoutsInflightKey = "booking_timeouts:inflight"
+	timeoutsPayloadKey  = "booking_timeouts:payloads"
+)
+
+// claimDueLua moves expired leases back to the due set, then atomically claims up to
+// ARGV[3] entries whose deadline has passed by moving them into the in-flight set with
+// a lease. Because the move happens inside a single script, two workers polling at the
+// same time can never claim the same booking.
+const claimDueLua = `
+local due = KEYS[1]
+local inflight = KEYS[2]
+local payloads = KEYS[3]
+local now = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+local stale = redis.call('ZRANGEBYSCORE', inflight, '-inf', now)
+for _, m in ipairs(stale) do
+  redis.call('ZREM', inflight, m)
+  redis.call('ZADD', due, now, m)
+end
+
+local members = redis.call('ZRANGEBYSCORE', due, '-inf', now, 'LIMIT', 0, limit)
+local out = {}
+for _, m in ipairs(members) do
+  redis.call('ZREM', due, m)
+  redis.call('ZADD', inflight, now + lease, m)
+  table.insert(out, m)
+  table.insert(out, redis.call('HGET', payloads, m) or '')
+end
+return out`
+
+// DueTimeout is a booking whose payment deadline has passed and which has been
+// claimed by the caller of ClaimDue.
+type DueTimeout struct {
+	EventID   string
+	BookingID string
+	Payload   []byte
+}
+
+// TimeoutBucket is a durable scheduler for booking payment deadlines backed by Redis
+// sorted sets scored by deadline (unix millis).
 type TimeoutBucket struct {
 	client *redis.Client
 }
@@ -15,31 +61,54 @@ func NewTimeoutBucket(addr string) *TimeoutBucket {
 	return &TimeoutBucket{client: c}
 }
 
-func (t *TimeoutBucket) NilError() error {
-	return redis.Nil
+func (t *TimeoutBucket) member(eventID, bookingID string) string {
+	return eventID + ":" + bookingID
 }
 
-func (t *TimeoutBucket) AddBooking(ctx context.Context, eventID string, bookingID string) error {
-	key := eventID + ":" + bookingID
-	return t.client.Set(ctx, key, "processing", 0).Err()
+// Schedule registers a payment deadline for a booking. Scheduling the same booking twice
+// keeps the original deadline, so redelivered finalize messages do not extend it.
+func (t *TimeoutBucket) Schedule(ctx context.Context, eventID, bookingID string, payload []byte, deadline time.Time) error {
+	m := t.member(eventID, bookingID)
+	_, err := t.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSetNX(ctx, timeoutsPayloadKey, m, payload)
+		p.ZAddNX(ctx, timeoutsDueKey, redis.Z{Score: float64(deadline.UnixMilli()), Member: m})
+		return nil
+	})
+	return err
 }
 
-func (t *TimeoutBucket) GetBooking(ctx context.Context, eventID string, bookingID string) (string, error) {
-	key := eventID + ":" + bookingID
-	v, err := t.client.Get(ctx, key).Result()
-	if err == t.NilError() {
-		return "processing", nil
+// ClaimDue claims up to limit bookings whose deadline is at or before now. Claimed
+// entries stay leased for the given duration; if they are not completed in time they
+// become due again and another worker will pick them up.
+func (t *TimeoutBucket) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]DueTimeout, error) {
+	res, err := t.client.Eval(ctx, claimDueLua,
+		[]string{timeoutsDueKey, timeoutsInflightKey, timeoutsPayloadKey},
+		now.UnixMilli(), lease.Milliseconds(), limit).StringSlice()
+	if err != nil {
+		return nil, err
 	}
-	return v, err
-}
 
-func (t *TimeoutBucket) DeleteBooking(ctx context.Context, eventID string, bookingID string) (int, error) {
-	key := eventID + ":" + bookingID
-	deletedCount, err := t.client.Del(ctx, key).Result()
-	if err != nil {
-		return 1, err
+	var due []DueTimeout
+	for i := 0; i+1 < len(res); i += 2 {
+		eventID, bookingID, ok := strings.Cut(res[i], ":")
+		if !ok {
+			continue
+		}
+		due = append(due, DueTimeout{EventID: eventID, BookingID: bookingID, Payload: []byte(res[i+1])})
 	}
-	return int(deletedCount), err
+	return due, nil
+}
+
+// Complete removes a booking from the scheduler once its timeout has been handled.
+func (t *TimeoutBucket) Complete(ctx context.Context, eventID, bookingID string) error {
+	m := t.member(eventID, bookingID)
+	_, err := t.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, timeoutsDueKey, m)
+		p.ZRem(ctx, timeoutsInflightKey, m)
+		p.HDel(ctx, timeoutsPayloadKey, m)
+		return nil
+	})
+	return err
 }
 
 func (t *TimeoutBucket) Close() { _ = t.client.Close() }
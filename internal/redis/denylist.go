@@ -0,0 +1,40 @@
+package redisx
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// TokenDenylist holds the IDs (jti) of access tokens revoked before they expire. Entries
+// expire with the tokens they block, so the set stays as small as the revocations in flight.
+type TokenDenylist struct {
+	client *redis.Client
+}
+
+func NewTokenDenylist(addr string) *TokenDenylist {
+	c := redis.NewClient(&redis.Options{Addr: addr})
+	return &TokenDenylist{client: c}
+}
+
+func (d *TokenDenylist) key(jti string) string { return "jwt_denylist:" + jti }
+
+// Revoke blocks the token until it expires. Tokens already expired are skipped.
+func (d *TokenDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return d.client.Set(ctx, d.key(jti), 1, ttl).Err()
+}
+
+func (d *TokenDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := d.client.Exists(ctx, d.key(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (d *TokenDenylist) Close() { _ = d.client.Close() }
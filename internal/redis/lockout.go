@@ -0,0 +1,93 @@
+package redisx
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// failLua counts a failure and locks the key once the threshold is reached. Each lockout
+// within the memory window doubles the lock, up to the maximum. It returns the lock length
+// in seconds, or 0 if the key is not newly locked.
+const failLua = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+if n < tonumber(ARGV[1]) then
+  return 0
+end
+redis.call('DEL', KEYS[1])
+local k = redis.call('INCR', KEYS[3])
+redis.call('EXPIRE', KEYS[3], ARGV[5])
+local d = tonumber(ARGV[3]) * 2 ^ (k - 1)
+if d > tonumber(ARGV[4]) then
+  d = tonumber(ARGV[4])
+end
+redis.call('SET', KEYS[2], 1, 'EX', math.floor(d))
+return math.floor(d)`
+
+// FailureLimiter locks out a key, such as an account or an IP address, after repeated
+// failures within a window. Lockouts grow exponentially while they keep recurring.
+type FailureLimiter struct {
+	client    *redis.Client
+	prefix    string
+	threshold int
+	window    time.Duration
+	base      time.Duration
+	max       time.Duration
+	memory    time.Duration
+}
+
+// NewFailureLimiter locks a key for base after threshold failures within window, doubling
+// for every further lockout within memory, up to max.
+func NewFailureLimiter(client *redis.Client, prefix string, threshold int, window, base, max, memory time.Duration) *FailureLimiter {
+	return &FailureLimiter{client: client, prefix: prefix, threshold: threshold, window: window, base: base, max: max, memory: memory}
+}
+
+func (l *FailureLimiter) failKey(key string) string {
+	return "auth_fail:" + l.prefix + ":" + key
+}
+
+func (l *FailureLimiter) lockKey(key string) string {
+	return "auth_lock:" + l.prefix + ":" + key
+}
+
+func (l *FailureLimiter) lockoutsKey(key string) string {
+	return "auth_lockouts:" + l.prefix + ":" + key
+}
+
+// Locked returns how much longer the key is locked, or 0.
+func (l *FailureLimiter) Locked(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := l.client.TTL(ctx, l.lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Fail records a failure and returns the lock length if it locked the key.
+func (l *FailureLimiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	res, err := l.client.Eval(ctx, failLua,
+		[]string{l.failKey(key), l.lockKey(key), l.lockoutsKey(key)},
+		l.threshold, int(l.window.Seconds()), int(l.base.Seconds()), int(l.max.Seconds()), int(l.memory.Seconds()),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res) * time.Second, nil
+}
+
+// Reset forgets the failures counted so far. Past lockouts still count towards the next one.
+func (l *FailureLimiter) Reset(ctx context.Context, key string) error {
+	return l.client.Del(ctx, l.failKey(key)).Err()
+}
+
+// Unlock lifts a lock and forgets the key's failures and lockouts.
+func (l *FailureLimiter) Unlock(ctx context.Context, key string) error {
+	return l.client.Del(ctx, l.failKey(key), l.lockKey(key), l.lockoutsKey(key)).Err()
+}
@@ -0,0 +1,46 @@
+package redisx
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// RoleCache answers the role checks of the auth middleware from Redis, loading roles from
+// the database on a miss. Entries expire after the TTL and are dropped when a role changes.
+type RoleCache struct {
+	client *redis.Client
+	ttl    time.Duration
+	load   func(ctx context.Context, userID string) (string, error)
+}
+
+// NewRoleCache caches the roles returned by load, which returns "" for unknown users.
+func NewRoleCache(addr string, ttl time.Duration, load func(ctx context.Context, userID string) (string, error)) *RoleCache {
+	c := redis.NewClient(&redis.Options{Addr: addr})
+	return &RoleCache{client: c, ttl: ttl, load: load}
+}
+
+func (c *RoleCache) key(userID string) string { return "user_role:" + userID }
+
+// Role returns the user's current role, or "" for an unknown user. When Redis is down the
+// role is read from the database on every call instead.
+func (c *RoleCache) Role(ctx context.Context, userID string) (string, error) {
+	role, err := c.client.Get(ctx, c.key(userID)).Result()
+	if err == nil {
+		return role, nil
+	}
+	role, err = c.load(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	_ = c.client.Set(ctx, c.key(userID), role, c.ttl).Err()
+	return role, nil
+}
+
+// Invalidate drops the cached role so the next check reads it from the database.
+func (c *RoleCache) Invalidate(ctx context.Context, userID string) error {
+	return c.client.Del(ctx, c.key(userID)).Err()
+}
+
+func (c *RoleCache) Close() { _ = c.client.Close() }
@@ -3,6 +3,7 @@ package redisx
 import (
 	"context"
 	"fmt"
+	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
@@ -18,6 +19,32 @@ else
   return 0
 end`
 
+// reserveTiersLua takes ARGV[i] tokens from every KEYS[i], or nothing if any key is short.
+const reserveTiersLua = `
+for i, key in ipairs(KEYS) do
+  if tonumber(redis.call('GET', key) or '0') < tonumber(ARGV[i]) then
+    return 0
+  end
+end
+for i, key in ipairs(KEYS) do
+  redis.call('DECRBY', key, ARGV[i])
+end
+return 1`
+
+// releaseOnceLua gives back ARGV[2] event tokens to KEYS[2] and ARGV[i] tier tokens to
+// the remaining KEYS[i], unless the marker KEYS[1] shows this release was already applied.
+const releaseOnceLua = `
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[1]) then
+  return 0
+end
+for i = 2, #KEYS do
+  redis.call('INCRBY', KEYS[i], ARGV[i])
+end
+return 1`
+
+// releaseMarkerTTL keeps the marker of an applied release long after any retry of it.
+const releaseMarkerTTL = 7 * 24 * time.Hour
+
 type TokenBucket struct{ client *redis.Client }
 
 func NewTokenBucket(addr string) *TokenBucket {
@@ -27,6 +54,10 @@ func NewTokenBucket(addr string) *TokenBucket {
 
 func (t *TokenBucket) key(eventID string) string { return fmt.Sprintf("event_tokens:%s", eventID) }
 
+func (t *TokenBucket) tierKey(eventID, tierID string) string {
+	return fmt.Sprintf("event_tokens:%s:tier:%s", eventID, tierID)
+}
+
 func (t *TokenBucket) InitTokens(ctx context.Context, eventID string, capacity int) error {
 	return t.client.Set(ctx, t.key(eventID), capacity, 0).Err()
 }
@@ -52,6 +83,65 @@ func (t *TokenBucket) Remaining(ctx context.Context, eventID string) (int, error
 	return v, err
 }
 
+// InitTierTokens sets the capacity of a ticket tier. Tier tokens are taken on top of the
+// event tokens, so a tier can never sell more than the event has left.
+func (t *TokenBucket) InitTierTokens(ctx context.Context, eventID, tierID string, quota int) error {
+	return t.client.Set(ctx, t.tierKey(eventID, tierID), quota, 0).Err()
+}
+
+// ReserveTiers atomically takes counts[tierID] tokens from each tier, all or nothing.
+func (t *TokenBucket) ReserveTiers(ctx context.Context, eventID string, counts map[string]int) (bool, error) {
+	if len(counts) == 0 {
+		return true, nil
+	}
+	keys := make([]string, 0, len(counts))
+	args := make([]interface{}, 0, len(counts))
+	for tierID, n := range counts {
+		keys = append(keys, t.tierKey(eventID, tierID))
+		args = append(args, n)
+	}
+	res := t.client.Eval(ctx, reserveTiersLua, keys, args...)
+	if res.Err() != nil {
+		return false, res.Err()
+	}
+	v, _ := res.Int()
+	return v == 1, nil
+}
+
+func (t *TokenBucket) ReleaseTiers(ctx context.Context, eventID string, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for tierID, n := range counts {
+			pipe.IncrBy(ctx, t.tierKey(eventID, tierID), int64(n))
+		}
+		return nil
+	})
+	return err
+}
+
+// ReleaseOnce gives back n event tokens and counts[tierID] tier tokens for the release
+// with the given ID. Retrying the same release is a no-op, so callers can retry freely
+// until they have recorded it as done.
+func (t *TokenBucket) ReleaseOnce(ctx context.Context, releaseID, eventID string, n int, counts map[string]int) error {
+	keys := []string{fmt.Sprintf("token_release:%s", releaseID), t.key(eventID)}
+	args := []interface{}{int64(releaseMarkerTTL / time.Second), n}
+	for tierID, c := range counts {
+		keys = append(keys, t.tierKey(eventID, tierID))
+		args = append(args, c)
+	}
+	return t.client.Eval(ctx, releaseOnceLua, keys, args...).Err()
+}
+
+func (t *TokenBucket) TierRemaining(ctx context.Context, eventID, tierID string) (int, error) {
+	v, err := t.client.Get(ctx, t.tierKey(eventID, tierID)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
 func (t *TokenBucket) Close() { _ = t.client.Close() }
 
 // GetClient returns the underlying Redis client for OTP operations
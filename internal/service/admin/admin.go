@@ -4,19 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
 	mailer "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/admin"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/venues"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
 )
 
+// bookingPageSize is how many bookings are read at a time when going through an event.
+const bookingPageSize = 500
+
 type AdminService struct {
 	log      *zap.Logger
 	events   *events.EventsRepository
@@ -24,32 +35,72 @@ type AdminService struct {
 	bookings *bookings.BookingsRepository
 	admin    *admin.AdminRepository
 	seats    *seats.SeatsRepository
+	venues   *venues.VenuesRepository
+	waitlist *waitlist.WaitlistRepository
+	tiers    *tiersService.TiersService
+	offers   *bookingsService.OffersService
 	tokens   *redisx.TokenBucket
 	mailer   *mailer.MailerService
+	audit    *audit.AuditRepository
 }
 
-func NewAdminService(log *zap.Logger, events *events.EventsRepository, users *users.UsersRepository, bookings *bookings.BookingsRepository, admin *admin.AdminRepository, seats *seats.SeatsRepository, tokens *redisx.TokenBucket, mailer *mailer.MailerService) *AdminService {
-	return &AdminService{log: log, events: events, users: users, bookings: bookings, admin: admin, seats: seats, tokens: tokens, mailer: mailer}
+var ErrValidation = errors.New("validation error")
+
+func NewAdminService(log *zap.Logger, events *events.EventsRepository, users *users.UsersRepository, bookings *bookings.BookingsRepository, admin *admin.AdminRepository, seats *seats.SeatsRepository, venues *venues.VenuesRepository, waitlist *waitlist.WaitlistRepository, tiers *tiersService.TiersService, offers *bookingsService.OffersService, tokens *redisx.TokenBucket, mailer *mailer.MailerService, audit *audit.AuditRepository) *AdminService {
+	return &AdminService{log: log, events: events, users: users, bookings: bookings, admin: admin, seats: seats, venues: venues, waitlist: waitlist, tiers: tiers, offers: offers, tokens: tokens, mailer: mailer, audit: audit}
 }
 
 type AdminEvent struct {
 	Name                     string          `json:"name" binding:"required"`
-	Venue                    string          `json:"venue" binding:"required"`
+	Venue                    string          `json:"venue"`
 	Category                 string          `json:"category"`
 	StartTime                time.Time       `json:"start_time" binding:"required"`
 	EndTime                  time.Time       `json:"end_time" binding:"required"`
-	Capacity                 int             `json:"capacity" binding:"required"`
+	Capacity                 int             `json:"capacity"`
 	Metadata                 json.RawMessage `json:"metadata"`
 	TicketPrice              float64         `json:"ticket_price"`
 	CancellationFee          float64         `json:"cancellation_fee"`
 	MaximumTicketsPerBooking int             `json:"maximum_tickets_per_booking"`
-	Seats                    []string        `json:"seats" binding:"required"`
+	// Either VenueID, to generate the seats from a venue's seat map, or explicit Seats
+	// matching Capacity.
+	VenueID *string  `json:"venue_id"`
+	Seats   []string `json:"seats"`
+	// Tiers are optional; seats outside any tier sell at TicketPrice.
+	Tiers []tiersService.TierInput `json:"tiers"`
 }
 
-func (a *AdminService) CreateEvent(ctx context.Context, in AdminEvent) (*events.Event, error) {
-	// Validate seats array size matches capacity
-	if len(in.Seats) != in.Capacity {
-		return nil, errors.New("seats array size must match event capacity")
+// CreateEvent creates an event. An organizer creating one becomes its owner.
+func (a *AdminService) CreateEvent(ctx context.Context, actor Actor, in AdminEvent) (*events.Event, error) {
+	if !actor.IsAdmin() && actor.Role != "organizer" {
+		return nil, ErrForbidden
+	}
+	if in.VenueID != nil {
+		// Capacity and seats come from the venue's seat map
+		if len(in.Seats) > 0 {
+			return nil, fmt.Errorf("%w: seats cannot be given together with venue_id", ErrValidation)
+		}
+		venue, err := a.venues.Get(ctx, *in.VenueID)
+		if err != nil {
+			return nil, err
+		}
+		if venue == nil {
+			return nil, fmt.Errorf("%w: venue not found", ErrValidation)
+		}
+		if in.Capacity != 0 && in.Capacity != venue.SeatCount {
+			return nil, fmt.Errorf("%w: capacity must match the %d seats of the venue", ErrValidation, venue.SeatCount)
+		}
+		in.Capacity = venue.SeatCount
+		if in.Venue == "" {
+			in.Venue = venue.Name
+		}
+	} else {
+		if in.Venue == "" || in.Capacity <= 0 {
+			return nil, fmt.Errorf("%w: venue and capacity are required without venue_id", ErrValidation)
+		}
+		// Validate seats array size matches capacity
+		if len(in.Seats) != in.Capacity {
+			return nil, fmt.Errorf("%w: seats array size must match event capacity", ErrValidation)
+		}
 	}
 
 	e := &events.Event{
@@ -64,14 +115,36 @@ func (a *AdminService) CreateEvent(ctx context.Context, in AdminEvent) (*events.
 		TicketPrice:              in.TicketPrice,
 		CancellationFee:          in.CancellationFee,
 		MaximumTicketsPerBooking: in.MaximumTicketsPerBooking,
+		VenueID:                  in.VenueID,
+	}
+	for _, t := range in.Tiers {
+		if err := tiersService.Validate(e, t); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
 	}
-	e, err := a.events.Create(ctx, e)
+	// An organizer's event is theirs from the moment it exists
+	e, err := a.events.Create(ctx, e, func(tx pgx.Tx) error {
+		if err := a.recordTx(ctx, tx, actor, ActionEventCreate, audit.TargetEvent, e.ID, nil, e); err != nil {
+			return err
+		}
+		if actor.IsAdmin() {
+			return nil
+		}
+		if err := admin.AddEventOrganizerTx(ctx, tx, e.ID, actor.UserID, admin.EventOwner, actor.UserID); err != nil {
+			return err
+		}
+		return a.recordTx(ctx, tx, actor, ActionEventOrganizerAdd, audit.TargetEvent, e.ID, nil, organizerSnapshot{UserID: actor.UserID, Role: admin.EventOwner})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Create seats in the seats table
-	err = a.seats.CreateSeats(ctx, e.ID, in.Seats)
+	// Create seats in the seats table, from the venue template if there is one
+	if in.VenueID != nil {
+		_, err = a.venues.GenerateEventSeats(ctx, e.ID, *in.VenueID)
+	} else {
+		err = a.seats.CreateSeats(ctx, e.ID, in.Seats)
+	}
 	if err != nil {
 		a.log.Error("Failed to create seats", zap.Error(err), zap.String("event_id", e.ID))
 		// Note: We don't return error here as the event is already created
@@ -79,14 +152,62 @@ func (a *AdminService) CreateEvent(ctx context.Context, in AdminEvent) (*events.
 	}
 
 	_ = a.tokens.InitTokens(ctx, e.ID, e.Capacity)
+
+	for _, t := range in.Tiers {
+		_, err := a.tiers.Create(ctx, e, t, a.tierCreated(ctx, actor, e.ID))
+		if err != nil {
+			return nil, fmt.Errorf("event %s created but tier %s failed, add it again: %w", e.ID, t.Name, err)
+		}
+	}
 	return e, nil
 }
 
-func (a *AdminService) GetSummary(ctx context.Context, from, to time.Time) (*admin.AnalyticsSummary, error) {
-	return a.admin.GetSummary(ctx, from, to)
+// CreateTier adds a ticket tier to an existing event.
+func (a *AdminService) CreateTier(ctx context.Context, actor Actor, eventID string, in tiersService.TierInput) (*tiers.Tier, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	event, err := a.events.Get(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, errors.New("event not found")
+	}
+	t, err := a.tiers.Create(ctx, event, in, a.tierCreated(ctx, actor, eventID))
+	if errors.Is(err, tiersService.ErrValidation) {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// tierCreated audits a new tier of the event in the transaction creating it.
+func (a *AdminService) tierCreated(ctx context.Context, actor Actor, eventID string) func(tx pgx.Tx, t *tiers.Tier) error {
+	return func(tx pgx.Tx, t *tiers.Tier) error {
+		return a.recordTx(ctx, tx, actor, ActionEventTierCreate, audit.TargetEvent, eventID, nil, t)
+	}
+}
+
+// GetSummary summarizes the whole platform for admins and their own events for organizers.
+func (a *AdminService) GetSummary(ctx context.Context, actor Actor, from, to time.Time) (*admin.AnalyticsSummary, error) {
+	if !actor.IsAdmin() && actor.Role != "organizer" {
+		return nil, ErrForbidden
+	}
+	return a.admin.GetSummary(ctx, from, to, actor.organizer())
+}
+
+// statusSnapshot is the audited state of an event cancellation.
+type statusSnapshot struct {
+	Status string `json:"status"`
 }
 
-func (a *AdminService) CancelEvent(ctx context.Context, eventID string) error {
+func (a *AdminService) CancelEvent(ctx context.Context, actor Actor, eventID string) error {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return err
+	}
 	// Get event details for email notifications
 	event, err := a.events.Get(ctx, eventID)
 	if err != nil {
@@ -97,44 +218,60 @@ func (a *AdminService) CancelEvent(ctx context.Context, eventID string) error {
 	}
 
 	// Cancel the event
-	err = a.admin.CancelEvent(ctx, eventID)
+	err = a.admin.CancelEvent(ctx, eventID, func(tx pgx.Tx, previousStatus string) error {
+		return a.recordTx(ctx, tx, actor, ActionEventCancel, audit.TargetEvent, eventID, statusSnapshot{Status: previousStatus}, statusSnapshot{Status: "cancelled"})
+	})
 	if err != nil {
 		return err
 	}
 
-	bookings, err := a.bookings.ListByEvent(ctx, eventID, 1000, 0) // Get all bookings
-	if err != nil {
-		return err
-	}
-	for _, booking := range bookings {
-		if booking.PaymentStatus == "paid" {
+	err = a.bookings.ForEachByEvent(ctx, eventID, bookingPageSize, func(page []*bookings.Booking) error {
+		for _, booking := range page {
+			if booking.PaymentStatus != "paid" {
+				continue
+			}
 			user, err := a.users.GetByID(ctx, booking.UserID)
-			if err != nil {
+			if err != nil || user == nil {
 				a.log.Error("User not found", zap.String("user_id", booking.UserID))
+				continue
 			}
-			a.mailer.SendEventCancellationEmail(user.Email, event.Name, event.TicketPrice)
+			a.mailer.SendEventCancellationEmail(user.Email, event.Name, booking.AmountPaid)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	a.log.Info("Event cancelled", zap.String("event_id", eventID), zap.String("event_name", event.Name))
 	return nil
 }
 
-func (a *AdminService) UpdateEvent(ctx context.Context, eventID string, updates map[string]interface{}) error {
-	return a.admin.UpdateEvent(ctx, eventID, updates)
-}
-
-func (a *AdminService) CreateAdminFromUser(ctx context.Context, userID string) error {
-	return a.admin.CreateAdminFromUser(ctx, userID)
+func (a *AdminService) CreateAdminFromUser(ctx context.Context, actor Actor, userID string) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	return a.changeRole(ctx, actor, userID, "admin", a.admin.CreateAdminFromUser)
 }
 
-func (a *AdminService) RemoveAdmin(ctx context.Context, userID string) error {
-	return a.admin.RemoveAdmin(ctx, userID)
+func (a *AdminService) RemoveAdmin(ctx context.Context, actor Actor, userID string) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	return a.changeRole(ctx, actor, userID, "user", a.admin.RemoveAdmin)
 }
 
-func (a *AdminService) RemoveUser(ctx context.Context, userID string) error {
-	return a.admin.RemoveUser(ctx, userID)
+func (a *AdminService) RemoveUser(ctx context.Context, actor Actor, userID string) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	return a.admin.RemoveUser(ctx, userID, func(tx pgx.Tx, removed *users.User) error {
+		return a.recordTx(ctx, tx, actor, ActionUserRemove, audit.TargetUser, userID, removed, nil)
+	})
 }
 
-func (a *AdminService) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+func (a *AdminService) GetUserByEmail(ctx context.Context, actor Actor, email string) (*users.User, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
 	return a.users.GetByEmail(ctx, email)
 }
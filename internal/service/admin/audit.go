@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+)
+
+// Audited actions, named <target>.<verb>.
+const (
+	ActionEventCreate          = "event.create"
+	ActionEventUpdate          = "event.update"
+	ActionEventCancel          = "event.cancel"
+	ActionEventCapacity        = "event.capacity"
+	ActionEventTierCreate      = "event.tier.create"
+	ActionEventWaitlistRules   = "event.waitlist_priorities"
+	ActionEventOrganizerAdd    = "event.organizer.add"
+	ActionEventOrganizerRemove = "event.organizer.remove"
+	ActionUserRole             = "user.role"
+	ActionUserRemove           = "user.remove"
+	ActionUserWaitlistGroups   = "user.waitlist_groups"
+)
+
+// AuditQuery filters the audit log; empty fields match everything.
+type AuditQuery struct {
+	ActorID    string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// ListAudit returns audit entries, newest first. Only admins may read the log.
+func (a *AdminService) ListAudit(ctx context.Context, actor Actor, q AuditQuery) ([]*audit.Entry, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
+	if q.ActorID != "" {
+		if _, err := uuid.Parse(q.ActorID); err != nil {
+			return nil, fmt.Errorf("%w: actor_id must be a user id", ErrValidation)
+		}
+	}
+	switch q.TargetType {
+	case "", audit.TargetEvent, audit.TargetUser:
+	default:
+		return nil, fmt.Errorf("%w: target_type must be event or user", ErrValidation)
+	}
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return a.audit.List(ctx, audit.Filter{
+		ActorID:    q.ActorID,
+		TargetType: q.TargetType,
+		TargetID:   q.TargetID,
+		From:       q.From,
+		To:         q.To,
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+	})
+}
+
+// recordTx appends a change to the audit log inside the transaction that makes it, with
+// snapshots of the target before and after it; either may be nil. If the entry cannot be
+// written the error rolls the change back too, so no change goes unrecorded.
+func (a *AdminService) recordTx(ctx context.Context, tx pgx.Tx, actor Actor, action, targetType, targetID string, before, after any) error {
+	e := &audit.Entry{
+		ActorRole:  actor.Role,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+		IP:         actor.IP,
+		RequestID:  actor.RequestID,
+	}
+	if actor.UserID != "" {
+		e.ActorID = &actor.UserID
+	}
+	if err := audit.AppendTx(ctx, tx, e); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// audited returns a hook for store methods that records the change with recordTx. The
+// snapshots are taken when the hook runs, inside the transaction.
+func (a *AdminService) audited(ctx context.Context, actor Actor, action, targetType, targetID string, before, after any) func(tx pgx.Tx) error {
+	return func(tx pgx.Tx) error {
+		return a.recordTx(ctx, tx, actor, action, targetType, targetID, before, after)
+	}
+}
+
+func snapshot(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	return b
+}
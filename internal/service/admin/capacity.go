@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
+)
+
+var (
+	ErrEventNotFound = errors.New("event not found")
+	// ErrCapacityReserved is returned when a decrease would take capacity below the seats
+	// already held, booked or being booked.
+	ErrCapacityReserved = errors.New("capacity is below current reservations")
+	ErrCapacityChanged  = errors.New("capacity was changed concurrently, retry")
+)
+
+// CapacityInput sets an event's capacity. Raising it needs one new seat label per added
+// seat; lowering it removes the given available seats, or the last available ones.
+type CapacityInput struct {
+	Capacity int      `json:"capacity" binding:"required,min=1"`
+	Seats    []string `json:"seats"`
+}
+
+// capacitySnapshot is the audited state of an event before a capacity change; the
+// CapacityChange itself is the state after.
+type capacitySnapshot struct {
+	Capacity int `json:"capacity"`
+}
+
+type CapacityResult struct {
+	*events.CapacityChange
+	Offers []*waitlist.Offer `json:"offers"`
+}
+
+// ChangeCapacity resizes the event's seat map, event_capacity and token bucket together.
+// Added seats are offered straight to the waitlist, one per user.
+func (a *AdminService) ChangeCapacity(ctx context.Context, actor Actor, eventID string, in CapacityInput) (*CapacityResult, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	event, err := a.events.Get(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, ErrEventNotFound
+	}
+	if event.Status == "cancelled" || event.Status == "expired" {
+		return nil, fmt.Errorf("%w: capacity of a %s event cannot change", ErrValidation, event.Status)
+	}
+	seen := make(map[string]bool, len(in.Seats))
+	for _, label := range in.Seats {
+		if label == "" || seen[label] {
+			return nil, fmt.Errorf("%w: seat labels must be unique and non-empty", ErrValidation)
+		}
+		seen[label] = true
+	}
+
+	// Take the removed seats' tokens first: if they are already out for bookings in
+	// flight, the event cannot shrink that far
+	shrink := event.Capacity - in.Capacity
+	if shrink > 0 {
+		ok, err := a.tokens.Reserve(ctx, eventID, shrink)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: fewer than %d seats are unreserved", ErrCapacityReserved, shrink)
+		}
+	}
+
+	change, err := a.events.ChangeCapacity(ctx, eventID, event.Capacity, in.Capacity, in.Seats, in.Seats, func(tx pgx.Tx, change *events.CapacityChange) error {
+		return a.recordTx(ctx, tx, actor, ActionEventCapacity, audit.TargetEvent, eventID, capacitySnapshot{Capacity: change.PreviousCapacity}, change)
+	})
+	if err != nil {
+		if shrink > 0 {
+			_ = a.tokens.Release(ctx, eventID, shrink)
+		}
+		var below *events.CapacityBelowReservedError
+		var unavailable *seats.SeatsUnavailableError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrEventNotFound
+		case errors.Is(err, events.ErrCapacityChanged):
+			return nil, ErrCapacityChanged
+		case errors.As(err, &below):
+			return nil, fmt.Errorf("%w: %s", ErrCapacityReserved, err.Error())
+		case errors.Is(err, events.ErrSeatLabels), errors.As(err, &unavailable):
+			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+		return nil, err
+	}
+
+	res := &CapacityResult{CapacityChange: change, Offers: []*waitlist.Offer{}}
+	if len(change.AddedSeats) > 0 {
+		// The new seats' tokens are handed to the waitlist offers, or back to the bucket
+		res.Offers = a.offers.OfferBatch(ctx, event, change.AddedSeats)
+	}
+	a.log.Info("Event capacity changed",
+		zap.String("event_id", eventID),
+		zap.Int("from", change.PreviousCapacity),
+		zap.Int("to", change.Capacity),
+		zap.Int("offers", len(res.Offers)))
+	return res, nil
+}
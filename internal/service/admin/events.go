@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+)
+
+var (
+	// ErrVersionRequired is returned when an update names neither an If-Match ETag nor the
+	// updated_at it was based on.
+	ErrVersionRequired = errors.New("If-Match header or updated_at is required")
+	ErrEventStale      = errors.New("event was modified since it was read, fetch it again")
+)
+
+// EventPatch lists the event fields admins may edit; fields left out are unchanged.
+// Capacity has its own operation, status changes go through cancellation, and counters
+// such as reserved and likes are never set by hand.
+type EventPatch struct {
+	Name                     *string         `json:"name"`
+	Venue                    *string         `json:"venue"`
+	Category                 *string         `json:"category"`
+	StartTime                *time.Time      `json:"start_time"`
+	EndTime                  *time.Time      `json:"end_time"`
+	Metadata                 json.RawMessage `json:"metadata"`
+	TicketPrice              *float64        `json:"ticket_price"`
+	CancellationFee          *float64        `json:"cancellation_fee"`
+	MaximumTicketsPerBooking *int            `json:"maximum_tickets_per_booking"`
+	// UpdatedAt is the version of the event the patch was based on, for clients that do
+	// not send If-Match.
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// UpdateEvent applies the patch if the event is still at the version named by ifMatch, or
+// else by the patch's updated_at, and records the diff. A patch that changes nothing is
+// not audited.
+func (a *AdminService) UpdateEvent(ctx context.Context, actor Actor, eventID string, patch EventPatch, ifMatch string) (*events.Event, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	var version time.Time
+	switch {
+	case ifMatch != "":
+		v, err := parseETag(ifMatch)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed If-Match", ErrValidation)
+		}
+		version = v
+	case patch.UpdatedAt != nil:
+		version = *patch.UpdatedAt
+	default:
+		return nil, ErrVersionRequired
+	}
+
+	var before events.Event
+	event, err := a.events.Patch(ctx, eventID, version, actor.UserID, func(e *events.Event) (map[string]events.FieldChange, error) {
+		before = *e
+		return applyPatch(e, patch)
+	}, func(tx pgx.Tx, e *events.Event) error {
+		return a.recordTx(ctx, tx, actor, ActionEventUpdate, audit.TargetEvent, eventID, &before, e)
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrEventNotFound
+	case errors.Is(err, events.ErrStale):
+		return nil, ErrEventStale
+	case err != nil:
+		return nil, err
+	}
+	return event, nil
+}
+
+// EventChanges lists the recorded edits of an event, newest first.
+func (a *AdminService) EventChanges(ctx context.Context, actor Actor, eventID string, limit, offset int) ([]*events.Change, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return a.events.ListChanges(ctx, eventID, limit, offset)
+}
+
+// applyPatch sets the patched fields on e, validates the result and returns what changed.
+func applyPatch(e *events.Event, p EventPatch) (map[string]events.FieldChange, error) {
+	diff := map[string]events.FieldChange{}
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		return nil, fmt.Errorf("%w: name cannot be empty", ErrValidation)
+	}
+	patchField(diff, "name", &e.Name, p.Name)
+	patchField(diff, "venue", &e.Venue, p.Venue)
+	patchField(diff, "category", &e.Category, p.Category)
+	patchTime(diff, "start_time", &e.StartTime, p.StartTime)
+	patchTime(diff, "end_time", &e.EndTime, p.EndTime)
+	if p.StartTime != nil || p.EndTime != nil {
+		if !e.EndTime.After(e.StartTime) {
+			return nil, fmt.Errorf("%w: end_time must be after start_time", ErrValidation)
+		}
+	}
+
+	if p.Metadata != nil {
+		var obj map[string]any
+		if err := json.Unmarshal(p.Metadata, &obj); err != nil || obj == nil {
+			return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrValidation)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, p.Metadata); err != nil {
+			return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrValidation)
+		}
+		var current bytes.Buffer
+		_ = json.Compact(&current, e.Metadata)
+		if !bytes.Equal(compact.Bytes(), current.Bytes()) {
+			diff["metadata"] = events.FieldChange{From: json.RawMessage(e.Metadata), To: json.RawMessage(compact.Bytes())}
+			e.Metadata = compact.Bytes()
+		}
+	}
+
+	if p.TicketPrice != nil && *p.TicketPrice < 0 {
+		return nil, fmt.Errorf("%w: ticket_price cannot be negative", ErrValidation)
+	}
+	if p.CancellationFee != nil && *p.CancellationFee < 0 {
+		return nil, fmt.Errorf("%w: cancellation_fee cannot be negative", ErrValidation)
+	}
+	patchField(diff, "ticket_price", &e.TicketPrice, p.TicketPrice)
+	patchField(diff, "cancellation_fee", &e.CancellationFee, p.CancellationFee)
+
+	if m := p.MaximumTicketsPerBooking; m != nil && (*m < 1 || *m > e.Capacity) {
+		return nil, fmt.Errorf("%w: maximum_tickets_per_booking must be between 1 and the capacity %d", ErrValidation, e.Capacity)
+	}
+	patchField(diff, "maximum_tickets_per_booking", &e.MaximumTicketsPerBooking, p.MaximumTicketsPerBooking)
+	return diff, nil
+}
+
+func patchField[T comparable](diff map[string]events.FieldChange, field string, dst *T, v *T) {
+	if v == nil || *v == *dst {
+		return
+	}
+	diff[field] = events.FieldChange{From: *dst, To: *v}
+	*dst = *v
+}
+
+func patchTime(diff map[string]events.FieldChange, field string, dst *time.Time, v *time.Time) {
+	if v == nil || v.Equal(*dst) {
+		return
+	}
+	diff[field] = events.FieldChange{From: *dst, To: *v}
+	*dst = *v
+}
+
+// parseETag reads the version from an ETag made by events.Event.ETag.
+func parseETag(tag string) (time.Time, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	s, err := strconv.Unquote(tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	micros, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMicro(micros), nil
+}
@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/admin"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+)
+
+var (
+	// ErrForbidden is returned when an organizer acts on an event they do not organize, or
+	// on anything only admins may do.
+	ErrForbidden         = errors.New("not allowed for this user")
+	ErrNotEventOrganizer = errors.New("user is not a member organizer of this event")
+)
+
+// Actor is the admin or organizer making a call, as authenticated by the middleware. IP
+// and RequestID go into the audit log.
+type Actor struct {
+	UserID    string
+	Role      string
+	IP        string
+	RequestID string
+}
+
+func (a Actor) IsAdmin() bool { return a.Role == "admin" }
+
+// organizer returns the actor's ID if their access is limited to the events they organize,
+// or nil for admins.
+func (a Actor) organizer() *string {
+	if a.IsAdmin() {
+		return nil
+	}
+	return &a.UserID
+}
+
+func requireAdmin(actor Actor) error {
+	if !actor.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// authorizeEvent lets admins act on any event and organizers on the events they organize.
+// With owner set, organizers must own the event.
+func (a *AdminService) authorizeEvent(ctx context.Context, actor Actor, eventID string, owner bool) error {
+	if actor.IsAdmin() {
+		return nil
+	}
+	if actor.Role != "organizer" {
+		return ErrForbidden
+	}
+	role, err := a.admin.EventOrganizerRole(ctx, eventID, actor.UserID)
+	if err != nil {
+		return err
+	}
+	if role == "" || (owner && role != admin.EventOwner) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (a *AdminService) CreateOrganizerFromUser(ctx context.Context, actor Actor, userID string) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	err := a.changeRole(ctx, actor, userID, "organizer", a.admin.CreateOrganizerFromUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w, or is already an organizer or admin", ErrUserNotFound)
+	}
+	return err
+}
+
+func (a *AdminService) RemoveOrganizer(ctx context.Context, actor Actor, userID string) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	err := a.changeRole(ctx, actor, userID, "user", a.admin.RemoveOrganizer)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w, or is not an organizer", ErrUserNotFound)
+	}
+	return err
+}
+
+func (a *AdminService) ListEventOrganizers(ctx context.Context, actor Actor, eventID string) ([]*admin.EventOrganizer, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	return a.admin.ListEventOrganizers(ctx, eventID)
+}
+
+// AddEventOrganizer lets another organizer manage the event. Only admins and the event's
+// owner may add them.
+func (a *AdminService) AddEventOrganizer(ctx context.Context, actor Actor, eventID, userID string) error {
+	if err := a.authorizeEvent(ctx, actor, eventID, true); err != nil {
+		return err
+	}
+	event, err := a.events.Get(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		return ErrEventNotFound
+	}
+	user, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if user.Role != "organizer" {
+		return fmt.Errorf("%w: user must have the organizer role", ErrValidation)
+	}
+	err = a.admin.AddEventOrganizer(ctx, eventID, userID, admin.EventMember, actor.UserID,
+		a.audited(ctx, actor, ActionEventOrganizerAdd, audit.TargetEvent, eventID, nil, organizerSnapshot{UserID: userID, Role: admin.EventMember}))
+	if err != nil {
+		return err
+	}
+	a.log.Info("Event organizer added", zap.String("event_id", eventID), zap.String("user_id", userID), zap.String("by", actor.UserID))
+	return nil
+}
+
+// RemoveEventOrganizer takes a member's access to the event away. The owner stays.
+func (a *AdminService) RemoveEventOrganizer(ctx context.Context, actor Actor, eventID, userID string) error {
+	if err := a.authorizeEvent(ctx, actor, eventID, true); err != nil {
+		return err
+	}
+	err := a.admin.RemoveEventOrganizer(ctx, eventID, userID,
+		a.audited(ctx, actor, ActionEventOrganizerRemove, audit.TargetEvent, eventID, organizerSnapshot{UserID: userID, Role: admin.EventMember}, nil))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotEventOrganizer
+	}
+	if err == nil {
+		a.log.Info("Event organizer removed", zap.String("event_id", eventID), zap.String("user_id", userID), zap.String("by", actor.UserID))
+	}
+	return err
+}
+
+// organizerSnapshot is the audited state of an event organizer.
+type organizerSnapshot struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// roleSnapshot is the audited state of a role change.
+type roleSnapshot struct {
+	Role string `json:"role"`
+}
+
+// changeRole gives the user a new role through change and audits it in the same
+// transaction.
+func (a *AdminService) changeRole(ctx context.Context, actor Actor, userID, role string, change func(ctx context.Context, userID string, apply func(tx pgx.Tx, previous string) error) error) error {
+	return change(ctx, userID, func(tx pgx.Tx, previous string) error {
+		return a.recordTx(ctx, tx, actor, ActionUserRole, audit.TargetUser, userID, roleSnapshot{Role: previous}, roleSnapshot{Role: role})
+	})
+}
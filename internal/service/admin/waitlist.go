@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
+)
+
+// maxWaitlistPriority bounds rule priorities so they stay readable in the admin list.
+const maxWaitlistPriority = 100
+
+// WaitlistPriorities maps priority groups to their priority for one event. Groups left out
+// or set to 0 get no priority.
+type WaitlistPriorities struct {
+	Priorities map[string]int `json:"priorities" binding:"required"`
+}
+
+type WaitlistPrioritiesResult struct {
+	EventID  string                  `json:"event_id"`
+	Rules    []waitlist.PriorityRule `json:"rules"`
+	Reranked int64                   `json:"reranked"`
+}
+
+// UserWaitlistGroups are the priority groups an admin assigns to a user. Previous attendees
+// are recognised from their bookings.
+type UserWaitlistGroups struct {
+	Member             bool `json:"member"`
+	AccessibilityNeeds bool `json:"accessibility_needs"`
+}
+
+var ErrUserNotFound = errors.New("user not found")
+
+// ListWaitlist returns the event's waitlist in promotion order with each entry's priority
+// and priority group.
+func (a *AdminService) ListWaitlist(ctx context.Context, actor Actor, eventID string, limit, offset int) ([]*waitlist.WaitlistEntry, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	return a.waitlist.ListByEvent(ctx, eventID, limit, offset)
+}
+
+func (a *AdminService) GetWaitlistPriorities(ctx context.Context, actor Actor, eventID string) ([]waitlist.PriorityRule, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	return a.waitlist.PriorityRules(ctx, eventID)
+}
+
+// SetWaitlistPriorities replaces the event's priority rules; users already waiting are
+// re-ranked under the new rules.
+func (a *AdminService) SetWaitlistPriorities(ctx context.Context, actor Actor, eventID string, in WaitlistPriorities) (*WaitlistPrioritiesResult, error) {
+	if err := a.authorizeEvent(ctx, actor, eventID, false); err != nil {
+		return nil, err
+	}
+	event, err := a.events.Get(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, errors.New("event not found")
+	}
+
+	var rules []waitlist.PriorityRule
+	for group, priority := range in.Priorities {
+		switch group {
+		case waitlist.GroupMember, waitlist.GroupPreviousAttendee, waitlist.GroupAccessibility:
+		default:
+			return nil, fmt.Errorf("%w: unknown priority group %q", ErrValidation, group)
+		}
+		if priority < 0 || priority > maxWaitlistPriority {
+			return nil, fmt.Errorf("%w: priority of %s must be between 0 and %d", ErrValidation, group, maxWaitlistPriority)
+		}
+		if priority > 0 {
+			rules = append(rules, waitlist.PriorityRule{Group: group, Priority: priority})
+		}
+	}
+
+	var saved []waitlist.PriorityRule
+	n, err := a.waitlist.SetPriorityRules(ctx, eventID, rules, func(tx pgx.Tx, before, after []waitlist.PriorityRule) error {
+		saved = after
+		return a.recordTx(ctx, tx, actor, ActionEventWaitlistRules, audit.TargetEvent, eventID, before, after)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("event not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.log.Info("Waitlist priorities updated", zap.String("event_id", eventID), zap.Int64("reranked", n))
+	return &WaitlistPrioritiesResult{EventID: eventID, Rules: saved, Reranked: n}, nil
+}
+
+// SetUserWaitlistGroups assigns the user's priority groups and re-ranks their waitlist entries.
+func (a *AdminService) SetUserWaitlistGroups(ctx context.Context, actor Actor, userID string, in UserWaitlistGroups) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+	err := a.waitlist.SetUserGroups(ctx, userID, in.Member, in.AccessibilityNeeds, func(tx pgx.Tx, member, accessibilityNeeds bool) error {
+		return a.recordTx(ctx, tx, actor, ActionUserWaitlistGroups, audit.TargetUser, userID, UserWaitlistGroups{Member: member, AccessibilityNeeds: accessibilityNeeds}, in)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/apikeys"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+)
+
+const (
+	defaultRateLimit = 600
+	maxRateLimit     = 6000
+)
+
+var (
+	ErrValidation = errors.New("validation error")
+	ErrNotFound   = errors.New("API key not found")
+)
+
+type APIKeysService struct {
+	log   *zap.Logger
+	keys  *apikeys.APIKeysRepository
+	users *users.UsersRepository
+}
+
+func NewAPIKeysService(log *zap.Logger, keys *apikeys.APIKeysRepository, users *users.UsersRepository) *APIKeysService {
+	return &APIKeysService{log: log, keys: keys, users: users}
+}
+
+type CreateRequest struct {
+	Name string `json:"name" binding:"required"`
+	// UserID is who the key acts as, the creating admin if empty
+	UserID    string     `json:"user_id"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	RateLimit int        `json:"rate_limit"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedKey is a new key. Key is only ever returned here; afterwards only its hash is kept.
+type CreatedKey struct {
+	*apikeys.APIKey
+	Key string `json:"key"`
+}
+
+// Create issues a key acting as req.UserID. Only keys acting as admins or organizers may be
+// granted admin scopes; an organizer's key only sees their own events.
+func (s *APIKeysService) Create(ctx context.Context, createdBy string, req CreateRequest) (*CreatedKey, error) {
+	if req.UserID == "" {
+		req.UserID = createdBy
+	}
+	if req.RateLimit == 0 {
+		req.RateLimit = defaultRateLimit
+	}
+	if req.RateLimit < 0 || req.RateLimit > maxRateLimit {
+		return nil, fmt.Errorf("%w: rate_limit must be between 1 and %d requests per minute", ErrValidation, maxRateLimit)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrValidation)
+	}
+	scopes, err := validScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := s.users.GetByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return nil, fmt.Errorf("%w: unknown user", ErrValidation)
+	}
+	for _, scope := range scopes {
+		if strings.HasPrefix(scope, "admin:") && owner.Role != "admin" && owner.Role != "organizer" {
+			return nil, fmt.Errorf("%w: scope %s needs a key acting as an admin or organizer", ErrValidation, scope)
+		}
+	}
+
+	prefix, err := randomString(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	key := middleware.APIKeyPrefix + prefix + "_" + secret
+	k := &apikeys.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashKey(key),
+		UserID:    owner.ID,
+		Scopes:    scopes,
+		RateLimit: req.RateLimit,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: &createdBy,
+	}
+	if err := s.keys.Create(ctx, k); err != nil {
+		return nil, err
+	}
+	s.log.Info("API key created", zap.String("key_id", k.ID), zap.String("prefix", prefix), zap.String("user_id", owner.ID), zap.Strings("scopes", scopes))
+	return &CreatedKey{APIKey: k, Key: key}, nil
+}
+
+func (s *APIKeysService) List(ctx context.Context, limit, offset int) ([]*apikeys.APIKey, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.keys.List(ctx, limit, offset)
+}
+
+func (s *APIKeysService) Revoke(ctx context.Context, id string) error {
+	err := s.keys.Revoke(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err == nil {
+		s.log.Info("API key revoked", zap.String("key_id", id))
+	}
+	return err
+}
+
+// Authenticate implements middleware.APIKeys.
+func (s *APIKeysService) Authenticate(ctx context.Context, key string) (*middleware.APIKeyPrincipal, error) {
+	rest, ok := strings.CutPrefix(key, middleware.APIKeyPrefix)
+	if !ok {
+		return nil, nil
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil
+	}
+	k, err := s.keys.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil || subtle.ConstantTimeCompare([]byte(hashKey(key)), []byte(k.KeyHash)) != 1 || !k.Active(time.Now()) {
+		return nil, nil
+	}
+	if err := s.keys.TouchLastUsed(ctx, k.ID); err != nil {
+		s.log.Error("Failed to record API key use", zap.Error(err), zap.String("key_id", k.ID))
+	}
+	return &middleware.APIKeyPrincipal{
+		KeyID:     k.ID,
+		Prefix:    k.Prefix,
+		UserID:    k.UserID,
+		Scopes:    k.Scopes,
+		RateLimit: k.RateLimit,
+	}, nil
+}
+
+// validScopes checks scopes against the known ones and drops duplicates.
+func validScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrValidation)
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		known := false
+		for _, s := range middleware.Scopes {
+			known = known || s == scope
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrValidation, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
+
+// randomString returns n random bytes, hex encoded so the key's parts can be split on "_".
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
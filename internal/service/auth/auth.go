@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,18 +12,32 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
-	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/oidc"
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/sessions"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
 )
 
 type AuthService struct {
-	log    *zap.Logger
-	users  *users.UsersRepository
-	redis  *redisx.TokenBucket
-	secret string
-	mailer *mailer.MailerService
+	log        *zap.Logger
+	users      *users.UsersRepository
+	redis      *redisx.TokenBucket
+	sessions   *sessions.SessionsRepository
+	revoked    *redisx.TokenDenylist
+	secret     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	oauth      map[string]*oidc.Provider
+	// publicURL is where the links mailed to users point
+	publicURL    string
+	verifySecret string
+	// twoFactorKey encrypts TOTP secrets at rest
+	twoFactorKey string
+	// Failed logins and OTP guesses lock out the account and the client address
+	accountLimiter *redisx.FailureLimiter
+	ipLimiter      *redisx.FailureLimiter
+	mailer         *mailer.MailerService
 }
 
 type SignupRequest struct {
@@ -37,10 +52,15 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// LoginResponse carries a short-lived access token and the refresh token that renews it.
 type LoginResponse struct {
-	Token   string    `json:"token"`
-	User    UserInfo  `json:"user"`
-	Expires time.Time `json:"expires"`
+	Token          string    `json:"token"`
+	RefreshToken   string    `json:"refresh_token"`
+	User           UserInfo  `json:"user"`
+	Expires        time.Time `json:"expires"`
+	RefreshExpires time.Time `json:"refresh_expires"`
+	// RecoveryCodes is only set when the sign-in completed 2FA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 type UserInfo struct {
@@ -49,6 +69,8 @@ type UserInfo struct {
 	Email string `json:"email"`
 	Phone string `json:"phone"`
 	Role  string `json:"role"`
+	// EmailVerified gates booking and joining waitlists
+	EmailVerified bool `json:"email_verified"`
 }
 
 type PasswordChangeRequest struct {
@@ -74,13 +96,28 @@ var (
 	ErrOAuthUser          = errors.New("password change not allowed for OAuth users")
 )
 
-func NewAuthService(log *zap.Logger, users *users.UsersRepository, redis *redisx.TokenBucket, secret string, mailer *mailer.MailerService) *AuthService {
+func NewAuthService(log *zap.Logger, users *users.UsersRepository, redis *redisx.TokenBucket, sessions *sessions.SessionsRepository, revoked *redisx.TokenDenylist, secret string, accessTTL, refreshTTL time.Duration, oauth []*oidc.Provider, publicURL, verifySecret, twoFactorKey string, mailer *mailer.MailerService) *AuthService {
+	providers := make(map[string]*oidc.Provider, len(oauth))
+	for _, p := range oauth {
+		providers[p.Name()] = p
+	}
+	accountLimiter, ipLimiter := newLimiters(redis)
 	return &AuthService{
-		log:    log,
-		users:  users,
-		redis:  redis,
-		secret: secret,
-		mailer: mailer,
+		log:            log,
+		users:          users,
+		redis:          redis,
+		sessions:       sessions,
+		revoked:        revoked,
+		secret:         secret,
+		accessTTL:      accessTTL,
+		refreshTTL:     refreshTTL,
+		oauth:          providers,
+		publicURL:      publicURL,
+		verifySecret:   verifySecret,
+		twoFactorKey:   twoFactorKey,
+		accountLimiter: accountLimiter,
+		ipLimiter:      ipLimiter,
+		mailer:         mailer,
 	}
 }
 
@@ -113,51 +150,51 @@ func (s *AuthService) Signup(ctx context.Context, req SignupRequest) (*LoginResp
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Generate token
-	token, expires, err := s.generateToken(user.ID, user.Role == "admin")
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	// The account works without it; the user can ask for the link again
+	if err := s.sendVerification(user); err != nil {
+		s.log.Error("Failed to send verification email", zap.Error(err), zap.String("user_id", user.ID))
 	}
 
-	return &LoginResponse{
-		Token:   token,
-		User:    s.userToInfo(user),
-		Expires: expires,
-	}, nil
+	return s.startSession(ctx, user)
 }
 
-func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
+// Login checks the password and signs the user in, or returns a challenge when they must
+// also present a second factor. Failures count towards locking out the account and ip.
+func (s *AuthService) Login(ctx context.Context, req LoginRequest, ip string) (*LoginResponse, *TwoFactorChallenge, error) {
+	if err := s.checkLocked(ctx, req.Email, ip); err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.users.GetByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
 	}
 
 	if user == nil {
-		return nil, ErrUserNotFound
+		s.recordFailure(ctx, req.Email, ip)
+		return nil, nil, ErrUserNotFound
 	}
 
 	// Check if user has password (not OAuth user)
 	if user.PasswordHash == "" {
-		return nil, ErrInvalidCredentials
+		s.recordFailure(ctx, req.Email, ip)
+		return nil, nil, ErrInvalidCredentials
 	}
 
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		s.recordFailure(ctx, req.Email, ip)
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// Generate token
-	token, expires, err := s.generateToken(user.ID, user.Role == "admin")
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	// A user asked for a second factor has not logged in yet; VerifyTwoFactor resets the
+	// count once they have
+	resp, challenge, err := s.completeLogin(ctx, user)
+	if err == nil && challenge == nil {
+		s.resetFailures(ctx, req.Email)
 	}
-
-	return &LoginResponse{
-		Token:   token,
-		User:    s.userToInfo(user),
-		Expires: expires,
-	}, nil
+	return resp, challenge, err
 }
 
 func (s *AuthService) ChangePassword(ctx context.Context, userID string, req PasswordChangeRequest) error {
@@ -209,6 +246,7 @@ func (s *AuthService) RequestPasswordChangeOTP(ctx context.Context, req OTPReque
 	if err != nil {
 		return fmt.Errorf("failed to store OTP: %w", err)
 	}
+	s.redis.GetClient().Del(ctx, otpAttemptsKey(req.Email))
 
 	// Send OTP via email
 	err = s.mailer.SendPasswordChangeOTPEmail(req.Email, otp)
@@ -220,15 +258,25 @@ func (s *AuthService) RequestPasswordChangeOTP(ctx context.Context, req OTPReque
 	return nil
 }
 
-func (s *AuthService) VerifyPasswordChangeOTP(ctx context.Context, req OTPVerifyRequest) error {
+// VerifyPasswordChangeOTP sets a new password given the OTP mailed to the user. Wrong
+// guesses count towards locking out the account and ip, and the OTP is discarded after
+// otpAttempts of them.
+func (s *AuthService) VerifyPasswordChangeOTP(ctx context.Context, req OTPVerifyRequest, ip string) error {
+	if err := s.checkLocked(ctx, req.Email, ip); err != nil {
+		return err
+	}
+
 	// Verify OTP
 	key := fmt.Sprintf("password_change_otp:%s", req.Email)
 	storedOTP, err := s.redis.GetClient().Get(ctx, key).Result()
 	if err != nil {
+		s.recordFailure(ctx, req.Email, ip)
 		return ErrInvalidOTP
 	}
 
-	if storedOTP != req.OTP {
+	if subtle.ConstantTimeCompare([]byte(storedOTP), []byte(req.OTP)) != 1 {
+		s.recordFailure(ctx, req.Email, ip)
+		s.countOTPFailure(ctx, req.Email, key)
 		return ErrInvalidOTP
 	}
 
@@ -256,11 +304,37 @@ func (s *AuthService) VerifyPasswordChangeOTP(ctx context.Context, req OTPVerify
 	}
 
 	// Delete OTP
-	s.redis.GetClient().Del(ctx, key)
+	s.redis.GetClient().Del(ctx, key, otpAttemptsKey(req.Email))
+
+	// Proving control of the mailbox lifts a lockout of the account
+	if err := s.accountLimiter.Unlock(ctx, accountKey(req.Email)); err != nil {
+		s.log.Error("Failed to lift lockout", zap.Error(err))
+	}
 
 	return nil
 }
 
+// countOTPFailure discards the OTP once it has been guessed wrong otpAttempts times.
+func (s *AuthService) countOTPFailure(ctx context.Context, email, otpKey string) {
+	client := s.redis.GetClient()
+	n, err := client.Incr(ctx, otpAttemptsKey(email)).Result()
+	if err != nil {
+		s.log.Error("Failed to count OTP attempt", zap.Error(err))
+		return
+	}
+	if n == 1 {
+		client.Expire(ctx, otpAttemptsKey(email), 15*time.Minute)
+	}
+	if n >= otpAttempts {
+		client.Del(ctx, otpKey, otpAttemptsKey(email))
+		s.log.Warn("Password change OTP discarded after failed attempts", zap.String("email", email))
+	}
+}
+
+func otpAttemptsKey(email string) string {
+	return fmt.Sprintf("password_change_otp_attempts:%s", email)
+}
+
 func (s *AuthService) GetProfile(ctx context.Context, userID string) (*UserInfo, error) {
 	user, err := s.users.GetByID(ctx, userID)
 	if err != nil {
@@ -271,13 +345,8 @@ func (s *AuthService) GetProfile(ctx context.Context, userID string) (*UserInfo,
 		return nil, ErrUserNotFound
 	}
 
-	return &UserInfo{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
-		Phone: user.Phone,
-		Role:  user.Role,
-	}, nil
+	info := s.userToInfo(user)
+	return &info, nil
 }
 
 func (s *AuthService) UpdateProfile(ctx context.Context, userID string, name, phone string) error {
@@ -292,15 +361,6 @@ func (s *AuthService) UpdateProfile(ctx context.Context, userID string, name, ph
 	return s.users.UpdateProfile(ctx, userID, name, phone)
 }
 
-func (s *AuthService) generateToken(userID string, isAdmin bool) (string, time.Time, error) {
-	expires := time.Now().Add(24 * time.Hour)
-	token, err := jwtMiddleware.Issue(s.secret, userID, isAdmin, 24*time.Hour)
-	if err != nil {
-		return "", time.Time{}, err
-	}
-	return token, expires, nil
-}
-
 func (s *AuthService) generateOTP() string {
 	bytes := make([]byte, 3)
 	rand.Read(bytes)
@@ -309,10 +369,11 @@ func (s *AuthService) generateOTP() string {
 
 func (s *AuthService) userToInfo(user *users.User) UserInfo {
 	return UserInfo{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
-		Phone: user.Phone,
-		Role:  user.Role,
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt != nil,
 	}
 }
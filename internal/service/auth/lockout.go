@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+)
+
+const (
+	// An account is locked after 5 failures in 15 minutes and an address after 20, for a
+	// minute at first and twice as long for every further lockout that day, up to an hour.
+	accountFailureThreshold = 5
+	ipFailureThreshold      = 20
+	failureWindow           = 15 * time.Minute
+	lockoutBase             = time.Minute
+	lockoutMax              = time.Hour
+	lockoutMemory           = 24 * time.Hour
+
+	// otpAttempts is how many wrong guesses a password change OTP survives
+	otpAttempts = 5
+)
+
+// LockedError is returned while an account or address is locked out after repeated
+// failed attempts.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+func newLimiters(tokens *redisx.TokenBucket) (account, ip *redisx.FailureLimiter) {
+	account = redisx.NewFailureLimiter(tokens.GetClient(), "account", accountFailureThreshold, failureWindow, lockoutBase, lockoutMax, lockoutMemory)
+	ip = redisx.NewFailureLimiter(tokens.GetClient(), "ip", ipFailureThreshold, failureWindow, lockoutBase, lockoutMax, lockoutMemory)
+	return account, ip
+}
+
+// checkLocked returns a LockedError if the account or the address is locked out. Like the
+// rate limiter, it lets requests through when Redis is unavailable.
+func (s *AuthService) checkLocked(ctx context.Context, email, ip string) error {
+	var wait time.Duration
+	for _, check := range []struct {
+		limiter *redisx.FailureLimiter
+		key     string
+	}{{s.accountLimiter, accountKey(email)}, {s.ipLimiter, ip}} {
+		d, err := check.limiter.Locked(ctx, check.key)
+		if err != nil {
+			s.log.Error("Failed to check lockout", zap.Error(err))
+			return nil
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt against the account and the address, and tells
+// the account owner when it gets locked.
+func (s *AuthService) recordFailure(ctx context.Context, email, ip string) {
+	if _, err := s.ipLimiter.Fail(ctx, ip); err != nil {
+		s.log.Error("Failed to record failed attempt", zap.Error(err))
+	}
+	locked, err := s.accountLimiter.Fail(ctx, accountKey(email))
+	if err != nil {
+		s.log.Error("Failed to record failed attempt", zap.Error(err))
+		return
+	}
+	if locked == 0 {
+		return
+	}
+
+	s.log.Warn("Account locked after failed attempts", zap.String("email", email), zap.String("ip", ip), zap.Duration("for", locked))
+	user, err := s.users.GetByEmail(ctx, email)
+	if err != nil || user == nil {
+		return
+	}
+	if err := s.mailer.SendAccountLockedEmail(user.Email, time.Now().Add(locked)); err != nil {
+		s.log.Error("Failed to send account locked email", zap.Error(err))
+	}
+}
+
+func (s *AuthService) resetFailures(ctx context.Context, email string) {
+	if err := s.accountLimiter.Reset(ctx, accountKey(email)); err != nil {
+		s.log.Error("Failed to reset failed attempts", zap.Error(err))
+	}
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/oidc"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+)
+
+// oauthStateTTL bounds how long a user may take at the provider's login page.
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider      = errors.New("unknown OAuth provider")
+	ErrInvalidOAuthState    = errors.New("invalid or expired OAuth state")
+	ErrOAuthFailed          = errors.New("OAuth login failed")
+	ErrOAuthEmailUnverified = errors.New("provider did not verify the email address")
+	// ErrOAuthAccountLinked means the email belongs to an account already linked to another
+	// external identity.
+	ErrOAuthAccountLinked = errors.New("account is linked to another identity")
+	// ErrOAuthAccountUnverified means the email belongs to an account that never verified it.
+	// Anyone could have registered that account, so it is not linked automatically.
+	ErrOAuthAccountUnverified = errors.New("account email is not verified; verify it before signing in with this provider")
+)
+
+// oauthState is what a login started by StartOAuth needs to finish, kept in Redis under
+// the state parameter.
+type oauthState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// StartOAuth begins an authorization code login with the provider and returns the URL to
+// send the user to.
+func (s *AuthService) StartOAuth(ctx context.Context, provider string) (string, error) {
+	p, ok := s.oauth[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	state, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	st := oauthState{Provider: provider}
+	if st.Verifier, err = randomToken(32); err != nil {
+		return "", err
+	}
+	if st.Nonce, err = randomToken(16); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.GetClient().Set(ctx, oauthStateKey(state), raw, oauthStateTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store OAuth state: %w", err)
+	}
+
+	url, err := p.AuthCodeURL(ctx, state, st.Nonce, st.Verifier)
+	if err != nil {
+		s.log.Error("OAuth provider unavailable", zap.String("provider", provider), zap.Error(err))
+		return "", fmt.Errorf("%w: %v", ErrOAuthFailed, err)
+	}
+	return url, nil
+}
+
+// CompleteOAuth redeems the code the provider sent back and signs the user in, or returns a
+// 2FA challenge like Login. A known identity signs in to its account; otherwise an account
+// with the same email is linked to it if both sides verified the address, or a new account
+// is created.
+func (s *AuthService) CompleteOAuth(ctx context.Context, provider, code, state string) (*LoginResponse, *TwoFactorChallenge, error) {
+	p, ok := s.oauth[provider]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+	// A state is good for one attempt
+	raw, err := s.redis.GetClient().GetDel(ctx, oauthStateKey(state)).Bytes()
+	if err != nil {
+		return nil, nil, ErrInvalidOAuthState
+	}
+	var st oauthState
+	if err := json.Unmarshal(raw, &st); err != nil || st.Provider != provider {
+		return nil, nil, ErrInvalidOAuthState
+	}
+
+	identity, err := p.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		s.log.Warn("OAuth code exchange failed", zap.String("provider", provider), zap.Error(err))
+		return nil, nil, fmt.Errorf("%w: %v", ErrOAuthFailed, err)
+	}
+
+	user, err := s.oauthUser(ctx, provider, identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.completeLogin(ctx, user)
+}
+
+func (s *AuthService) oauthUser(ctx context.Context, provider string, id *oidc.Identity) (*users.User, error) {
+	user, err := s.users.GetByOAuth(ctx, provider, id.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	// Linking by email is only safe when the provider vouches for the address
+	if id.Email == "" || !id.EmailVerified {
+		return nil, ErrOAuthEmailUnverified
+	}
+	user, err = s.users.GetByEmail(ctx, id.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		// A password set by whoever registered the address first must not survive the link
+		if user.EmailVerifiedAt == nil {
+			return nil, ErrOAuthAccountUnverified
+		}
+		err := s.users.LinkOAuth(ctx, user.ID, provider, id.Subject)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOAuthAccountLinked
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to link account: %w", err)
+		}
+		s.log.Info("Linked OAuth identity", zap.String("user_id", user.ID), zap.String("provider", provider))
+		user.OAuthProvider, user.OAuthSub = provider, id.Subject
+		return user, nil
+	}
+
+	now := time.Now()
+	user, err = s.users.Create(ctx, &users.User{
+		Name:            id.Name,
+		Email:           id.Email,
+		OAuthProvider:   provider,
+		OAuthSub:        id.Subject,
+		Role:            "user",
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func oauthStateKey(state string) string {
+	return "oauth_state:" + state
+}
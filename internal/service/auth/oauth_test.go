@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/oidc"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+)
+
+// testService connects to the migrated database in TEST_POSTGRES_URL, or skips the test.
+// Only what oauthUser needs is set up.
+func testService(t *testing.T) (*AuthService, *store.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	db, err := store.NewDB(context.Background(), url, 5)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	log := zap.NewNop()
+	return &AuthService{log: log, users: users.NewUsersRepository(db, log)}, db
+}
+
+// testUser creates a password account; the row is deleted when the test ends.
+func testUser(t *testing.T, svc *AuthService, db *store.DB, verified bool) *users.User {
+	t.Helper()
+	u := &users.User{
+		Name:         "OAuth test",
+		Email:        "oauth-" + time.Now().Format("150405.000000000") + "@example.com",
+		PasswordHash: "hash",
+		Role:         "user",
+	}
+	if verified {
+		now := time.Now()
+		u.EmailVerifiedAt = &now
+	}
+	u, err := svc.users.Create(context.Background(), u)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, u.ID)
+	})
+	return u
+}
+
+func TestOAuthDoesNotLinkUnverifiedAccount(t *testing.T) {
+	svc, db := testService(t)
+	ctx := context.Background()
+	victim := testUser(t, svc, db, false)
+
+	_, err := svc.oauthUser(ctx, "google", &oidc.Identity{Subject: "sub-" + victim.ID, Email: victim.Email, EmailVerified: true})
+	if !errors.Is(err, ErrOAuthAccountUnverified) {
+		t.Fatalf("oauthUser err = %v, want ErrOAuthAccountUnverified", err)
+	}
+
+	got, err := svc.users.GetByID(ctx, victim.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if got.OAuthSub != "" || got.EmailVerifiedAt != nil {
+		t.Fatalf("unverified account was changed: oauth_sub %q, email_verified_at %v", got.OAuthSub, got.EmailVerifiedAt)
+	}
+}
+
+func TestOAuthLinksVerifiedAccount(t *testing.T) {
+	svc, db := testService(t)
+	ctx := context.Background()
+	owner := testUser(t, svc, db, true)
+
+	user, err := svc.oauthUser(ctx, "google", &oidc.Identity{Subject: "sub-" + owner.ID, Email: owner.Email, EmailVerified: true})
+	if err != nil {
+		t.Fatalf("oauthUser: %v", err)
+	}
+	if user.ID != owner.ID || user.OAuthSub != "sub-"+owner.ID {
+		t.Fatalf("oauthUser = %s linked to %q, want %s linked", user.ID, user.OAuthSub, owner.ID)
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	jwtMiddleware "github.com/samirwankhede/lewly-pgpyewj/internal/middleware"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/sessions"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// startSession signs the user in with a new refresh token family.
+func (s *AuthService) startSession(ctx context.Context, user *users.User) (*LoginResponse, error) {
+	refresh, next, err := s.newRefreshToken(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Create(ctx, next); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return s.sessionResponse(user, refresh, next)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token; the
+// old one stops working. Presenting an already exchanged token signs out its whole family,
+// as it means the token leaked.
+func (s *AuthService) Refresh(ctx context.Context, req RefreshRequest) (*LoginResponse, error) {
+	refresh, next, err := s.newRefreshToken("")
+	if err != nil {
+		return nil, err
+	}
+	grants, err := s.sessions.Rotate(ctx, hashToken(req.RefreshToken), next)
+	if errors.Is(err, sessions.ErrTokenReused) {
+		s.log.Warn("Refresh token reused, session family revoked", zap.String("user_id", next.UserID))
+		s.denylist(ctx, grants)
+		return nil, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, sessions.ErrInvalidToken) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, next.UserID)
+	if err != nil || user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	// Sessions of admins without 2FA, such as users promoted since they signed in, must
+	// sign in again and enroll
+	if user.Role == "admin" {
+		tf, err := s.users.GetTwoFactor(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if tf == nil || tf.EnabledAt == nil {
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+	return s.sessionResponse(user, refresh, next)
+}
+
+// Logout revokes the refresh token's family and the access token presented with it. Either
+// may be empty.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, access *jwtMiddleware.Claims) error {
+	if refreshToken != "" {
+		grants, err := s.sessions.RevokeByHash(ctx, hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		s.denylist(ctx, grants)
+	}
+	if access != nil && access.ExpiresAt != nil {
+		s.denylist(ctx, []sessions.AccessGrant{{JTI: access.ID, ExpiresAt: access.ExpiresAt.Time}})
+	}
+	return nil
+}
+
+// RevokeSessions signs the user out everywhere: every refresh token family is revoked and
+// the access tokens issued with them are denylisted.
+func (s *AuthService) RevokeSessions(ctx context.Context, userID string) (int, error) {
+	grants, err := s.sessions.RevokeUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	s.denylist(ctx, grants)
+	s.log.Info("Sessions revoked", zap.String("user_id", userID), zap.Int("access_tokens", len(grants)))
+	return len(grants), nil
+}
+
+func (s *AuthService) denylist(ctx context.Context, grants []sessions.AccessGrant) {
+	for _, g := range grants {
+		if err := s.revoked.Revoke(ctx, g.JTI, g.ExpiresAt); err != nil {
+			s.log.Error("Failed to denylist access token", zap.Error(err), zap.String("jti", g.JTI))
+		}
+	}
+}
+
+// newRefreshToken returns a new random refresh token and the row to store for it.
+func (s *AuthService) newRefreshToken(userID string) (string, *sessions.RefreshToken, error) {
+	refresh, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	return refresh, &sessions.RefreshToken{
+		UserID:          userID,
+		TokenHash:       hashToken(refresh),
+		AccessJTI:       jti,
+		AccessExpiresAt: now.Add(s.accessTTL),
+		ExpiresAt:       now.Add(s.refreshTTL),
+	}, nil
+}
+
+func (s *AuthService) sessionResponse(user *users.User, refresh string, t *sessions.RefreshToken) (*LoginResponse, error) {
+	token, err := jwtMiddleware.Issue(s.secret, user.ID, user.Role == "admin", t.AccessJTI, time.Until(t.AccessExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	return &LoginResponse{
+		Token:          token,
+		RefreshToken:   refresh,
+		User:           s.userToInfo(user),
+		Expires:        t.AccessExpiresAt,
+		RefreshExpires: t.ExpiresAt,
+	}, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/totp"
+)
+
+const (
+	totpIssuer        = "Evently"
+	challengeTTL      = 5 * time.Minute
+	challengeAttempts = 5
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidChallenge     = errors.New("invalid or expired 2FA challenge")
+	ErrInvalidTwoFactorCode = errors.New("invalid 2FA code")
+	ErrTwoFactorEnabled     = errors.New("2FA is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("2FA is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("start 2FA enrollment first")
+	ErrTwoFactorMandatory   = errors.New("2FA cannot be disabled for admins")
+)
+
+// TwoFactorChallenge is returned by Login instead of tokens when the user must also present
+// a second factor, which they exchange for tokens with VerifyTwoFactor.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	Expires           time.Time `json:"expires"`
+	// EnrollmentRequired is set for admins who have not set up 2FA yet; they enroll with the
+	// challenge token and verify their first code to sign in.
+	EnrollmentRequired bool `json:"enrollment_required"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	// Code is a code from the authenticator app or an unused recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Enrollment is a new TOTP secret to add to an authenticator app, by hand or by scanning
+// the provisioning URI as a QR code.
+type Enrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// completeLogin signs in a user whose password or identity was checked, or returns a
+// challenge when they have 2FA enabled or are an admin, for whom it is mandatory.
+func (s *AuthService) completeLogin(ctx context.Context, user *users.User) (*LoginResponse, *TwoFactorChallenge, error) {
+	tf, err := s.users.GetTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	enabled := tf != nil && tf.EnabledAt != nil
+	if !enabled && user.Role != "admin" {
+		resp, err := s.startSession(ctx, user)
+		return resp, nil, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.redis.GetClient().Set(ctx, challengeKey(token), user.ID, challengeTTL).Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to store 2FA challenge: %w", err)
+	}
+	return nil, &TwoFactorChallenge{
+		TwoFactorRequired:  true,
+		ChallengeToken:     token,
+		Expires:            time.Now().Add(challengeTTL),
+		EnrollmentRequired: !enabled,
+	}, nil
+}
+
+// VerifyTwoFactor exchanges a login challenge and a second factor for tokens. For an admin
+// completing mandatory enrollment the code confirms the new secret, and the response
+// carries their recovery codes. Wrong codes count towards locking out the account and ip
+// like wrong passwords, and the count is only reset once the login succeeds.
+func (s *AuthService) VerifyTwoFactor(ctx context.Context, req TwoFactorVerifyRequest, ip string) (*LoginResponse, error) {
+	userID, err := s.challengeUser(ctx, req.ChallengeToken, true)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return nil, ErrInvalidChallenge
+	}
+	if err := s.checkLocked(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+	tf, err := s.users.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	if tf == nil || tf.EnabledAt == nil {
+		recoveryCodes, err = s.enable(ctx, userID, tf, req.Code)
+	} else {
+		err = s.checkSecondFactor(ctx, userID, tf, req.Code)
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.recordFailure(ctx, user.Email, ip)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.redis.GetClient().Del(ctx, challengeKey(req.ChallengeToken), challengeAttemptsKey(req.ChallengeToken))
+	s.resetFailures(ctx, user.Email)
+	resp, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// EnrollWithChallenge starts enrollment for an admin who was asked to set up 2FA at login.
+func (s *AuthService) EnrollWithChallenge(ctx context.Context, challengeToken string) (*Enrollment, error) {
+	userID, err := s.challengeUser(ctx, challengeToken, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnrollTwoFactor(ctx, userID)
+}
+
+// EnrollTwoFactor generates a new secret for the user. 2FA is enabled once a first code
+// from it is confirmed; until then the previous state, if any, is unchanged.
+func (s *AuthService) EnrollTwoFactor(ctx context.Context, userID string) (*Enrollment, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return nil, ErrUserNotFound
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	err = s.users.SetPendingTOTP(ctx, userID, sealed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Enrollment{Secret: secret, ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Email, secret)}, nil
+}
+
+// EnableTwoFactor confirms enrollment with a code from the new secret and returns the
+// recovery codes, which are shown only this once.
+func (s *AuthService) EnableTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+	tf, err := s.users.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrUserNotFound
+	}
+	if tf.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	return s.enable(ctx, userID, tf, code)
+}
+
+// DisableTwoFactor turns 2FA off after checking a second factor. Admins cannot turn it off.
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID, code string) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return ErrUserNotFound
+	}
+	if user.Role == "admin" {
+		return ErrTwoFactorMandatory
+	}
+	tf, err := s.users.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf == nil || tf.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.checkSecondFactor(ctx, userID, tf, code); err != nil {
+		return err
+	}
+	return s.users.DisableTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a second factor.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	tf, err := s.users.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || tf.EnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.checkSecondFactor(ctx, userID, tf, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *AuthService) TwoFactorStatus(ctx context.Context, userID string) (*TwoFactorStatus, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return nil, ErrUserNotFound
+	}
+	tf, err := s.users.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Enabled: tf != nil && tf.EnabledAt != nil, Required: user.Role == "admin"}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.users.RemainingRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// enable checks a code from the pending secret and turns 2FA on with new recovery codes.
+func (s *AuthService) enable(ctx context.Context, userID string, tf *users.TwoFactor, code string) ([]string, error) {
+	if tf == nil || tf.Secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err := s.checkTOTP(ctx, userID, tf, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.users.EnableTOTP(ctx, userID, hashes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("2FA enabled", zap.String("user_id", userID))
+	return codes, nil
+}
+
+// checkSecondFactor accepts a current TOTP code or spends a recovery code.
+func (s *AuthService) checkSecondFactor(ctx context.Context, userID string, tf *users.TwoFactor, code string) error {
+	err := s.checkTOTP(ctx, userID, tf, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+	used, err := s.users.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	s.log.Info("Recovery code used", zap.String("user_id", userID))
+	return nil
+}
+
+// checkTOTP validates a code and records its time step so it cannot be used again.
+func (s *AuthService) checkTOTP(ctx context.Context, userID string, tf *users.TwoFactor, code string) error {
+	secret, err := s.openSecret(tf.Secret)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	fresh, err := s.users.UseTOTPStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// challengeUser returns the user a login challenge was issued to. Verification attempts
+// are counted, and the challenge is dropped once they run out.
+func (s *AuthService) challengeUser(ctx context.Context, token string, attempt bool) (string, error) {
+	client := s.redis.GetClient()
+	userID, err := client.Get(ctx, challengeKey(token)).Result()
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+	if !attempt {
+		return userID, nil
+	}
+	n, err := client.Incr(ctx, challengeAttemptsKey(token)).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to count 2FA attempts: %w", err)
+	}
+	if n == 1 {
+		client.Expire(ctx, challengeAttemptsKey(token), challengeTTL)
+	}
+	if n > challengeAttempts {
+		client.Del(ctx, challengeKey(token))
+		return "", ErrInvalidChallenge
+	}
+	return userID, nil
+}
+
+// sealSecret encrypts a TOTP secret for storage with AES-GCM.
+func (s *AuthService) sealSecret(secret string) (string, error) {
+	gcm, err := s.twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *AuthService) openSecret(sealed string) (string, error) {
+	gcm, err := s.twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", errors.New("malformed TOTP secret")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (s *AuthService) twoFactorCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(s.twoFactorKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newRecoveryCodes returns fresh recovery codes, formatted for display, and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(enc.EncodeToString(b))
+		codes[i] = c[0:4] + "-" + c[4:8] + "-" + c[8:12] + "-" + c[12:16]
+		hashes[i] = hashToken(c)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func challengeKey(token string) string {
+	return "2fa_challenge:" + hashToken(token)
+}
+
+func challengeAttemptsKey(token string) string {
+	return "2fa_challenge_attempts:" + hashToken(token)
+}
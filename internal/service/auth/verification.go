@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+)
+
+const (
+	verificationLinkTTL = 24 * time.Hour
+	// A user may ask for a new link once a minute and five times an hour
+	resendCooldown  = time.Minute
+	resendPerHour   = 5
+	resendWindowTTL = time.Hour
+)
+
+var (
+	ErrEmailAlreadyVerified    = errors.New("email is already verified")
+	ErrInvalidVerificationLink = errors.New("invalid verification link")
+	ErrVerificationLinkExpired = errors.New("verification link has expired, request a new one")
+	ErrResendRateLimited       = errors.New("too many verification emails requested, try again later")
+)
+
+// sendVerification mails the user a signed link that verifies their current email.
+func (s *AuthService) sendVerification(user *users.User) error {
+	expires := time.Now().Add(verificationLinkTTL)
+	q := url.Values{}
+	q.Set("uid", user.ID)
+	q.Set("email", user.Email)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", s.verificationSignature(user.ID, user.Email, q.Get("expires")))
+	link := fmt.Sprintf("%s/v1/auth/verify-email?%s", s.publicURL, q.Encode())
+	return s.mailer.SendEmailVerificationEmail(user.Email, link, expires)
+}
+
+// VerifyEmail checks the query of a verification link and marks the email verified.
+func (s *AuthService) VerifyEmail(ctx context.Context, q url.Values) error {
+	userID, email, expires := q.Get("uid"), q.Get("email"), q.Get("expires")
+	want := s.verificationSignature(userID, email, expires)
+	if userID == "" || !hmac.Equal([]byte(q.Get("sig")), []byte(want)) {
+		return ErrInvalidVerificationLink
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidVerificationLink
+	}
+	if !time.Now().Before(time.Unix(unix, 0)) {
+		return ErrVerificationLinkExpired
+	}
+
+	err = s.users.MarkEmailVerified(ctx, userID, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidVerificationLink
+	}
+	if err != nil {
+		return err
+	}
+	s.log.Info("Email verified", zap.String("user_id", userID))
+	return nil
+}
+
+// ResendVerification mails the user a new verification link, subject to the resend limits.
+func (s *AuthService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return ErrUserNotFound
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	client := s.redis.GetClient()
+	ok, err := client.SetNX(ctx, "email_verify_cooldown:"+userID, 1, resendCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check resend limit: %w", err)
+	}
+	if !ok {
+		return ErrResendRateLimited
+	}
+	countKey := "email_verify_resends:" + userID
+	n, err := client.Incr(ctx, countKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check resend limit: %w", err)
+	}
+	if n == 1 {
+		client.Expire(ctx, countKey, resendWindowTTL)
+	}
+	if n > resendPerHour {
+		return ErrResendRateLimited
+	}
+
+	return s.sendVerification(user)
+}
+
+func (s *AuthService) verificationSignature(userID, email, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.verifySecret))
+	mac.Write([]byte(userID + "|" + email + "|" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
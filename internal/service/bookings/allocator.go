@@ -0,0 +1,142 @@
+package bookings
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// bestAvailableAttempts bounds how often CreateBestAvailable re-picks seats after losing a race.
+const bestAvailableAttempts = 3
+
+// seatLabelPattern splits labels like "A12", "A-12" or "AA 7" into a row and a seat number.
+// Labels generated from a venue seat map carry a section prefix, e.g. "Stalls-A12"; seats
+// in the same row of different sections are kept apart.
+var seatLabelPattern = regexp.MustCompile(`^(?:(.+)-)?([A-Za-z]+)[-_ ]?(\d+)$`)
+
+type seatPosition struct {
+	label  string
+	row    string
+	number int
+}
+
+// parseSeatLabel extracts the row and seat number from a label. Labels that do not follow
+// the row+number convention are treated as an unnamed row numbered by their position in
+// the input, so they can still be allocated.
+func parseSeatLabel(label string, fallback int) seatPosition {
+	m := seatLabelPattern.FindStringSubmatch(label)
+	if m == nil {
+		return seatPosition{label: label, number: fallback}
+	}
+	n, err := strconv.Atoi(m[3])
+	if err != nil {
+		return seatPosition{label: label, number: fallback}
+	}
+	row := m[2]
+	if m[1] != "" {
+		row = m[1] + "-" + row
+	}
+	return seatPosition{label: label, row: row, number: n}
+}
+
+// BestAvailable picks n seats from the available labels. It prefers n consecutive seats
+// in one row (earliest row first, then lowest seat number). Failing that it takes the
+// tightest group of n seats in a single row, and finally spreads over the fewest
+// neighbouring rows. It returns false when fewer than n seats are available.
+func BestAvailable(available []string, n int) ([]string, bool) {
+	if n <= 0 || len(available) < n {
+		return nil, false
+	}
+
+	rows := map[string][]seatPosition{}
+	for i, label := range available {
+		p := parseSeatLabel(label, i)
+		rows[p.row] = append(rows[p.row], p)
+	}
+
+	names := make([]string, 0, len(rows))
+	for name, seats := range rows {
+		names = append(names, name)
+		sort.Slice(seats, func(i, j int) bool { return seats[i].number < seats[j].number })
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	// 1. A contiguous block in one row
+	for _, name := range names {
+		seats := rows[name]
+		run := 1
+		for i := 1; i <= len(seats); i++ {
+			if run >= n {
+				return labels(seats[i-n : i]), true
+			}
+			if i < len(seats) && seats[i].number == seats[i-1].number+1 {
+				run++
+			} else {
+				run = 1
+			}
+		}
+	}
+
+	// 2. The tightest group within a single row
+	bestSpan := -1
+	var best []seatPosition
+	for _, name := range names {
+		seats := rows[name]
+		for i := 0; i+n <= len(seats); i++ {
+			span := seats[i+n-1].number - seats[i].number
+			if bestSpan < 0 || span < bestSpan {
+				bestSpan = span
+				best = seats[i : i+n]
+			}
+		}
+	}
+	if best != nil {
+		return labels(best), true
+	}
+
+	// 3. Split across the fewest adjacent rows, growing outwards from each starting row
+	bestRows := -1
+	var picked []string
+	for start := range names {
+		order := []int{start}
+		for offset := 1; offset < len(names); offset++ {
+			order = append(order, start+offset, start-offset)
+		}
+
+		var group []string
+		used := 0
+		for _, idx := range order {
+			if len(group) == n {
+				break
+			}
+			if idx < 0 || idx >= len(names) {
+				continue
+			}
+			used++
+			for _, p := range rows[names[idx]] {
+				if len(group) == n {
+					break
+				}
+				group = append(group, p.label)
+			}
+		}
+		if len(group) == n && (bestRows < 0 || used < bestRows) {
+			bestRows = used
+			picked = group
+		}
+	}
+	return picked, picked != nil
+}
+
+func labels(seats []seatPosition) []string {
+	out := make([]string, len(seats))
+	for i, p := range seats {
+		out[i] = p.label
+	}
+	return out
+}
@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
-	kafkax "github.com/samirwankhede/lewly-pgpyewj/internal/kafka"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/payment"
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
 	mailer "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/ledger"
+	storeSeats "github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
 )
@@ -23,87 +28,266 @@ type BookingsService struct {
 	repo       *bookings.BookingsRepository
 	events     *events.EventsRepository
 	users      *users.UsersRepository
+	seats      *storeSeats.SeatsRepository
+	tiers      *tiersService.TiersService
 	tokens     *redisx.TokenBucket
-	prod       *kafkax.Producer
 	wait       *waitlist.WaitlistRepository
+	offers     *OffersService
 	mailer     *mailer.MailerService
+	provider   payment.PaymentProvider
+	ledger     *ledger.LedgerRepository
 	paymentURL string
 }
 
+const (
+	// FinalizeTopic is the Kafka topic finalize messages are relayed to from the outbox.
+	FinalizeTopic = "bookings"
+	// PaymentWindow is how long a pending booking holds its seats while waiting for payment.
+	PaymentWindow = 15 * time.Minute
+)
+
 type BookingRequest struct {
 	UserID         string   `json:"user_id"`
 	Seats          []string `json:"seats"`
+	TierID         *string  `json:"tier_id"`
 	IdempotencyKey *string  `json:"idempotency_key"`
 }
 
 type BookingResponse struct {
-	BookingID string `json:"booking_id"`
-	Status    string `json:"status"`
-	Position  int    `json:"position,omitempty"`
+	BookingID        string   `json:"booking_id"`
+	Status           string   `json:"status"`
+	Position         int      `json:"position,omitempty"`
+	UnavailableSeats []string `json:"unavailable_seats,omitempty"`
+	AvailableSeats   []string `json:"available_seats,omitempty"`
+	Seats            []string `json:"seats,omitempty"`
+	Amount           float64  `json:"amount,omitempty"`
 }
 
-func NewBookingsService(log *zap.Logger, repo *bookings.BookingsRepository, events *events.EventsRepository, users *users.UsersRepository, tokens *redisx.TokenBucket, prod *kafkax.Producer, wait *waitlist.WaitlistRepository, mailer *mailer.MailerService, paymentURL string) *BookingsService {
-	return &BookingsService{log: log, repo: repo, events: events, users: users, tokens: tokens, prod: prod, wait: wait, mailer: mailer, paymentURL: paymentURL}
+func NewBookingsService(log *zap.Logger, repo *bookings.BookingsRepository, events *events.EventsRepository, users *users.UsersRepository, seats *storeSeats.SeatsRepository, tiers *tiersService.TiersService, tokens *redisx.TokenBucket, wait *waitlist.WaitlistRepository, offers *OffersService, mailer *mailer.MailerService, provider payment.PaymentProvider, ledger *ledger.LedgerRepository, paymentURL string) *BookingsService {
+	return &BookingsService{log: log, repo: repo, events: events, users: users, seats: seats, tiers: tiers, tokens: tokens, wait: wait, offers: offers, mailer: mailer, provider: provider, ledger: ledger, paymentURL: paymentURL}
+}
+
+func (s *BookingsService) Create(ctx context.Context, eventID string, userID string, IdempotencyKey *string, seats []string, tierID *string) (*BookingResponse, int, error) {
+	if len(seats) == 0 {
+		return nil, 400, errors.New("at least one seat is required")
+	}
+	seen := make(map[string]bool, len(seats))
+	for _, label := range seats {
+		if seen[label] {
+			return nil, 400, fmt.Errorf("seat %s requested more than once", label)
+		}
+		seen[label] = true
+	}
+
+	event, resp, code, err := s.checkBookable(ctx, eventID, len(seats), IdempotencyKey)
+	if resp != nil || err != nil {
+		return resp, code, err
+	}
+
+	// Price the seats first so tier rules are enforced before anything is reserved
+	quote, code, err := s.quote(ctx, event, tierID, seats)
+	if err != nil {
+		return nil, code, err
+	}
+
+	// Reserve tokens for the number of seats requested
+	ok, err := s.tokens.Reserve(ctx, eventID, len(seats))
+	if err != nil {
+		return nil, 500, err
+	}
+	if !ok {
+		return s.addToWaitlist(ctx, eventID, userID)
+	}
+	if code, err := s.reserveTiers(ctx, eventID, quote.TierCounts(), len(seats)); err != nil {
+		return nil, code, err
+	}
+
+	b, err := s.createPending(ctx, eventID, userID, IdempotencyKey, seats, tierID)
+	if err != nil {
+		s.releaseTokens(ctx, eventID, len(seats), quote.TierCounts())
+
+		// Someone else holds at least one seat: reject and re-offer what is still free
+		var unavailable *storeSeats.SeatsUnavailableError
+		if errors.As(err, &unavailable) {
+			available, aerr := s.seats.GetAvailableSeats(ctx, eventID)
+			if aerr != nil {
+				s.log.Error("Failed to list available seats", zap.Error(aerr), zap.String("event_id", eventID))
+			}
+			return &BookingResponse{Status: "seats_unavailable", UnavailableSeats: unavailable.Labels, AvailableSeats: available}, 409, nil
+		}
+		return nil, 500, err
+	}
+	return &BookingResponse{BookingID: b.ID, Status: "pending", Seats: seats, Amount: quote.Total}, 202, nil
+}
+
+// CreateBestAvailable books quantity seats chosen by the server, preferring a contiguous
+// block in one row. If another booking grabs a picked seat first, it re-picks from the
+// fresh availability a few times before giving up. With a tier, seats are picked from
+// that tier's zone, or from seats not bound to any tier for tiers without a zone.
+func (s *BookingsService) CreateBestAvailable(ctx context.Context, eventID string, userID string, IdempotencyKey *string, quantity int, tierID *string) (*BookingResponse, int, error) {
+	if quantity <= 0 {
+		return nil, 400, errors.New("quantity must be positive")
+	}
+
+	event, resp, code, err := s.checkBookable(ctx, eventID, quantity, IdempotencyKey)
+	if resp != nil || err != nil {
+		return resp, code, err
+	}
+
+	ok, err := s.tokens.Reserve(ctx, eventID, quantity)
+	if err != nil {
+		return nil, 500, err
+	}
+	if !ok {
+		return s.addToWaitlist(ctx, eventID, userID)
+	}
+
+	for attempt := 0; attempt < bestAvailableAttempts; attempt++ {
+		available, err := s.availableForTier(ctx, eventID, tierID)
+		if err != nil {
+			_ = s.tokens.Release(ctx, eventID, quantity)
+			return nil, 500, err
+		}
+
+		picked, found := BestAvailable(available, quantity)
+		if !found {
+			break
+		}
+
+		quote, code, err := s.quote(ctx, event, tierID, picked)
+		if err != nil {
+			_ = s.tokens.Release(ctx, eventID, quantity)
+			return nil, code, err
+		}
+		if code, err := s.reserveTiers(ctx, eventID, quote.TierCounts(), quantity); err != nil {
+			return nil, code, err
+		}
+
+		b, err := s.createPending(ctx, eventID, userID, IdempotencyKey, picked, tierID)
+		if err == nil {
+			return &BookingResponse{BookingID: b.ID, Status: "pending", Seats: picked, Amount: quote.Total}, 202, nil
+		}
+		_ = s.tokens.ReleaseTiers(ctx, eventID, quote.TierCounts())
+		var unavailable *storeSeats.SeatsUnavailableError
+		if !errors.As(err, &unavailable) {
+			_ = s.tokens.Release(ctx, eventID, quantity)
+			return nil, 500, err
+		}
+	}
+
+	_ = s.tokens.Release(ctx, eventID, quantity)
+	return nil, 409, fmt.Errorf("could not find %d available seats", quantity)
 }
 
-func (s *BookingsService) Create(ctx context.Context, eventID string, userID string, IdempotencyKey *string, seats []string) (*BookingResponse, int, error) {
+// checkBookable validates the event and ticket count and resolves idempotent retries.
+// A non-nil response or error means the caller should return it as is.
+func (s *BookingsService) checkBookable(ctx context.Context, eventID string, count int, IdempotencyKey *string) (*events.Event, *BookingResponse, int, error) {
 	// Check if event exists and is not expired
 	event, err := s.events.Get(ctx, eventID)
 	if err != nil {
-		return nil, 500, err
+		return nil, nil, 500, err
 	}
 	if event == nil {
-		return nil, 404, errors.New("event not found")
+		return nil, nil, 404, errors.New("event not found")
 	}
 
 	// Check if event is expired
 	if event.EndTime.Before(time.Now()) {
 		// Update event status to expired
 		s.events.UpdateStatus(ctx, eventID, "expired")
-		return nil, 400, errors.New("event is expired")
+		return nil, nil, 400, errors.New("event is expired")
 	}
 
 	// Check if user is trying to book more than maximum allowed
-	if len(seats) > event.MaximumTicketsPerBooking {
-		return nil, 400, fmt.Errorf("cannot book more than %d tickets", event.MaximumTicketsPerBooking)
+	if count > event.MaximumTicketsPerBooking {
+		return nil, nil, 400, fmt.Errorf("cannot book more than %d tickets", event.MaximumTicketsPerBooking)
 	}
 
 	// Idempotency check
 	if IdempotencyKey != nil && *IdempotencyKey != "" {
 		if b, err := s.repo.GetByIdempotency(ctx, *IdempotencyKey); err == nil && b != nil {
-			return &BookingResponse{BookingID: b.ID, Status: b.Status}, 200, nil
+			return nil, &BookingResponse{BookingID: b.ID, Status: b.Status}, 200, nil
 		}
 	}
+	return event, nil, 0, nil
+}
 
-	// Reserve tokens for the number of seats requested
-	ok, err := s.tokens.Reserve(ctx, eventID, len(seats))
+// quote prices the seats and checks the sale window and limits of their tiers.
+func (s *BookingsService) quote(ctx context.Context, event *events.Event, tierID *string, seats []string) (*tiersService.Quote, int, error) {
+	q, err := s.tiers.Quote(ctx, event, tierID, seats)
+	if err == nil {
+		err = tiersService.CheckPurchasable(q, time.Now())
+	}
+	if errors.Is(err, tiersService.ErrValidation) {
+		return nil, 400, err
+	}
 	if err != nil {
 		return nil, 500, err
 	}
+	return q, 0, nil
+}
 
-	if ok {
-		// Store seats in booking
-		seatsJSON, _ := json.Marshal(seats)
-		b, err := s.repo.CreatePending(ctx, userID, eventID, IdempotencyKey, seatsJSON)
-		if err != nil {
-			return nil, 500, err
-		}
+// reserveTiers takes the tier tokens for a booking whose n event tokens are already
+// reserved, giving the event tokens back if a tier is sold out.
+func (s *BookingsService) reserveTiers(ctx context.Context, eventID string, counts map[string]int, n int) (int, error) {
+	ok, err := s.tokens.ReserveTiers(ctx, eventID, counts)
+	if err != nil || !ok {
+		_ = s.tokens.Release(ctx, eventID, n)
+	}
+	if err != nil {
+		return 500, err
+	}
+	if !ok {
+		return 409, errors.New("ticket tier sold out")
+	}
+	return 0, nil
+}
+
+func (s *BookingsService) releaseTokens(ctx context.Context, eventID string, n int, counts map[string]int) {
+	_ = s.tokens.Release(ctx, eventID, n)
+	_ = s.tokens.ReleaseTiers(ctx, eventID, counts)
+}
 
-		payload := map[string]any{
-			"type":            "finalize_booking",
-			"booking_id":      b.ID,
-			"event_id":        eventID,
-			"user_id":         userID,
-			"seats":           seats,
-			"idempotency_key": IdempotencyKey,
+// availableForTier lists the available seats that can be sold at the tier.
+func (s *BookingsService) availableForTier(ctx context.Context, eventID string, tierID *string) ([]string, error) {
+	available, err := s.seats.GetAvailableSeats(ctx, eventID)
+	if err != nil || tierID == nil || *tierID == "" {
+		return available, err
+	}
+
+	list, err := s.tiers.List(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	zoned := false
+	for _, t := range list {
+		if t.ID == *tierID {
+			zoned = t.PriceZone != ""
 		}
-		by, _ := json.Marshal(payload)
-		if err := s.prod.Publish(ctx, []byte(eventID), by); err != nil {
-			s.log.Error("kafka publish error", zap.Error(err))
+	}
+	bound, err := s.tiers.SeatTiers(ctx, eventID, available)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, label := range available {
+		if (zoned && bound[label] == *tierID) || (!zoned && bound[label] == "") {
+			out = append(out, label)
 		}
-		return &BookingResponse{BookingID: b.ID, Status: "pending"}, 202, nil
 	}
+	return out, nil
+}
 
+// createPending holds the seats and writes the finalize message to the outbox in the same
+// transaction as the booking.
+func (s *BookingsService) createPending(ctx context.Context, eventID, userID string, IdempotencyKey *string, seats []string, tierID *string) (*bookings.Booking, error) {
+	deadline := time.Now().Add(PaymentWindow)
+	seatsJSON, _ := json.Marshal(seats)
+	return s.repo.CreatePendingWithMessage(ctx, userID, eventID, IdempotencyKey, seatsJSON, tierID, deadline, FinalizeTopic, finalizePayload(seats, deadline))
+}
+
+func (s *BookingsService) addToWaitlist(ctx context.Context, eventID, userID string) (*BookingResponse, int, error) {
 	// Fallback: Auto waitlist
 	position, err := s.wait.Add(ctx, eventID, userID)
 	if err != nil {
@@ -113,82 +297,214 @@ func (s *BookingsService) Create(ctx context.Context, eventID string, userID str
 	return &BookingResponse{Status: "waitlisted", Position: position}, 200, nil
 }
 
-var ErrValidation = errors.New("validation error")
+var (
+	ErrValidation      = errors.New("validation error")
+	ErrBookingNotFound = errors.New("booking not found")
+)
 
-func (s *BookingsService) Cancel(ctx context.Context, bookingID string) (map[string]any, int, error) {
-	b, wasBooked, err := s.repo.CancelBookingTx(ctx, bookingID)
+// finalizePayload builds the finalize message for a freshly created pending booking.
+func finalizePayload(seats []string, deadline time.Time) func(*bookings.Booking) ([]byte, error) {
+	return func(b *bookings.Booking) ([]byte, error) {
+		var idempotencyKey *string
+		if b.IdempotencyKey != "" {
+			idempotencyKey = &b.IdempotencyKey
+		}
+		return json.Marshal(map[string]any{
+			"type":             "finalize_booking",
+			"booking_id":       b.ID,
+			"event_id":         b.EventID,
+			"user_id":          b.UserID,
+			"seats":            seats,
+			"idempotency_key":  idempotencyKey,
+			"payment_deadline": deadline,
+		})
+	}
+}
+
+// Cancel cancels the user's booking. Once the cancellation commits its seats are handed
+// to the waitlist; a failure after that is logged and retried from the seat release
+// rather than reported, since the booking is already cancelled.
+func (s *BookingsService) Cancel(ctx context.Context, bookingID, userID string) (map[string]any, int, error) {
+	b, err := s.repo.GetByID(ctx, bookingID)
 	if err != nil {
+		return nil, 500, err
+	}
+	if b == nil || b.UserID != userID {
+		return nil, 404, ErrBookingNotFound
+	}
+
+	b, wasBooked, rel, err := s.repo.CancelBookingTx(ctx, bookingID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, 404, ErrBookingNotFound
+	case errors.Is(err, bookings.ErrNotCancellable):
 		return nil, 409, err
+	case err != nil:
+		return nil, 500, err
 	}
 
-	// release tokens when a booked reservation is cancelled
-	if wasBooked {
-		// Get the number of seats from the booking
-		var seats []string
-		if len(b.Seats) > 0 {
-			json.Unmarshal(b.Seats, &seats)
-		}
-		seatCount := len(seats)
-		if seatCount == 0 {
-			seatCount = 1 // fallback
-		}
+	// Offer the freed seats to the next person on the waitlist
+	if err := s.offers.HandOff(ctx, rel); err != nil {
+		s.log.Error("Failed to hand off cancelled seats", zap.Error(err), zap.String("booking_id", b.ID))
+	}
+
+	// Send cancellation email with fee and payment link
+	if wasBooked && s.mailer != nil {
+		s.sendCancellationEmail(ctx, b)
+	}
+	return map[string]any{"booking_id": b.ID, "status": b.Status}, 200, nil
+}
+
+func (s *BookingsService) sendCancellationEmail(ctx context.Context, b *bookings.Booking) {
+	event, err := s.events.Get(ctx, b.EventID)
+	if err != nil || event == nil {
+		s.log.Error("Failed to get event for cancellation email", zap.Error(err), zap.String("booking_id", b.ID))
+		return
+	}
+	user, err := s.users.GetByID(ctx, b.UserID)
+	if err != nil || user == nil {
+		s.log.Error("Failed to get user for cancellation email", zap.Error(err), zap.String("booking_id", b.ID))
+		return
+	}
+	paymentLink := fmt.Sprintf("%s/v1/payment/refund?booking_id=%s", s.paymentURL, b.ID)
+	s.mailer.SendCancellationEmail(user.Email, event.CancellationFee, paymentLink)
+}
+
+// SeatsCancellation is the outcome of cancelling some seats of a booking.
+type SeatsCancellation struct {
+	BookingID       string   `json:"booking_id"`
+	CancelledSeats  []string `json:"cancelled_seats"`
+	Seats           []string `json:"seats"`
+	AmountPaid      float64  `json:"amount_paid"`
+	CancellationFee float64  `json:"cancellation_fee"`
+	Refund          float64  `json:"refund"`
+	RefundStatus    string   `json:"refund_status"`
+}
 
-		_ = s.tokens.Release(ctx, b.EventID, seatCount)
+// CancelSeats cancels some seats of the user's booked booking. The seats' pro-rated share
+// of the amount paid is refunded minus the event's cancellation fee, and the freed seats
+// are offered to the waitlist.
+func (s *BookingsService) CancelSeats(ctx context.Context, bookingID, userID string, labels []string) (*SeatsCancellation, int, error) {
+	labels = uniqueLabels(labels)
+	if len(labels) == 0 {
+		return nil, 400, fmt.Errorf("%w: no seats to cancel", ErrValidation)
+	}
+	b, err := s.repo.GetByID(ctx, bookingID)
+	if err != nil {
+		return nil, 500, err
+	}
+	if b == nil || b.UserID != userID {
+		return nil, 404, ErrBookingNotFound
+	}
+	event, err := s.events.Get(ctx, b.EventID)
+	if err != nil {
+		return nil, 500, err
+	}
 
-		event, err := s.events.Get(ctx, b.EventID)
+	var fee, refund float64
+	updated, rel, err := s.repo.CancelSeats(ctx, bookingID, labels, func(tx pgx.Tx, locked *bookings.Booking, kept []string) (float64, error) {
+		var current []string
+		if err := json.Unmarshal(locked.Seats, &current); err != nil {
+			return 0, err
+		}
+		full, err := s.tiers.Quote(ctx, event, locked.TierID, current)
 		if err != nil {
-			return nil, 409, err
+			return 0, err
+		}
+		cancelled, err := s.tiers.Quote(ctx, event, locked.TierID, labels)
+		if err != nil {
+			return 0, err
 		}
 
-		// Send cancellation email with fee and payment link
-		if s.mailer != nil {
-			user, err := s.users.GetByID(ctx, b.UserID)
-			if err != nil {
-				return nil, 409, err
-			}
-			paymentLink := fmt.Sprintf("%s/v1/payment/refund?booking_id=%s", s.paymentURL, bookingID)
-			s.mailer.SendCancellationEmail(user.Email, event.CancellationFee, paymentLink)
-		}
-
-		// Promote next person from waitlist
-		if s.wait != nil {
-			if id, userID, _, err := s.wait.NextActive(ctx, b.EventID); err == nil && userID != "" {
-				// Get seats from the cancelled booking
-				var seats []string
-				if len(b.Seats) > 0 {
-					json.Unmarshal(b.Seats, &seats)
-				}
-				seatsJSON, _ := json.Marshal(seats)
-				if pb, cerr := s.repo.CreatePending(ctx, userID, b.EventID, nil, seatsJSON); cerr == nil {
-					payload := map[string]any{
-						"type":            "finalize_booking",
-						"booking_id":      pb.ID,
-						"event_id":        b.EventID,
-						"user_id":         userID,
-						"seats":           seats,
-						"idempotency_key": pb.IdempotencyKey,
-					}
-					by, _ := json.Marshal(payload)
-					_ = s.prod.Publish(ctx, []byte(b.EventID), by)
-					_ = s.wait.Remove(ctx, id)
-
-					// Send waitlist promotion email
-					if s.mailer != nil {
-						user, err := s.users.GetByID(ctx, userID)
-						if err != nil {
-							return nil, 409, err
-						}
-						s.mailer.SendWaitlistPromotionEmail(user.Email, event.Name)
-					}
-				}
+		// Pro-rate what was actually paid by the list price of the seats
+		share := cancelled.Total
+		if full.Total > 0 {
+			share = math.Round(locked.AmountPaid*cancelled.Total/full.Total*100) / 100
+		}
+		fee = math.Min(event.CancellationFee, share)
+		refund = share - fee
+		if fee > 0 {
+			if err := ledger.CancellationFeeTx(ctx, tx, locked.EventID, locked.ID, ledger.MoneyFromFloat(fee)); err != nil {
+				return 0, err
 			}
 		}
+		return share, nil
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, 404, ErrBookingNotFound
+	case errors.Is(err, bookings.ErrSeatNotBooked), errors.Is(err, bookings.ErrLastSeats):
+		return nil, 400, fmt.Errorf("%w: %v", ErrValidation, err)
+	case errors.Is(err, bookings.ErrNotCancellable):
+		return nil, 409, err
+	case err != nil:
+		return nil, 500, err
 	}
-	return map[string]any{"booking_id": b.ID, "status": b.Status}, 200, nil
+
+	resp := &SeatsCancellation{
+		BookingID:       updated.ID,
+		CancelledSeats:  labels,
+		AmountPaid:      updated.AmountPaid,
+		CancellationFee: fee,
+		Refund:          refund,
+		RefundStatus:    s.refundSeats(ctx, updated, refund),
+	}
+	_ = json.Unmarshal(updated.Seats, &resp.Seats)
+
+	if s.mailer != nil {
+		if user, err := s.users.GetByID(ctx, updated.UserID); err == nil && user != nil {
+			s.mailer.SendSeatsCancellationEmail(user.Email, event.Name, labels, fee, refund)
+		}
+	}
+
+	// Offer the freed seats to the waitlist
+	if err := s.offers.HandOff(ctx, rel); err != nil {
+		s.log.Error("Failed to hand off cancelled seats", zap.Error(err), zap.String("booking_id", updated.ID))
+	}
+	return resp, 200, nil
 }
 
-func (s *BookingsService) GetBookingStatus(ctx context.Context, bookingID string) (string, error) {
-	return s.repo.GetBookingStatus(ctx, bookingID)
+// refundSeats returns the refund through the gateway and records it in the ledger. A
+// failed refund stays owed in the ledger's customer funds for finance to settle.
+func (s *BookingsService) refundSeats(ctx context.Context, b *bookings.Booking, amount float64) string {
+	if amount <= 0 {
+		return "none"
+	}
+	if b.PaymentIntentID == nil {
+		s.log.Warn("Booking has no payment intent to refund", zap.String("booking_id", b.ID))
+		return "failed"
+	}
+	refund, err := s.provider.Refund(ctx, *b.PaymentIntentID, amount)
+	if err != nil {
+		s.log.Error("Seat refund failed", zap.Error(err), zap.String("booking_id", b.ID))
+		return "failed"
+	}
+	if err := s.ledger.Refund(ctx, b.EventID, b.ID, refund.ID, ledger.MoneyFromFloat(refund.Amount)); err != nil {
+		s.log.Error("Failed to record refund in ledger", zap.Error(err), zap.String("refund_id", refund.ID))
+	}
+	return "refunded"
+}
+
+func uniqueLabels(labels []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, l := range labels {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// GetBookingStatus returns the status of the user's booking, or "" if the user has no
+// booking with that ID.
+func (s *BookingsService) GetBookingStatus(ctx context.Context, bookingID, userID string) (string, error) {
+	b, err := s.repo.GetByID(ctx, bookingID)
+	if err != nil || b == nil || b.UserID != userID {
+		return "", err
+	}
+	return b.Status, nil
 }
 
 func (s *BookingsService) GetAvailableSeats(ctx context.Context, eventID string) ([]string, error) {
@@ -0,0 +1,250 @@
+package bookings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	mailer "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/releases"
+	storeSeats "github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
+)
+
+// OfferWindow is how long a waitlisted user has to accept an offer of freed seats.
+const OfferWindow = 30 * time.Minute
+
+var ErrOfferNotFound = errors.New("offer not found")
+
+// OffersService offers freed seats to the waitlist. The next user gets an offer that holds
+// the seats until it expires; declined and expired offers cascade down the waitlist.
+type OffersService struct {
+	log      *zap.Logger
+	repo     *bookings.BookingsRepository
+	events   *events.EventsRepository
+	users    *users.UsersRepository
+	wait     *waitlist.WaitlistRepository
+	releases *releases.ReleasesRepository
+	tiers    *tiersService.TiersService
+	tokens   *redisx.TokenBucket
+	mailer   *mailer.MailerService
+}
+
+func NewOffersService(log *zap.Logger, repo *bookings.BookingsRepository, events *events.EventsRepository, users *users.UsersRepository, wait *waitlist.WaitlistRepository, releases *releases.ReleasesRepository, tiers *tiersService.TiersService, tokens *redisx.TokenBucket, mailer *mailer.MailerService) *OffersService {
+	return &OffersService{log: log, repo: repo, events: events, users: users, wait: wait, releases: releases, tiers: tiers, tokens: tokens, mailer: mailer}
+}
+
+// HandOff passes the seats of a release to the next waitlisted user, or their tokens back
+// to the bucket, and completes the release. If the seats cannot be priced the error is
+// returned and the release stays pending, to be retried once its lease runs out.
+func (s *OffersService) HandOff(ctx context.Context, rel *releases.Release) error {
+	if rel == nil {
+		return nil
+	}
+	event, err := s.events.Get(ctx, rel.EventID)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		// The event and its token bucket are gone, so there is nothing to give back
+		return s.releases.Complete(ctx, rel.ID)
+	}
+	quote, err := s.tiers.Quote(ctx, event, rel.TierID, rel.Seats)
+	if err != nil {
+		return err
+	}
+	s.offerNext(ctx, event, rel.Seats, rel.TierID, quote.TierCounts(), rel)
+	return nil
+}
+
+// HandOffDue retries up to limit releases that were not handed on in time, for example
+// because the process that freed the seats stopped first. It returns how many it claimed.
+func (s *OffersService) HandOffDue(ctx context.Context, limit int) (int, error) {
+	due, err := s.releases.ClaimDue(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, rel := range due {
+		if err := s.HandOff(ctx, rel); err != nil {
+			s.log.Error("Failed to hand off freed seats", zap.Error(err), zap.String("release_id", rel.ID))
+		}
+	}
+	return len(due), nil
+}
+
+// OfferBatch offers new seats one each to the next waitlisted users, in promotion order,
+// and returns the offers made. The caller holds one event token per seat; tier tokens of
+// seats bound to a tier are reserved here. Once nobody is left waiting, the remaining
+// seats' tokens go back to the bucket.
+func (s *OffersService) OfferBatch(ctx context.Context, event *events.Event, seats []string) []*waitlist.Offer {
+	offers := []*waitlist.Offer{}
+	for i, label := range seats {
+		counts := map[string]int{}
+		if quote, err := s.tiers.Quote(ctx, event, nil, []string{label}); err != nil {
+			s.log.Error("Failed to price new seat", zap.Error(err), zap.String("seat", label))
+		} else {
+			counts = quote.TierCounts()
+		}
+		if len(counts) > 0 {
+			if ok, err := s.tokens.ReserveTiers(ctx, event.ID, counts); err != nil || !ok {
+				// The seat's tier is sold out, so it stays available without an offer
+				s.releaseTokens(ctx, event.ID, 1, nil)
+				continue
+			}
+		}
+
+		offer, waiting := s.offerNext(ctx, event, []string{label}, nil, counts, nil)
+		if offer != nil {
+			offers = append(offers, offer)
+		}
+		if !waiting {
+			s.releaseTokens(ctx, event.ID, len(seats)-i-1, nil)
+			break
+		}
+	}
+	return offers
+}
+
+// offerNext makes the offer and reports whether anyone was waiting. Tokens are released
+// whenever no offer is made. With a release, the offer completes it in its transaction
+// and tokens are released at most once.
+func (s *OffersService) offerNext(ctx context.Context, event *events.Event, seats []string, tierID *string, counts map[string]int, rel *releases.Release) (*waitlist.Offer, bool) {
+	id, userID, position, err := s.wait.NextActive(ctx, event.ID)
+	if err != nil {
+		s.log.Error("Failed to get next waitlist user", zap.Error(err), zap.String("event_id", event.ID))
+		s.giveBack(ctx, event.ID, len(seats), counts, rel)
+		return nil, false
+	}
+	if userID == "" {
+		// Nobody to hand the seats to, so give the tokens back to the bucket
+		s.giveBack(ctx, event.ID, len(seats), counts, rel)
+		return nil, false
+	}
+
+	var complete func(tx pgx.Tx) error
+	if rel != nil {
+		complete = func(tx pgx.Tx) error { return releases.CompleteTx(ctx, tx, rel.ID) }
+	}
+	offer, err := s.wait.CreateOffer(ctx, event.ID, id, userID, seats, tierID, time.Now().Add(OfferWindow), complete)
+	if errors.Is(err, releases.ErrDone) {
+		// Another worker already handed these seats on
+		return nil, true
+	}
+	if err != nil {
+		s.log.Error("Failed to offer seats to waitlist user", zap.Error(err), zap.String("user_id", userID))
+		s.giveBack(ctx, event.ID, len(seats), counts, rel)
+		return nil, true
+	}
+	s.log.Info("Offered seats to waitlist user",
+		zap.String("offer_id", offer.ID), zap.String("user_id", userID), zap.Int("position", position))
+
+	if s.mailer != nil {
+		user, err := s.users.GetByID(ctx, userID)
+		if err != nil || user == nil {
+			s.log.Error("User not found", zap.String("user_id", userID))
+			return offer, true
+		}
+		s.mailer.SendWaitlistOfferEmail(user.Email, event.Name, seats, offer.ExpiresAt, offer.ID)
+	}
+	return offer, true
+}
+
+// ListOffers returns the user's open offers.
+func (s *OffersService) ListOffers(ctx context.Context, userID string) ([]*waitlist.Offer, error) {
+	return s.wait.ListOffers(ctx, userID)
+}
+
+// Accept books the offered seats as a pending booking; its finalize message sends the
+// payment link. The offer's tokens move to the booking.
+func (s *OffersService) Accept(ctx context.Context, offerID, userID string) (*BookingResponse, int, error) {
+	deadline := time.Now().Add(PaymentWindow)
+	var booking *bookings.Booking
+	offer, err := s.wait.AcceptOffer(ctx, offerID, userID, func(tx pgx.Tx, o *waitlist.Offer) (string, error) {
+		seatsJSON, err := json.Marshal(o.Seats)
+		if err != nil {
+			return "", err
+		}
+		booking, err = bookings.CreatePendingTx(ctx, tx, o.UserID, o.EventID, nil, seatsJSON, o.TierID, deadline, FinalizeTopic, finalizePayload(o.Seats, deadline))
+		if err != nil {
+			return "", err
+		}
+		return booking.ID, nil
+	})
+	if code, err := offerError(err); err != nil {
+		return nil, code, err
+	}
+	return &BookingResponse{BookingID: booking.ID, Status: booking.Status, Seats: offer.Seats}, 200, nil
+}
+
+// Decline gives up the offer and passes its seats to the next waitlisted user.
+func (s *OffersService) Decline(ctx context.Context, offerID, userID string) (*waitlist.Offer, int, error) {
+	offer, err := s.wait.DeclineOffer(ctx, offerID, userID)
+	if code, err := offerError(err); err != nil {
+		return nil, code, err
+	}
+	if err := s.HandOff(ctx, offer.Release); err != nil {
+		s.log.Error("Failed to hand off declined seats", zap.Error(err), zap.String("offer_id", offer.ID))
+	}
+	return offer, 200, nil
+}
+
+// ExpireDue closes up to limit expired offers and passes their seats on. It returns how
+// many offers expired. Seats that cannot be passed on now stay in their release and are
+// retried by the release scheduler.
+func (s *OffersService) ExpireDue(ctx context.Context, limit int) (int, error) {
+	offers, err := s.wait.ClaimExpiredOffers(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, o := range offers {
+		s.log.Info("Waitlist offer expired", zap.String("offer_id", o.ID), zap.String("user_id", o.UserID))
+		if err := s.HandOff(ctx, o.Release); err != nil {
+			s.log.Error("Failed to hand off expired offer seats", zap.Error(err), zap.String("offer_id", o.ID))
+		}
+	}
+	return len(offers), nil
+}
+
+// giveBack returns n event tokens and the tier tokens to the bucket. A release is
+// completed afterwards; if either step fails it stays pending and is retried.
+func (s *OffersService) giveBack(ctx context.Context, eventID string, n int, counts map[string]int, rel *releases.Release) {
+	if rel == nil {
+		s.releaseTokens(ctx, eventID, n, counts)
+		return
+	}
+	if err := s.tokens.ReleaseOnce(ctx, rel.ID, eventID, n, counts); err != nil {
+		s.log.Error("Failed to release tokens", zap.Error(err), zap.String("release_id", rel.ID))
+		return
+	}
+	if err := s.releases.Complete(ctx, rel.ID); err != nil && !errors.Is(err, releases.ErrDone) {
+		s.log.Error("Failed to complete seat release", zap.Error(err), zap.String("release_id", rel.ID))
+	}
+}
+
+func (s *OffersService) releaseTokens(ctx context.Context, eventID string, n int, counts map[string]int) {
+	_ = s.tokens.Release(ctx, eventID, n)
+	_ = s.tokens.ReleaseTiers(ctx, eventID, counts)
+}
+
+func offerError(err error) (int, error) {
+	var unavailable *storeSeats.SeatsUnavailableError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return 404, ErrOfferNotFound
+	case errors.Is(err, waitlist.ErrOfferClosed), errors.As(err, &unavailable):
+		return 409, err
+	default:
+		return 500, err
+	}
+}
@@ -2,22 +2,38 @@ package events
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.uber.org/zap"
 
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/tiers"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/venues"
 )
 
 type EventsService struct {
 	log    *zap.Logger
 	repo   *events.EventsRepository
 	tokens *redisx.TokenBucket
+	venues *venues.VenuesRepository
+	tiers  *tiersService.TiersService
 }
 
-func NewEventsService(log *zap.Logger, repo *events.EventsRepository, tokens *redisx.TokenBucket) *EventsService {
-	return &EventsService{log: log, repo: repo, tokens: tokens}
+// ErrNoSeatMap is returned for events that are not attached to a venue.
+var ErrNoSeatMap = errors.New("event has no seat map")
+
+type SeatMap struct {
+	EventID  string            `json:"event_id"`
+	VenueID  string            `json:"venue_id"`
+	Venue    string            `json:"venue"`
+	Sections []*venues.Section `json:"sections"`
+}
+
+func NewEventsService(log *zap.Logger, repo *events.EventsRepository, tokens *redisx.TokenBucket, venues *venues.VenuesRepository, tiers *tiersService.TiersService) *EventsService {
+	return &EventsService{log: log, repo: repo, tokens: tokens, venues: venues, tiers: tiers}
 }
 
 func (s *EventsService) List(ctx context.Context, limit, offset int, q string, from, to *time.Time) ([]*events.Event, error) {
@@ -60,3 +76,39 @@ func (s *EventsService) IsLiked(ctx context.Context, eventID, userID string) (bo
 func (s *EventsService) GetAvailableSeats(ctx context.Context, eventID string) ([]string, error) {
 	return s.repo.GetAvailableSeats(ctx, eventID)
 }
+
+// GetSeatMap returns the venue layout of the event with the live status of every seat.
+// It returns nil if the event does not exist.
+func (s *EventsService) GetSeatMap(ctx context.Context, eventID string) (*SeatMap, error) {
+	e, err := s.repo.Get(ctx, eventID)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.VenueID == nil {
+		return nil, ErrNoSeatMap
+	}
+	sections, err := s.venues.SeatMap(ctx, e.ID, *e.VenueID)
+	if err != nil {
+		return nil, err
+	}
+	return &SeatMap{EventID: e.ID, VenueID: *e.VenueID, Venue: e.Venue, Sections: sections}, nil
+}
+
+// TierAvailability is a ticket tier with the number of tickets still on sale.
+type TierAvailability struct {
+	*tiers.Tier
+	Remaining int `json:"remaining"`
+}
+
+func (s *EventsService) ListTiers(ctx context.Context, eventID string) ([]*TierAvailability, error) {
+	list, err := s.tiers.List(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*TierAvailability, 0, len(list))
+	for _, t := range list {
+		rem, _ := s.tokens.TierRemaining(ctx, eventID, t.ID)
+		out = append(out, &TierAvailability{Tier: t, Remaining: rem})
+	}
+	return out, nil
+}
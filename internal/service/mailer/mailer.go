@@ -2,6 +2,8 @@ package mailer
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -52,18 +54,23 @@ Evently Team
 	return nil
 }
 
-func (m *MailerService) SendWaitlistPromotionEmail(userEmail string, eventName string) error {
-	subject := fmt.Sprintf("Great News! You're off the waitlist for %s", eventName)
+func (m *MailerService) SendWaitlistOfferEmail(userEmail string, eventName string, seats []string, expiresAt time.Time, offerID string) error {
+	subject := fmt.Sprintf("Great News! Seats are available for %s", eventName)
 	body := fmt.Sprintf(`
 Dear User,
 
-Great news! A spot has opened up for "%s" and you're next in line!
+Great news! Seats have opened up for "%s" and you're next in line!
 
-You will receive a payment link soon.
+Seats: %s
+Offer ID: %s
+
+Accept the offer before %s to book these seats, or decline it to pass them on.
+You will receive a payment link once you accept. If you do not respond in time,
+the seats are offered to the next person on the waitlist.
 
 Best regards,
 Evently Team
-`, eventName)
+`, eventName, strings.Join(seats, ", "), offerID, expiresAt.Format(time.RFC1123))
 
 	mail := mailer.Mail{
 		To:      userEmail,
@@ -73,11 +80,11 @@ Evently Team
 
 	err := m.sender.Send(mail)
 	if err != nil {
-		m.log.Error("Failed to send waitlist promotion email", zap.Error(err), zap.String("email", userEmail))
+		m.log.Error("Failed to send waitlist offer email", zap.Error(err), zap.String("email", userEmail))
 		return err
 	}
 
-	m.log.Info("Waitlist promotion email sent", zap.String("email", userEmail), zap.String("event", eventName))
+	m.log.Info("Waitlist offer email sent", zap.String("email", userEmail), zap.String("event", eventName))
 	return nil
 }
 
@@ -113,6 +120,38 @@ Evently Team
 	return nil
 }
 
+func (m *MailerService) SendSeatsCancellationEmail(userEmail string, eventName string, seats []string, cancellationFee float64, refundAmount float64) error {
+	subject := "Seats Cancelled - " + eventName
+	body := fmt.Sprintf(`
+Dear User,
+
+The following seats of your booking for %s have been cancelled: %s
+
+Cancellation Fee: $%.2f
+Refund Amount: $%.2f
+
+The refund is returned to your original payment method. The rest of your booking is unchanged.
+
+Best regards,
+Evently Team
+`, eventName, strings.Join(seats, ", "), cancellationFee, refundAmount)
+
+	mail := mailer.Mail{
+		To:      userEmail,
+		Subject: subject,
+		Body:    body,
+	}
+
+	err := m.sender.Send(mail)
+	if err != nil {
+		m.log.Error("Failed to send seats cancellation email", zap.Error(err), zap.String("email", userEmail))
+		return err
+	}
+
+	m.log.Info("Seats cancellation email sent", zap.String("email", userEmail))
+	return nil
+}
+
 func (m *MailerService) SendEventCancellationEmail(userEmail string, eventName string, refundAmount float64) error {
 	subject := fmt.Sprintf("Event Cancelled: %s", eventName)
 	body := fmt.Sprintf(`
@@ -178,3 +217,67 @@ Evently Team
 	m.log.Info("Password change OTP email sent", zap.String("email", userEmail))
 	return nil
 }
+
+func (m *MailerService) SendEmailVerificationEmail(userEmail string, verifyLink string, expiresAt time.Time) error {
+	subject := "Verify your email address"
+	body := fmt.Sprintf(`
+Dear User,
+
+Welcome to Evently! Please confirm your email address to start booking events and joining waitlists:
+
+%s
+
+This link expires at %s.
+
+If you did not create an account, please ignore this email.
+
+Best regards,
+Evently Team
+`, verifyLink, expiresAt.Format(time.RFC1123))
+
+	mail := mailer.Mail{
+		To:      userEmail,
+		Subject: subject,
+		Body:    body,
+	}
+
+	err := m.sender.Send(mail)
+	if err != nil {
+		m.log.Error("Failed to send email verification email", zap.Error(err), zap.String("email", userEmail))
+		return err
+	}
+
+	m.log.Info("Email verification email sent", zap.String("email", userEmail))
+	return nil
+}
+
+func (m *MailerService) SendAccountLockedEmail(userEmail string, lockedUntil time.Time) error {
+	subject := "Your account was temporarily locked"
+	body := fmt.Sprintf(`
+Dear User,
+
+We noticed several failed attempts to sign in to your account or reset its password, so we have temporarily locked it.
+
+You can try again after %s.
+
+If this wasn't you, someone may be trying to guess your password. You can reset it with a one-time code sent to this address, which also lifts the lock.
+
+Best regards,
+Evently Team
+`, lockedUntil.Format(time.RFC1123))
+
+	mail := mailer.Mail{
+		To:      userEmail,
+		Subject: subject,
+		Body:    body,
+	}
+
+	err := m.sender.Send(mail)
+	if err != nil {
+		m.log.Error("Failed to send account locked email", zap.Error(err), zap.String("email", userEmail))
+		return err
+	}
+
+	m.log.Info("Account locked email sent", zap.String("email", userEmail))
+	return nil
+}
@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/payment"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/ledger"
+)
+
+var ErrInvalidAdjustment = errors.New("invalid ledger adjustment")
+
+// bookingPageSize is how many bookings are read at a time when going through an event.
+const bookingPageSize = 500
+
+// LedgerQuery selects ledger transactions. A booking or event also gets its balance.
+type LedgerQuery struct {
+	EventID   string
+	BookingID string
+	Kind      string
+	Limit     int
+	Offset    int
+}
+
+type LedgerView struct {
+	Transactions []*ledger.Transaction `json:"transactions"`
+	Balance      *ledger.Balance       `json:"balance,omitempty"`
+}
+
+// Adjustment is a manual correction by finance. A positive amount debits Account.
+type Adjustment struct {
+	EventID   string       `json:"event_id" binding:"required"`
+	BookingID *string      `json:"booking_id"`
+	Account   string       `json:"account" binding:"required"`
+	Amount    ledger.Money `json:"amount" binding:"required"`
+	Memo      string       `json:"memo" binding:"required"`
+}
+
+// Mismatch is a booking whose ledger totals differ from the provider's intent.
+type Mismatch struct {
+	BookingID        string       `json:"booking_id"`
+	IntentID         string       `json:"intent_id,omitempty"`
+	LedgerCharged    ledger.Money `json:"ledger_charged"`
+	ProviderCharged  ledger.Money `json:"provider_charged"`
+	LedgerRefunded   ledger.Money `json:"ledger_refunded"`
+	ProviderRefunded ledger.Money `json:"provider_refunded"`
+	Error            string       `json:"error,omitempty"`
+}
+
+type Reconciliation struct {
+	EventID    string          `json:"event_id"`
+	Checked    int             `json:"checked"`
+	Mismatches []*Mismatch     `json:"mismatches"`
+	Balance    *ledger.Balance `json:"balance"`
+}
+
+// GetLedger lists ledger transactions, with the balance of the booking or event filtered on.
+func (s *PaymentService) GetLedger(ctx context.Context, q LedgerQuery) (*LedgerView, error) {
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+	txs, err := s.ledger.List(ctx, ledger.Filter{
+		EventID:   q.EventID,
+		BookingID: q.BookingID,
+		Kind:      q.Kind,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	view := &LedgerView{Transactions: txs}
+	switch {
+	case q.BookingID != "":
+		view.Balance, err = s.ledger.BookingBalance(ctx, q.BookingID)
+	case q.EventID != "":
+		view.Balance, err = s.ledger.EventBalance(ctx, q.EventID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// AdjustLedger records a manual correction against the adjustments account.
+func (s *PaymentService) AdjustLedger(ctx context.Context, in Adjustment) (*ledger.Transaction, error) {
+	switch in.Account {
+	case ledger.AccountProviderCash, ledger.AccountCustomerFunds, ledger.AccountFeeRevenue:
+	default:
+		return nil, ErrInvalidAdjustment
+	}
+	if in.Amount == 0 {
+		return nil, ErrInvalidAdjustment
+	}
+	return s.ledger.Adjust(ctx, in.EventID, in.BookingID, in.Account, in.Amount, in.Memo)
+}
+
+// Reconcile compares the ledger of every paid booking of the event with the provider's
+// payment intents.
+func (s *PaymentService) Reconcile(ctx context.Context, eventID string) (*Reconciliation, error) {
+	totals, err := s.ledger.EventTotals(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	byBooking := map[string]*ledger.BookingTotals{}
+	for _, t := range totals {
+		byBooking[t.BookingID] = t
+	}
+
+	// Bookings paid through the provider but missing from the ledger count too
+	err = s.bookings.ForEachByEvent(ctx, eventID, bookingPageSize, func(page []*bookings.Booking) error {
+		for _, b := range page {
+			if b.PaymentIntentID == nil {
+				continue
+			}
+			t, ok := byBooking[b.ID]
+			if !ok {
+				t = &ledger.BookingTotals{BookingID: b.ID}
+				byBooking[b.ID] = t
+				totals = append(totals, t)
+			}
+			t.IntentID = b.PaymentIntentID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Reconciliation{EventID: eventID, Mismatches: []*Mismatch{}}
+	for _, t := range totals {
+		rec.Checked++
+		m := &Mismatch{BookingID: t.BookingID, LedgerCharged: t.Charged, LedgerRefunded: t.Refunded}
+		if t.IntentID == nil {
+			m.Error = "no payment intent recorded"
+			rec.Mismatches = append(rec.Mismatches, m)
+			continue
+		}
+		m.IntentID = *t.IntentID
+
+		intent, err := s.provider.GetIntent(ctx, *t.IntentID)
+		if err != nil {
+			m.Error = err.Error()
+			rec.Mismatches = append(rec.Mismatches, m)
+			continue
+		}
+		if intent.Status != payment.StatusRequiresCapture && intent.Status != payment.StatusDeclined {
+			m.ProviderCharged = ledger.MoneyFromFloat(intent.Amount)
+		}
+		m.ProviderRefunded = ledger.MoneyFromFloat(intent.AmountRefunded)
+		if m.LedgerCharged != m.ProviderCharged || m.LedgerRefunded != m.ProviderRefunded {
+			rec.Mismatches = append(rec.Mismatches, m)
+		}
+	}
+
+	rec.Balance, err = s.ledger.EventBalance(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -5,24 +5,44 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
+	"github.com/samirwankhede/lewly-pgpyewj/internal/payment"
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/ledger"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/payments"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
 )
 
 type PaymentService struct {
 	log      *zap.Logger
 	bookings *bookings.BookingsRepository
 	events   *events.EventsRepository
+	tiers    *tiersService.TiersService
+	provider payment.PaymentProvider
+	webhooks *payments.WebhooksRepository
+	ledger   *ledger.LedgerRepository
+
+	paymentURL     string
+	checkoutSecret string
+	webhookSecret  string
 }
 
-type PaymentRequest struct {
-	BookingID string  `json:"booking_id"`
-	Amount    float64 `json:"amount"`
-	PaymentID string  `json:"payment_id"` // From payment provider (e.g., Stripe)
+// CheckoutSession is a signed payment link for a pending booking.
+type CheckoutSession struct {
+	BookingID string    `json:"booking_id"`
+	Amount    float64   `json:"amount"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type PaymentResponse struct {
@@ -37,105 +57,250 @@ var (
 	ErrPaymentFailed   = errors.New("payment failed")
 	ErrBookingExpired  = errors.New("booking expired")
 	ErrAlreadyPaid     = errors.New("booking already paid")
+	ErrInvalidWebhook  = errors.New("invalid webhook payload")
+	ErrNotCancelled    = errors.New("booking is not cancelled")
+	ErrNotPaid         = errors.New("booking was not paid")
 )
 
-func NewPaymentService(log *zap.Logger, bookings *bookings.BookingsRepository, events *events.EventsRepository) *PaymentService {
+func NewPaymentService(log *zap.Logger, bookings *bookings.BookingsRepository, events *events.EventsRepository, tiers *tiersService.TiersService, provider payment.PaymentProvider, webhooks *payments.WebhooksRepository, ledger *ledger.LedgerRepository, paymentURL, checkoutSecret, webhookSecret string) *PaymentService {
 	return &PaymentService{
-		log:      log,
-		bookings: bookings,
-		events:   events,
+		log:            log,
+		bookings:       bookings,
+		events:         events,
+		tiers:          tiers,
+		provider:       provider,
+		webhooks:       webhooks,
+		ledger:         ledger,
+		paymentURL:     paymentURL,
+		checkoutSecret: checkoutSecret,
+		webhookSecret:  webhookSecret,
 	}
 }
 
-func (s *PaymentService) ProcessBookingPayment(ctx context.Context, req PaymentRequest) (*PaymentResponse, error) {
-	// Get booking
-	booking, err := s.bookings.GetByID(ctx, req.BookingID)
+// CreateCheckoutSession returns a signed link for paying the user's pending booking. The
+// link expires with the booking's payment window.
+func (s *PaymentService) CreateCheckoutSession(ctx context.Context, bookingID, userID string) (*CheckoutSession, error) {
+	booking, err := s.pendingBooking(ctx, bookingID)
 	if err != nil {
 		return nil, err
 	}
-	if booking == nil {
+	if booking.UserID != userID {
 		return nil, ErrBookingNotFound
 	}
 
-	// Check if booking is still pending
-	if booking.Status != "pending" {
-		if booking.Status == "booked" {
-			return nil, ErrAlreadyPaid
-		}
-		return nil, fmt.Errorf("booking is in %s status", booking.Status)
+	amount, err := s.bookingAmount(ctx, booking)
+	if err != nil {
+		return nil, err
 	}
+	expires := booking.CreatedAt.Add(bookingsService.PaymentWindow)
+	if !time.Now().Before(expires) {
+		return nil, ErrBookingExpired
+	}
+	return &CheckoutSession{
+		BookingID: booking.ID,
+		Amount:    amount,
+		URL:       payment.CheckoutLink(s.paymentURL, s.checkoutSecret, booking.ID, amount, expires),
+		ExpiresAt: expires,
+	}, nil
+}
 
-	// Get event details
-	event, err := s.events.Get(ctx, booking.EventID)
+// GetCheckoutSession verifies a checkout link and describes what it pays for.
+func (s *PaymentService) GetCheckoutSession(ctx context.Context, q url.Values) (*CheckoutSession, error) {
+	bookingID, amount, err := payment.VerifyCheckout(s.checkoutSecret, q, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	if event == nil {
-		return nil, errors.New("event not found")
+	if _, err := s.pendingBooking(ctx, bookingID); err != nil {
+		return nil, err
 	}
+	expires, _ := strconv.ParseInt(q.Get("expires"), 10, 64)
+	return &CheckoutSession{BookingID: bookingID, Amount: amount, ExpiresAt: time.Unix(expires, 0)}, nil
+}
 
-	// Parse seats from JSON to get actual count
-	var seats []string
-	if len(booking.Seats) > 0 {
-		if err := json.Unmarshal(booking.Seats, &seats); err != nil {
-			s.log.Error("Failed to parse seats JSON", zap.Error(err))
-			seats = []string{"seat1"} // fallback
-		}
+// PayCheckout charges the card for a checkout link. It stands in for the gateway's hosted
+// checkout page: the booking is only confirmed once the gateway's webhook arrives.
+func (s *PaymentService) PayCheckout(ctx context.Context, q url.Values, cardToken string) (*PaymentResponse, error) {
+	bookingID, amount, err := payment.VerifyCheckout(s.checkoutSecret, q, time.Now())
+	if err != nil {
+		return nil, err
 	}
-	if len(seats) == 0 {
-		seats = []string{"seat1"} // fallback
+	booking, err := s.pendingBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking.PaymentIntentID != nil {
+		// A previous attempt may already have been captured
+		if intent, err := s.provider.GetIntent(ctx, *booking.PaymentIntentID); err == nil && intent.Status == payment.StatusSucceeded {
+			return nil, ErrAlreadyPaid
+		}
 	}
 
-	// Validate amount based on actual seat count
-	expectedAmount := event.TicketPrice * float64(len(seats))
-	if req.Amount < expectedAmount {
+	due, err := s.bookingAmount(ctx, booking)
+	if err != nil {
+		return nil, err
+	}
+	if amount < due {
 		return nil, ErrInvalidAmount
 	}
 
-	// Simulate payment processing (in real implementation, integrate with Stripe/PayPal)
-	success := s.simulatePaymentProcessing(req.PaymentID, req.Amount)
-	if !success {
+	// Charge the signed amount through the gateway
+	intent, err := s.charge(ctx, booking.ID, amount, cardToken)
+	var declined *payment.DeclinedError
+	if errors.As(err, &declined) {
 		return &PaymentResponse{
 			Success: false,
-			Message: "Payment processing failed",
+			Message: declined.Error(),
 		}, nil
 	}
-
-	// Update booking status to paid
-	err = s.bookings.UpdatePaymentStatus(ctx, req.BookingID, "paid", req.Amount)
 	if err != nil {
-		s.log.Error("Failed to update payment status", zap.Error(err))
-		return nil, err
+		s.log.Error("Payment processing failed", zap.Error(err), zap.String("booking_id", booking.ID))
+		return nil, ErrPaymentFailed
 	}
 
-	// Finalize booking (mark as booked and update event reserved count)
-	seatsBytes, _ := json.Marshal(seats)
-	err = s.bookings.FinalizeBooking(ctx, req.BookingID, seatsBytes, req.Amount)
-	if err != nil {
-		s.log.Error("Failed to finalize booking", zap.Error(err))
+	if err := s.bookings.SetPaymentIntent(ctx, booking.ID, intent.ID); err != nil {
+		s.log.Error("Failed to record payment intent", zap.Error(err), zap.String("intent_id", intent.ID))
 		return nil, err
 	}
 
 	return &PaymentResponse{
 		Success:   true,
-		Message:   "Payment processed successfully",
-		BookingID: req.BookingID,
+		Message:   "Payment received, the booking is confirmed once the payment provider notifies us",
+		BookingID: booking.ID,
 	}, nil
 }
 
-func (s *PaymentService) ProcessCancellationRefund(ctx context.Context, BookingID string) (*PaymentResponse, error) {
+// HandleWebhook verifies and applies a payment provider webhook. Each provider event is
+// applied once; redeliveries are acknowledged without effect.
+func (s *PaymentService) HandleWebhook(ctx context.Context, body []byte, signature string) error {
+	if err := payment.VerifyWebhook(s.webhookSecret, signature, body, time.Now()); err != nil {
+		return err
+	}
+	var evt payment.WebhookEvent
+	if err := json.Unmarshal(body, &evt); err != nil || evt.ID == "" {
+		return ErrInvalidWebhook
+	}
+
+	if evt.Type != payment.EventIntentSucceeded {
+		// Recorded for reference; refunds are already applied by whoever issued them
+		_, err := s.webhooks.Process(ctx, evt.ID, evt.Type, body, nil)
+		return err
+	}
+	return s.applyPaymentSucceeded(ctx, evt, body)
+}
+
+// applyPaymentSucceeded confirms the booking a captured payment was for. A payment that
+// cannot confirm its booking (expired, cancelled or short) is refunded once.
+func (s *PaymentService) applyPaymentSucceeded(ctx context.Context, evt payment.WebhookEvent, body []byte) error {
+	booking, err := s.bookings.GetByID(ctx, evt.BookingID)
+	if err != nil {
+		return err
+	}
+
+	if booking != nil && booking.Status == "pending" {
+		amount, err := s.bookingAmount(ctx, booking)
+		if err != nil {
+			return err
+		}
+		if evt.Amount >= amount {
+			_, err := s.webhooks.Process(ctx, evt.ID, evt.Type, body, func(tx pgx.Tx) error {
+				if err := bookings.FinalizeBookingTx(ctx, tx, booking.ID, booking.Seats, evt.Amount, &evt.IntentID); err != nil {
+					return err
+				}
+				return ledger.ChargeTx(ctx, tx, booking.EventID, booking.ID, evt.IntentID, ledger.MoneyFromFloat(evt.Amount))
+			})
+			var unavailable *seats.SeatsUnavailableError
+			if err == nil || !(errors.Is(err, bookings.ErrNotPending) || errors.As(err, &unavailable)) {
+				return err
+			}
+			// Expired or cancelled while the payment was in flight
+		}
+	}
+
+	// The money still arrived, so it is charged and refunded in the ledger
+	var recordCharge func(tx pgx.Tx) error
+	if booking != nil {
+		recordCharge = func(tx pgx.Tx) error {
+			return ledger.ChargeTx(ctx, tx, booking.EventID, booking.ID, evt.IntentID, ledger.MoneyFromFloat(evt.Amount))
+		}
+	}
+	duplicate, err := s.webhooks.Process(ctx, evt.ID, evt.Type, body, recordCharge)
+	if err != nil || duplicate {
+		return err
+	}
+	s.log.Warn("Refunding payment that cannot confirm its booking",
+		zap.String("booking_id", evt.BookingID), zap.String("intent_id", evt.IntentID))
+	refund, err := s.provider.Refund(ctx, evt.IntentID, evt.Amount)
+	if err != nil {
+		s.log.Error("Refund of unusable payment failed", zap.Error(err), zap.String("intent_id", evt.IntentID))
+		return nil
+	}
+	if booking != nil {
+		if err := s.ledger.Refund(ctx, booking.EventID, booking.ID, refund.ID, ledger.MoneyFromFloat(refund.Amount)); err != nil {
+			s.log.Error("Failed to record refund in ledger", zap.Error(err), zap.String("refund_id", refund.ID))
+		}
+	}
+	return nil
+}
+
+// pendingBooking loads a booking that is still waiting for payment.
+func (s *PaymentService) pendingBooking(ctx context.Context, bookingID string) (*bookings.Booking, error) {
+	booking, err := s.bookings.GetByID(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil {
+		return nil, ErrBookingNotFound
+	}
+	switch booking.Status {
+	case "pending":
+		return booking, nil
+	case "booked":
+		return nil, ErrAlreadyPaid
+	default:
+		return nil, ErrBookingExpired
+	}
+}
+
+// bookingAmount prices the booking's seats at their ticket tiers.
+func (s *PaymentService) bookingAmount(ctx context.Context, booking *bookings.Booking) (float64, error) {
+	event, err := s.events.Get(ctx, booking.EventID)
+	if err != nil {
+		return 0, err
+	}
+	if event == nil {
+		return 0, errors.New("event not found")
+	}
+	var seats []string
+	if len(booking.Seats) > 0 {
+		if err := json.Unmarshal(booking.Seats, &seats); err != nil {
+			return 0, err
+		}
+	}
+	quote, err := s.tiers.Quote(ctx, event, booking.TierID, seats)
+	if err != nil {
+		return 0, err
+	}
+	return quote.Total, nil
+}
+
+// ProcessCancellationRefund refunds the user's cancelled booking, less the event's
+// cancellation fee.
+func (s *PaymentService) ProcessCancellationRefund(ctx context.Context, BookingID, userID string) (*PaymentResponse, error) {
 	// Get booking
 	booking, err := s.bookings.GetByID(ctx, BookingID)
 	if err != nil {
 		return nil, err
 	}
-	if booking == nil {
+	if booking == nil || booking.UserID != userID {
 		return nil, ErrBookingNotFound
 	}
+	if booking.Status != "cancelled" {
+		return nil, ErrNotCancelled
+	}
 
 	// Check if booking was actually paid
 	if booking.PaymentStatus != "paid" {
-		return nil, errors.New("booking was not paid")
+		return nil, ErrNotPaid
 	}
 
 	// Get event details for cancellation fee calculation
@@ -148,23 +313,44 @@ func (s *PaymentService) ProcessCancellationRefund(ctx context.Context, BookingI
 	}
 
 	// Calculate refund amount (subtract cancellation fee)
-	cancellationFee := event.CancellationFee
+	cancellationFee := math.Min(event.CancellationFee, booking.AmountPaid)
 	refundAmount := booking.AmountPaid - cancellationFee
-	if refundAmount < 0 {
-		refundAmount = 0
+
+	// Claim the refund before calling the provider, so a concurrent request cannot refund
+	// the booking a second time
+	err = s.bookings.UpdatePaymentStatus(ctx, BookingID, "paid", "refunding", nil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotPaid
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Simulate refund processing
-	success := s.simulateRefundProcessing(booking.ID, refundAmount)
-	if !success {
-		return &PaymentResponse{
-			Success: false,
-			Message: "Refund processing failed",
-		}, nil
+	var refund *payment.Refund
+	if refundAmount > 0 {
+		refund, err = s.refund(ctx, booking, refundAmount)
+		if err != nil {
+			s.log.Error("Refund processing failed", zap.Error(err), zap.String("booking_id", booking.ID))
+			s.releaseRefund(ctx, booking.ID)
+			return &PaymentResponse{
+				Success: false,
+				Message: "Refund processing failed",
+			}, nil
+		}
 	}
 
-	// Update booking payment status
-	err = s.bookings.UpdatePaymentStatus(ctx, BookingID, "refunded", refundAmount)
+	// Finish the refund together with the ledger postings
+	err = s.bookings.UpdatePaymentStatus(ctx, BookingID, "refunding", "refunded", func(tx pgx.Tx) error {
+		if refund != nil {
+			if err := ledger.RefundTx(ctx, tx, booking.EventID, booking.ID, refund.ID, ledger.MoneyFromFloat(refund.Amount)); err != nil {
+				return err
+			}
+		}
+		if cancellationFee > 0 {
+			return ledger.CancellationFeeTx(ctx, tx, booking.EventID, booking.ID, ledger.MoneyFromFloat(cancellationFee))
+		}
+		return nil
+	})
 	if err != nil {
 		s.log.Error("Failed to update refund status", zap.Error(err))
 		return nil, err
@@ -178,12 +364,6 @@ func (s *PaymentService) ProcessCancellationRefund(ctx context.Context, BookingI
 }
 
 func (s *PaymentService) ProcessEventCancellationRefund(ctx context.Context, eventID string) error {
-	// Get all paid bookings for the event
-	bookings, err := s.bookings.ListByEvent(ctx, eventID, 1000, 0) // Get all bookings
-	if err != nil {
-		return err
-	}
-
 	// Get event details
 	event, err := s.events.Get(ctx, eventID)
 	if err != nil {
@@ -193,45 +373,79 @@ func (s *PaymentService) ProcessEventCancellationRefund(ctx context.Context, eve
 		return errors.New("event not found")
 	}
 
-	// Process refunds for all paid bookings
-	for _, booking := range bookings {
-		if booking.PaymentStatus == "paid" {
+	// Process refunds for all paid bookings, a page at a time
+	return s.bookings.ForEachByEvent(ctx, eventID, bookingPageSize, func(page []*bookings.Booking) error {
+		for _, booking := range page {
+			if booking.PaymentStatus != "paid" {
+				continue
+			}
+			// Claimed first, so a concurrent refund of the same booking is skipped
+			err := s.bookings.UpdatePaymentStatus(ctx, booking.ID, "paid", "refunding", nil)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				s.log.Error("Failed to claim refund", zap.Error(err), zap.String("booking_id", booking.ID))
+				continue
+			}
 			// Full refund for event cancellation
-			success := s.simulateRefundProcessing(booking.ID, booking.AmountPaid)
-			if success {
-				err = s.bookings.UpdatePaymentStatus(ctx, booking.ID, "refunded", booking.AmountPaid)
-				if err != nil {
-					s.log.Error("Failed to update refund status", zap.Error(err), zap.String("booking_id", booking.ID))
-				}
-			} else {
-				s.log.Error("Refund processing failed", zap.String("booking_id", booking.ID))
+			refund, err := s.refund(ctx, booking, booking.AmountPaid)
+			if err != nil {
+				s.log.Error("Refund processing failed", zap.Error(err), zap.String("booking_id", booking.ID))
+				s.releaseRefund(ctx, booking.ID)
+				continue
+			}
+			err = s.bookings.UpdatePaymentStatus(ctx, booking.ID, "refunding", "refunded", func(tx pgx.Tx) error {
+				return ledger.RefundTx(ctx, tx, booking.EventID, booking.ID, refund.ID, ledger.MoneyFromFloat(refund.Amount))
+			})
+			if err != nil {
+				s.log.Error("Failed to update refund status", zap.Error(err), zap.String("booking_id", booking.ID))
 			}
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-// Simulate payment processing (replace with real payment provider integration)
-func (s *PaymentService) simulatePaymentProcessing(paymentID string, amount float64) bool {
-	// In real implementation, this would call Stripe/PayPal API
-	s.log.Info("Processing payment", zap.String("payment_id", paymentID), zap.Float64("amount", amount))
-
-	// Simulate some processing time
-	time.Sleep(100 * time.Millisecond)
-
-	// Simulate 95% success rate
-	return true // Always succeed for demo
+// charge authorises and captures the amount in one go.
+func (s *PaymentService) charge(ctx context.Context, bookingID string, amount float64, cardToken string) (*payment.Intent, error) {
+	s.log.Info("Processing payment", zap.String("booking_id", bookingID), zap.Float64("amount", amount))
+	intent, err := s.provider.CreateIntent(ctx, payment.IntentRequest{
+		BookingID: bookingID,
+		Amount:    amount,
+		CardToken: cardToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.provider.Capture(ctx, intent.ID)
 }
 
-// Simulate refund processing (replace with real payment provider integration)
-func (s *PaymentService) simulateRefundProcessing(bookingID string, amount float64) bool {
-	// In real implementation, this would call Stripe/PayPal API
-	s.log.Info("Processing refund", zap.String("booking_id", bookingID), zap.Float64("amount", amount))
+// releaseRefund returns a booking claimed for a refund to paid after the gateway refused
+// the refund, so it can be retried. A booking whose refund went through but could not be
+// recorded stays refunding and is never refunded again.
+func (s *PaymentService) releaseRefund(ctx context.Context, bookingID string) {
+	if err := s.bookings.UpdatePaymentStatus(ctx, bookingID, "refunding", "paid", nil); err != nil {
+		s.log.Error("Failed to release refund claim", zap.Error(err), zap.String("booking_id", bookingID))
+	}
+}
 
-	// Simulate some processing time
-	time.Sleep(100 * time.Millisecond)
+// refund returns amount of the booking's payment through the gateway.
+func (s *PaymentService) refund(ctx context.Context, booking *bookings.Booking, amount float64) (*payment.Refund, error) {
+	if booking.PaymentIntentID == nil {
+		return nil, fmt.Errorf("booking %s has no payment intent to refund", booking.ID)
+	}
+	s.log.Info("Processing refund", zap.String("booking_id", booking.ID), zap.Float64("amount", amount))
+	return s.provider.Refund(ctx, *booking.PaymentIntentID, amount)
+}
 
-	// Simulate 95% success rate
-	return true // Always succeed for demo
+// GetPaymentStatus fetches the booking's payment intent from the gateway.
+func (s *PaymentService) GetPaymentStatus(ctx context.Context, bookingID string) (*payment.Intent, error) {
+	booking, err := s.bookings.GetByID(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil || booking.PaymentIntentID == nil {
+		return nil, ErrBookingNotFound
+	}
+	return s.provider.GetIntent(ctx, *booking.PaymentIntentID)
 }
@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/payment"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/ledger"
+)
+
+// countingProvider counts the refunds that reach the gateway.
+type countingProvider struct {
+	*payment.FakeProvider
+	refunds atomic.Int32
+}
+
+func (p *countingProvider) Refund(ctx context.Context, intentID string, amount float64) (*payment.Refund, error) {
+	p.refunds.Add(1)
+	return p.FakeProvider.Refund(ctx, intentID, amount)
+}
+
+// testService connects to the migrated database in TEST_POSTGRES_URL, or skips the test.
+// Every provider call is delayed so concurrent requests overlap.
+func testService(t *testing.T) (*PaymentService, *countingProvider, *store.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	db, err := store.NewDB(context.Background(), url, 10)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	log := zap.NewNop()
+	provider := &countingProvider{FakeProvider: payment.NewFakeProvider(payment.FakeConfig{Delay: 50 * time.Millisecond})}
+	svc := NewPaymentService(log, bookings.NewBookingsRepository(db, log), events.NewEventsRepository(db, log), nil,
+		provider, nil, ledger.NewLedgerRepository(db, log), "", "", "")
+	return svc, provider, db
+}
+
+// testBooking creates a cancelled booking paid through the provider; the rows are deleted
+// when the test ends. Ledger rows are append-only and stay.
+func testBooking(t *testing.T, db *store.DB, provider payment.PaymentProvider, amount, fee float64) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	intent, err := provider.CreateIntent(ctx, payment.IntentRequest{Amount: amount, CardToken: "tok_test"})
+	if err != nil {
+		t.Fatalf("create intent: %v", err)
+	}
+	if _, err := provider.Capture(ctx, intent.ID); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	var eventID, userID, bookingID string
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO events (name, capacity, cancellation_fee) VALUES ('refund test', 1, $1) RETURNING id
+	`, fee).Scan(&eventID)
+	if err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO users (email) VALUES ('refund-' || $1 || '@example.com') RETURNING id
+	`, eventID).Scan(&userID)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO bookings (user_id, event_id, status, amount_paid, payment_status, payment_intent_id)
+		VALUES ($1, $2, 'cancelled', $3, 'paid', $4) RETURNING id
+	`, userID, eventID, amount, intent.ID).Scan(&bookingID)
+	if err != nil {
+		t.Fatalf("create booking: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM bookings WHERE event_id = $1`, eventID)
+		db.Pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+		db.Pool.Exec(ctx, `DELETE FROM events WHERE id = $1`, eventID)
+	})
+	return bookingID, userID
+}
+
+func TestConcurrentCancellationRefundsRefundOnce(t *testing.T) {
+	svc, provider, db := testService(t)
+	ctx := context.Background()
+	bookingID, userID := testBooking(t, db, provider, 100, 10)
+
+	const n = 2
+	resps := make([]*PaymentResponse, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], errs[i] = svc.ProcessCancellationRefund(ctx, bookingID, userID)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, err := range errs {
+		switch {
+		case err == nil && resps[i].Success:
+			succeeded++
+		case errors.Is(err, ErrNotPaid):
+		default:
+			t.Fatalf("refund %d: %+v, %v", i, resps[i], err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d refunds succeeded, want 1", succeeded)
+	}
+	if got := provider.refunds.Load(); got != 1 {
+		t.Fatalf("provider refunded %d times, want 1", got)
+	}
+
+	var refunds int
+	var status string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM ledger_transactions WHERE booking_id = $1 AND kind = $2),
+		       (SELECT payment_status FROM bookings WHERE id = $1)
+	`, bookingID, ledger.KindRefund).Scan(&refunds, &status)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if refunds != 1 || status != "refunded" {
+		t.Fatalf("ledger has %d refunds and booking is %q, want 1 and refunded", refunds, status)
+	}
+}
@@ -0,0 +1,211 @@
+package tiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/tiers"
+)
+
+var ErrValidation = errors.New("validation error")
+
+type TiersService struct {
+	log    *zap.Logger
+	repo   *tiers.TiersRepository
+	tokens *redisx.TokenBucket
+}
+
+func NewTiersService(log *zap.Logger, repo *tiers.TiersRepository, tokens *redisx.TokenBucket) *TiersService {
+	return &TiersService{log: log, repo: repo, tokens: tokens}
+}
+
+type TierInput struct {
+	Name          string     `json:"name" binding:"required"`
+	Price         float64    `json:"price"`
+	Quota         int        `json:"quota"`
+	SaleStartsAt  *time.Time `json:"sale_starts_at"`
+	SaleEndsAt    *time.Time `json:"sale_ends_at"`
+	MaxPerBooking int        `json:"max_per_booking"`
+	// PriceZone binds the tier to the venue seats of that zone. Without it the tier can be
+	// picked by the buyer for any seat that is not bound to a tier.
+	PriceZone string `json:"price_zone"`
+}
+
+// QuoteLine is the part of a booking sold at one price. TierID is nil for seats sold at
+// the event's base ticket price.
+type QuoteLine struct {
+	TierID *string  `json:"tier_id,omitempty"`
+	Tier   string   `json:"tier"`
+	Price  float64  `json:"price"`
+	Seats  []string `json:"seats"`
+
+	tier *tiers.Tier
+}
+
+type Quote struct {
+	Lines []*QuoteLine `json:"lines"`
+	Total float64      `json:"total"`
+}
+
+// TierCounts returns the number of seats per tier, for reserving and releasing tier tokens.
+func (q *Quote) TierCounts() map[string]int {
+	counts := map[string]int{}
+	for _, l := range q.Lines {
+		if l.TierID != nil {
+			counts[*l.TierID] += len(l.Seats)
+		}
+	}
+	return counts
+}
+
+// Validate checks a tier definition for an event.
+func Validate(event *events.Event, in TierInput) error {
+	if strings.TrimSpace(in.Name) == "" {
+		return fmt.Errorf("%w: tier name is required", ErrValidation)
+	}
+	if in.Price < 0 {
+		return fmt.Errorf("%w: tier %s has a negative price", ErrValidation, in.Name)
+	}
+	if in.Quota < 0 || (in.Quota == 0 && in.PriceZone == "") {
+		return fmt.Errorf("%w: tier %s needs a positive quota", ErrValidation, in.Name)
+	}
+	if in.Quota > event.Capacity {
+		return fmt.Errorf("%w: quota of tier %s exceeds event capacity", ErrValidation, in.Name)
+	}
+	if in.MaxPerBooking < 0 {
+		return fmt.Errorf("%w: max_per_booking of tier %s must not be negative", ErrValidation, in.Name)
+	}
+	if in.SaleStartsAt != nil && in.SaleEndsAt != nil && !in.SaleEndsAt.After(*in.SaleStartsAt) {
+		return fmt.Errorf("%w: sale window of tier %s ends before it starts", ErrValidation, in.Name)
+	}
+	if in.PriceZone != "" && event.VenueID == nil {
+		return fmt.Errorf("%w: tier %s has a price zone but the event has no venue", ErrValidation, in.Name)
+	}
+	return nil
+}
+
+// Create adds a tier to the event and initialises its tokens. apply is called with the
+// tier in the transaction that creates it.
+func (s *TiersService) Create(ctx context.Context, event *events.Event, in TierInput, apply func(tx pgx.Tx, t *tiers.Tier) error) (*tiers.Tier, error) {
+	if err := Validate(event, in); err != nil {
+		return nil, err
+	}
+	t := &tiers.Tier{
+		EventID:       event.ID,
+		Name:          strings.TrimSpace(in.Name),
+		Price:         in.Price,
+		Quota:         in.Quota,
+		SaleStartsAt:  in.SaleStartsAt,
+		SaleEndsAt:    in.SaleEndsAt,
+		MaxPerBooking: in.MaxPerBooking,
+		PriceZone:     in.PriceZone,
+	}
+	_, err := s.repo.Create(ctx, t, func(tx pgx.Tx) error { return apply(tx, t) })
+	if errors.Is(err, tiers.ErrEmptyZone) || errors.Is(err, tiers.ErrQuotaExceedsZone) {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokens.InitTierTokens(ctx, event.ID, t.ID, t.Quota); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *TiersService) List(ctx context.Context, eventID string) ([]*tiers.Tier, error) {
+	return s.repo.ListByEvent(ctx, eventID)
+}
+
+// SeatTiers returns the tier each of the given seats is bound to.
+func (s *TiersService) SeatTiers(ctx context.Context, eventID string, labels []string) (map[string]string, error) {
+	return s.repo.SeatTiers(ctx, eventID, labels)
+}
+
+// Quote prices the seats. A seat bound to a zone tier is sold at that tier; any other
+// seat is sold at the requested tier, or at the event's base price if none was requested.
+func (s *TiersService) Quote(ctx context.Context, event *events.Event, tierID *string, seats []string) (*Quote, error) {
+	all, err := s.repo.ListByEvent(ctx, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*tiers.Tier, len(all))
+	for _, t := range all {
+		byID[t.ID] = t
+	}
+
+	var requested *tiers.Tier
+	if tierID != nil && *tierID != "" {
+		requested = byID[*tierID]
+		if requested == nil {
+			return nil, fmt.Errorf("%w: ticket tier not found for this event", ErrValidation)
+		}
+	}
+
+	bound := map[string]string{}
+	if len(all) > 0 {
+		if bound, err = s.repo.SeatTiers(ctx, event.ID, seats); err != nil {
+			return nil, err
+		}
+	}
+
+	q := &Quote{}
+	lines := map[string]*QuoteLine{}
+	for _, label := range seats {
+		t := byID[bound[label]]
+		if t == nil && requested != nil {
+			if requested.PriceZone != "" {
+				return nil, fmt.Errorf("%w: seat %s is not in tier %s", ErrValidation, label, requested.Name)
+			}
+			t = requested
+		}
+
+		key := ""
+		if t != nil {
+			key = t.ID
+		}
+		line := lines[key]
+		if line == nil {
+			line = &QuoteLine{Tier: "standard", Price: event.TicketPrice}
+			if t != nil {
+				id := t.ID
+				line = &QuoteLine{TierID: &id, Tier: t.Name, Price: t.Price, tier: t}
+			}
+			lines[key] = line
+			q.Lines = append(q.Lines, line)
+		}
+		line.Seats = append(line.Seats, label)
+		q.Total += line.Price
+	}
+	q.Total = math.Round(q.Total*100) / 100
+	return q, nil
+}
+
+// CheckPurchasable enforces each tier's sale window and per-booking limit.
+func CheckPurchasable(q *Quote, now time.Time) error {
+	for _, l := range q.Lines {
+		t := l.tier
+		if t == nil {
+			continue
+		}
+		if t.SaleStartsAt != nil && now.Before(*t.SaleStartsAt) {
+			return fmt.Errorf("%w: sales for tier %s have not started", ErrValidation, t.Name)
+		}
+		if t.SaleEndsAt != nil && !now.Before(*t.SaleEndsAt) {
+			return fmt.Errorf("%w: sales for tier %s have ended", ErrValidation, t.Name)
+		}
+		if t.MaxPerBooking > 0 && len(l.Seats) > t.MaxPerBooking {
+			return fmt.Errorf("%w: cannot book more than %d %s tickets", ErrValidation, t.MaxPerBooking, t.Name)
+		}
+	}
+	return nil
+}
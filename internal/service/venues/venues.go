@@ -0,0 +1,152 @@
+package venues
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/venues"
+)
+
+var ErrValidation = errors.New("validation error")
+
+type VenuesService struct {
+	log  *zap.Logger
+	repo *venues.VenuesRepository
+}
+
+func NewVenuesService(log *zap.Logger, repo *venues.VenuesRepository) *VenuesService {
+	return &VenuesService{log: log, repo: repo}
+}
+
+type VenueInput struct {
+	Name     string          `json:"name" binding:"required"`
+	Address  string          `json:"address"`
+	Metadata json.RawMessage `json:"metadata"`
+	Sections []SectionInput  `json:"sections"`
+}
+
+type SectionInput struct {
+	Name      string     `json:"name"`
+	PriceZone string     `json:"price_zone"`
+	Rows      []RowInput `json:"rows"`
+}
+
+// RowInput describes a row either by SeatCount, generating seats 1..SeatCount laid out
+// on a unit grid, or by listing its Seats explicitly.
+type RowInput struct {
+	Label     string      `json:"label"`
+	SeatCount int         `json:"seat_count"`
+	Seats     []SeatInput `json:"seats"`
+}
+
+type SeatInput struct {
+	Number     int     `json:"number"`
+	Label      string  `json:"label"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Accessible bool    `json:"accessible"`
+	PriceZone  string  `json:"price_zone"`
+}
+
+func (s *VenuesService) Create(ctx context.Context, in VenueInput) (*venues.Venue, error) {
+	v, err := buildVenue(in)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Create(ctx, v)
+}
+
+func (s *VenuesService) Get(ctx context.Context, id string) (*venues.Venue, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *VenuesService) List(ctx context.Context, limit, offset int) ([]*venues.Venue, error) {
+	return s.repo.List(ctx, limit, offset)
+}
+
+func (s *VenuesService) Update(ctx context.Context, id string, in VenueInput) error {
+	if len(in.Sections) > 0 {
+		return fmt.Errorf("%w: the seat layout of a venue cannot be changed, create a new venue instead", ErrValidation)
+	}
+	return s.repo.Update(ctx, id, in.Name, in.Address, in.Metadata)
+}
+
+func (s *VenuesService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// buildVenue validates the layout and expands it into the stored model. Seats without an
+// explicit label are labelled "<section>-<row><number>", e.g. "Stalls-A12".
+func buildVenue(in VenueInput) (*venues.Venue, error) {
+	if len(in.Sections) == 0 {
+		return nil, fmt.Errorf("%w: a venue needs at least one section", ErrValidation)
+	}
+
+	v := &venues.Venue{Name: in.Name, Address: in.Address, Metadata: in.Metadata}
+	sectionNames := map[string]bool{}
+	labels := map[string]bool{}
+	for _, sec := range in.Sections {
+		name := strings.TrimSpace(sec.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: section name is required", ErrValidation)
+		}
+		if sectionNames[name] {
+			return nil, fmt.Errorf("%w: duplicate section %s", ErrValidation, name)
+		}
+		sectionNames[name] = true
+		if len(sec.Rows) == 0 {
+			return nil, fmt.Errorf("%w: section %s has no rows", ErrValidation, name)
+		}
+
+		section := &venues.Section{Name: name, PriceZone: sec.PriceZone}
+		for rowIdx, r := range sec.Rows {
+			rowLabel := strings.TrimSpace(r.Label)
+			if rowLabel == "" {
+				return nil, fmt.Errorf("%w: row label is required in section %s", ErrValidation, name)
+			}
+
+			seats := r.Seats
+			if len(seats) == 0 {
+				if r.SeatCount <= 0 {
+					return nil, fmt.Errorf("%w: row %s in section %s has no seats", ErrValidation, rowLabel, name)
+				}
+				seats = make([]SeatInput, r.SeatCount)
+				for i := range seats {
+					seats[i] = SeatInput{Number: i + 1, X: float64(i), Y: float64(rowIdx)}
+				}
+			}
+
+			row := &venues.Row{Label: rowLabel}
+			for _, st := range seats {
+				if st.Number <= 0 {
+					return nil, fmt.Errorf("%w: seat numbers in row %s of section %s must be positive", ErrValidation, rowLabel, name)
+				}
+				label := st.Label
+				if label == "" {
+					label = fmt.Sprintf("%s-%s%d", name, rowLabel, st.Number)
+				}
+				if labels[label] {
+					return nil, fmt.Errorf("%w: duplicate seat label %s", ErrValidation, label)
+				}
+				labels[label] = true
+
+				row.Seats = append(row.Seats, &venues.Seat{
+					Number:     st.Number,
+					Label:      label,
+					X:          st.X,
+					Y:          st.Y,
+					Accessible: st.Accessible,
+					PriceZone:  st.PriceZone,
+				})
+			}
+			section.Rows = append(section.Rows, row)
+		}
+		v.Sections = append(v.Sections, section)
+	}
+	return v, nil
+}
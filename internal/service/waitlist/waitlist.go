@@ -0,0 +1,136 @@
+package waitlist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
+)
+
+const (
+	// eventRateWindow and globalRateWindow are how far back promotions are counted for the
+	// wait estimate; the event's own history is preferred when it has enough promotions.
+	eventRateWindow  = 7 * 24 * time.Hour
+	globalRateWindow = 30 * 24 * time.Hour
+	minPromotions    = 3
+)
+
+var ErrNotWaiting = errors.New("not on the waitlist")
+
+// Position is the caller's place on a waitlist with an estimate of the wait.
+type Position struct {
+	EventID           string    `json:"event_id"`
+	Position          int       `json:"position"`
+	Ahead             int       `json:"ahead"`
+	Priority          int       `json:"priority"`
+	JoinedAt          time.Time `json:"joined_at"`
+	OfferPending      bool      `json:"offer_pending"`
+	PromotionsPerHour float64   `json:"promotions_per_hour"`
+	// EstimatedWaitSeconds is nil when there is no promotion history to go by
+	EstimatedWaitSeconds *int64 `json:"estimated_wait_seconds"`
+	EstimateBasis        string `json:"estimate_basis"`
+}
+
+// Entry is a waitlist entry as listed publicly. Priorities and priority groups say why a
+// user ranks where they do, so only admins and the event's organizers see them.
+type Entry struct {
+	ID         string `json:"id"`
+	EventID    string `json:"event_id"`
+	UserID     string `json:"user_id"`
+	Position   int    `json:"position"`
+	OptedOut   bool   `json:"opted_out"`
+	NotifiedAt string `json:"notified_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type WaitlistService struct {
+	log  *zap.Logger
+	repo *waitlist.WaitlistRepository
+}
+
+func NewWaitlistService(log *zap.Logger, repo *waitlist.WaitlistRepository) *WaitlistService {
+	return &WaitlistService{log: log, repo: repo}
+}
+
+func (s *WaitlistService) Join(ctx context.Context, eventID, userID string) (int, error) {
+	return s.repo.Add(ctx, eventID, userID)
+}
+
+func (s *WaitlistService) OptOut(ctx context.Context, eventID, userID string) error {
+	return s.repo.OptOut(ctx, eventID, userID)
+}
+
+func (s *WaitlistService) Count(ctx context.Context, eventID string) (int, error) {
+	return s.repo.Count(ctx, eventID)
+}
+
+// List returns the event's waitlist in promotion order without priority details.
+func (s *WaitlistService) List(ctx context.Context, eventID string, limit, offset int) ([]*Entry, error) {
+	entries, err := s.repo.ListByEvent(ctx, eventID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, &Entry{
+			ID:         e.ID,
+			EventID:    e.EventID,
+			UserID:     e.UserID,
+			Position:   e.Position,
+			OptedOut:   e.OptedOut,
+			NotifiedAt: e.NotifiedAt,
+			CreatedAt:  e.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+// Position returns the user's effective position and estimates the wait from the rate at
+// which the waitlist has been promoting people.
+func (s *WaitlistService) Position(ctx context.Context, eventID, userID string) (*Position, error) {
+	st, err := s.repo.Standing(ctx, eventID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, ErrNotWaiting
+	}
+	p := &Position{
+		EventID:       eventID,
+		Position:      st.Position,
+		Ahead:         st.Ahead,
+		Priority:      st.Priority,
+		JoinedAt:      st.JoinedAt,
+		OfferPending:  st.OfferPending,
+		EstimateBasis: "none",
+	}
+	if st.OfferPending {
+		zero := int64(0)
+		p.EstimatedWaitSeconds = &zero
+		p.EstimateBasis = "offer_pending"
+		return p, nil
+	}
+
+	now := time.Now()
+	rate, basis := 0.0, ""
+	if n, err := s.repo.Promotions(ctx, eventID, now.Add(-eventRateWindow)); err != nil {
+		return nil, err
+	} else if n >= minPromotions {
+		rate, basis = float64(n)/eventRateWindow.Hours(), "event"
+	} else if n, err := s.repo.Promotions(ctx, "", now.Add(-globalRateWindow)); err != nil {
+		return nil, err
+	} else if n >= minPromotions {
+		rate, basis = float64(n)/globalRateWindow.Hours(), "all_events"
+	}
+	if rate > 0 {
+		// Everyone ahead gets an offer before we do, then ours is the next one
+		wait := int64(float64(st.Ahead+1) / rate * 3600)
+		p.PromotionsPerHour = rate
+		p.EstimatedWaitSeconds = &wait
+		p.EstimateBasis = basis
+	}
+	return p, nil
+}
@@ -3,28 +3,34 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/samirwankhede/lewly-pgpyewj/internal/payment"
+
 	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
 	mailerService "github.com/samirwankhede/lewly-pgpyewj/internal/service/mailer"
+	tiersService "github.com/samirwankhede/lewly-pgpyewj/internal/service/tiers"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/events"
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
-	"github.com/samirwankhede/lewly-pgpyewj/internal/store/waitlist"
 )
 
 type FinalizeService struct {
-	log           *zap.Logger
-	bookings      *bookings.BookingsRepository
-	events        *events.EventsRepository
-	users         *users.UsersRepository
-	waitlist      *waitlist.WaitlistRepository
-	paymentURL    string
-	mailer        *mailerService.MailerService
-	timeoutBucket *redisx.TimeoutBucket
+	log            *zap.Logger
+	bookings       *bookings.BookingsRepository
+	events         *events.EventsRepository
+	users          *users.UsersRepository
+	offers         *bookingsService.OffersService
+	tiers          *tiersService.TiersService
+	paymentURL     string
+	checkoutSecret string
+	mailer         *mailerService.MailerService
+	timeoutBucket  *redisx.TimeoutBucket
 }
 
 type FinalizePayload struct {
@@ -34,18 +40,22 @@ type FinalizePayload struct {
 	UserID         string   `json:"user_id"`
 	Seats          []string `json:"seats"`
 	IdempotencyKey *string  `json:"idempotency_key"`
+	// PaymentDeadline is set when the booking is created and matches its seat holds
+	PaymentDeadline *time.Time `json:"payment_deadline,omitempty"`
 }
 
-func NewFinalizeService(log *zap.Logger, bookings *bookings.BookingsRepository, events *events.EventsRepository, users *users.UsersRepository, waitlist *waitlist.WaitlistRepository, paymentURL string, mailer *mailerService.MailerService, timeoutBucket *redisx.TimeoutBucket) *FinalizeService {
+func NewFinalizeService(log *zap.Logger, bookings *bookings.BookingsRepository, events *events.EventsRepository, users *users.UsersRepository, offers *bookingsService.OffersService, tiers *tiersService.TiersService, paymentURL, checkoutSecret string, mailer *mailerService.MailerService, timeoutBucket *redisx.TimeoutBucket) *FinalizeService {
 	return &FinalizeService{
-		log:           log,
-		bookings:      bookings,
-		events:        events,
-		users:         users,
-		waitlist:      waitlist,
-		paymentURL:    paymentURL,
-		mailer:        mailer,
-		timeoutBucket: timeoutBucket,
+		log:            log,
+		bookings:       bookings,
+		events:         events,
+		users:          users,
+		offers:         offers,
+		tiers:          tiers,
+		paymentURL:     paymentURL,
+		checkoutSecret: checkoutSecret,
+		mailer:         mailer,
+		timeoutBucket:  timeoutBucket,
 	}
 }
 
@@ -72,11 +82,13 @@ func (s *FinalizeService) HandleBookingFinalization(ctx context.Context, payload
 		return fmt.Errorf("event not found: %s", payload.EventID)
 	}
 
-	// Calculate amount based on seats
-	amount := event.TicketPrice * float64(len(payload.Seats))
-
-	// Generate payment link
-	paymentLink := fmt.Sprintf("%s/v1/payment/booking?booking_id=%s&amount=%.2f&payment_id=%s", s.paymentURL, payload.BookingID, amount, payload.BookingID)
+	// Price the seats at their ticket tiers
+	quote, err := s.tiers.Quote(ctx, event, booking.TierID, payload.Seats)
+	if err != nil {
+		s.log.Error("Failed to price booking", zap.Error(err), zap.String("booking_id", payload.BookingID))
+		return err
+	}
+	amount := quote.Total
 
 	// Hello Evaluator I've pondered over using redis, but over a network with not 'hot' objects like session tokens and decent partitions I haven't implemented cached mappings of event+userid -> email though in production I believe such will be needed
 	// Currently I believe the complexity will increase without much effectiveness so this user email fetching is more focused on HLD and functionality
@@ -86,6 +98,20 @@ func (s *FinalizeService) HandleBookingFinalization(ctx context.Context, payload
 		return fmt.Errorf("user not found: %s", payload.UserID)
 	}
 	userEmail := user.Email
+
+	// Schedule timeout before emailing so a failed send can never leave the booking without a deadline
+	deadline := time.Now().Add(bookingsService.PaymentWindow)
+	if payload.PaymentDeadline != nil {
+		deadline = *payload.PaymentDeadline
+	}
+	if err := s.scheduleBookingTimeout(ctx, payload.BookingID, payload.EventID, payload.UserID, payload.Seats, deadline); err != nil {
+		s.log.Error("Failed to schedule booking timeout", zap.Error(err), zap.String("booking_id", payload.BookingID))
+		return err
+	}
+
+	// Signed checkout link, valid until the booking's payment deadline
+	paymentLink := payment.CheckoutLink(s.paymentURL, s.checkoutSecret, payload.BookingID, amount, deadline)
+
 	// Send payment request email
 	err = s.mailer.SendPaymentRequestEmail(userEmail, event.Name, amount, paymentLink)
 	if err != nil {
@@ -93,9 +119,6 @@ func (s *FinalizeService) HandleBookingFinalization(ctx context.Context, payload
 		return fmt.Errorf("failed to send payment request email")
 	}
 
-	// Schedule timeout for new booking
-	s.scheduleBookingTimeout(ctx, payload.BookingID, payload.EventID, payload.UserID, payload.Seats)
-
 	return nil
 }
 
@@ -107,8 +130,9 @@ func (s *FinalizeService) HandleBookingTimeout(ctx context.Context, payload Fina
 		return err
 	}
 	if booking == nil {
-		s.log.Error("Booking not found", zap.String("booking_id", payload.BookingID))
-		return fmt.Errorf("booking not found: %s", payload.BookingID)
+		// Nothing left to expire, retrying would never succeed
+		s.log.Warn("Booking not found, skipping timeout", zap.String("booking_id", payload.BookingID))
+		return nil
 	}
 
 	// Check if booking is still pending
@@ -119,110 +143,58 @@ func (s *FinalizeService) HandleBookingTimeout(ctx context.Context, payload Fina
 		return nil
 	}
 
-	// Cancel the booking
-	_, _, err = s.bookings.CancelBookingTx(ctx, payload.BookingID)
+	// Cancel the booking, releasing its seat holds. The freed seats are recorded in the same
+	// transaction, so their tokens are handed on even if this worker stops right after.
+	_, _, rel, err := s.bookings.CancelBookingTx(ctx, payload.BookingID)
+	if errors.Is(err, bookings.ErrNotCancellable) {
+		// Paid or cancelled while we were looking at it
+		return nil
+	}
 	if err != nil {
 		s.log.Error("Failed to cancel booking", zap.Error(err), zap.String("booking_id", payload.BookingID))
 		return err
 	}
 
-	// Get event details
-	event, err := s.events.Get(ctx, payload.EventID)
-	if err != nil {
-		s.log.Error("Failed to get event", zap.Error(err), zap.String("event_id", payload.EventID))
-		return err
-	}
-	if event == nil {
-		s.log.Error("Event not found", zap.String("event_id", payload.EventID))
-		return fmt.Errorf("event not found: %s", payload.EventID)
+	// The seats' tokens go to a waitlist offer, or back to the bucket. A failed hand-off is
+	// retried from the release by the worker's release scheduler.
+	if err := s.offers.HandOff(ctx, rel); err != nil {
+		s.log.Error("Failed to hand off expired seats", zap.Error(err), zap.String("booking_id", payload.BookingID))
 	}
+	return nil
+}
 
-	// Promote next person from waitlist
-	userID, _, position, err := s.waitlist.NextActive(ctx, payload.EventID)
-	if err != nil {
-		s.log.Error("Failed to get next waitlist user", zap.Error(err), zap.String("event_id", payload.EventID))
-		return err
+// HandleDueTimeout expires a booking claimed from the timeout scheduler and removes it
+// from the scheduler once handled. On error the entry stays leased and is retried after
+// the lease runs out.
+func (s *FinalizeService) HandleDueTimeout(ctx context.Context, due redisx.DueTimeout) error {
+	payload := FinalizePayload{
+		Type:      "booking_timeout",
+		BookingID: due.BookingID,
+		EventID:   due.EventID,
 	}
-
-	if userID != "" {
-		// Create new pending booking for waitlist user
-		seatsJSON, _ := json.Marshal(payload.Seats)
-		newBooking, err := s.bookings.CreatePending(ctx, userID, payload.EventID, nil, seatsJSON)
-		if err != nil {
-			s.log.Error("Failed to create booking for waitlist user", zap.Error(err))
-			return err
-		}
-
-		// Calculate amount for new booking
-		amount := event.TicketPrice * float64(len(payload.Seats))
-		paymentLink := fmt.Sprintf("%s/v1/payment/booking?booking_id=%s&amount=%.2f&payment_id=%s", s.paymentURL, newBooking.ID, amount, newBooking.ID)
-
-		// Send waitlist promotion email
-		user, err := s.users.GetByID(ctx, payload.UserID)
-		if err != nil {
-			s.log.Error("User not found", zap.String("user_id", payload.UserID))
-			return fmt.Errorf("user not found: %s", payload.UserID)
-		}
-		userEmail := user.Email
-
-		err = s.mailer.SendWaitlistPromotionEmail(userEmail, event.Name)
-		if err != nil {
-			s.log.Error("Failed to send waitlist promotion email", zap.Error(err))
-			// Don't return error, continue processing
-		}
-		err = s.mailer.SendPaymentRequestEmail(userEmail, event.Name, amount, paymentLink)
-		if err != nil {
-			s.log.Error("Failed to send payment request email", zap.Error(err))
-			return fmt.Errorf("failed to send payment request email")
+	if len(due.Payload) > 0 {
+		if err := json.Unmarshal(due.Payload, &payload); err != nil {
+			s.log.Error("Failed to parse timeout payload", zap.Error(err), zap.String("booking_id", due.BookingID))
 		}
-
-		// Schedule timeout for new booking
-		s.scheduleBookingTimeout(ctx, newBooking.ID, payload.EventID, userID, payload.Seats)
-
-		s.log.Info("Promoted waitlist user",
-			zap.String("old_booking_id", payload.BookingID),
-			zap.String("new_booking_id", newBooking.ID),
-			zap.String("user_id", userID),
-			zap.Int("position", position))
-	} else {
-		s.log.Info("No users in waitlist to promote", zap.String("event_id", payload.EventID))
 	}
 
-	return nil
+	if err := s.HandleBookingTimeout(ctx, payload); err != nil {
+		return err
+	}
+	return s.timeoutBucket.Complete(ctx, due.EventID, due.BookingID)
 }
 
-func (s *FinalizeService) scheduleBookingTimeout(ctx context.Context, bookingID, eventID, userID string, seats []string) {
-	go func() {
-		err := s.timeoutBucket.AddBooking(ctx, eventID, bookingID)
-		if err != nil {
-			s.log.Error("Failed to set payment timeout", zap.Error(err))
-		}
-
-		time.Sleep(15 * time.Minute)
-
-		timeoutPayload := FinalizePayload{
-			Type:      "booking_timeout",
-			BookingID: bookingID,
-			EventID:   eventID,
-			UserID:    userID,
-			Seats:     seats,
-		}
-
-		v, err := s.timeoutBucket.GetBooking(ctx, eventID, bookingID)
-		if err != nil {
-			s.log.Error("Failed to get payment timeout", zap.Error(err))
-		}
-		if v != "processed" {
-			// Process the timeout
-			err = s.HandleBookingTimeout(ctx, timeoutPayload)
-			if err != nil {
-				s.log.Error("Failed to process booking timeout", zap.Error(err), zap.String("booking_id", bookingID))
-			}
-		}
-		_, err = s.timeoutBucket.DeleteBooking(ctx, eventID, bookingID)
-		if err != nil {
-			s.log.Error("Failed to Delete timeout bucket", zap.Error(err))
-		}
-
-	}()
+func (s *FinalizeService) scheduleBookingTimeout(ctx context.Context, bookingID, eventID, userID string, seats []string, deadline time.Time) error {
+	timeoutPayload := FinalizePayload{
+		Type:      "booking_timeout",
+		BookingID: bookingID,
+		EventID:   eventID,
+		UserID:    userID,
+		Seats:     seats,
+	}
+	by, err := json.Marshal(timeoutPayload)
+	if err != nil {
+		return err
+	}
+	return s.timeoutBucket.Schedule(ctx, eventID, bookingID, by, deadline)
 }
@@ -2,18 +2,19 @@ package admin
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/users"
 )
 
 type AdminRepository struct {
-	db  *store.DB
-	log *zap.Logger
+	db    *store.DB
+	log   *zap.Logger
+	roles RoleCache
 }
 
 func NewAdminRepository(db *store.DB, log *zap.Logger) *AdminRepository {
@@ -35,7 +36,9 @@ type PopularEvent struct {
 	Likes    int    `json:"likes"`
 }
 
-func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*AnalyticsSummary, error) {
+// GetSummary summarizes activity between from and to. With an organizer it only covers the
+// events they organize, and TotalUsers counts the users who booked them.
+func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time, organizer *string) (*AnalyticsSummary, error) {
 	summary := &AnalyticsSummary{}
 
 	// Get total bookings
@@ -43,7 +46,8 @@ func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*
 		SELECT COUNT(*) 
 		FROM bookings 
 		WHERE created_at BETWEEN $1 AND $2 AND status = 'booked'
-	`, from, to).Scan(&summary.TotalBookings)
+		  AND ($3::uuid IS NULL OR event_id IN (SELECT event_id FROM event_organizers WHERE user_id = $3))
+	`, from, to, organizer).Scan(&summary.TotalBookings)
 	if err != nil {
 		return nil, err
 	}
@@ -53,17 +57,27 @@ func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*
 		SELECT COUNT(*) 
 		FROM events 
 		WHERE created_at BETWEEN $1 AND $2
-	`, from, to).Scan(&summary.TotalEvents)
+		  AND ($3::uuid IS NULL OR id IN (SELECT event_id FROM event_organizers WHERE user_id = $3))
+	`, from, to, organizer).Scan(&summary.TotalEvents)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get total users
-	err = r.db.Pool.QueryRow(ctx, `
-		SELECT COUNT(*) 
-		FROM users 
-		WHERE created_at BETWEEN $1 AND $2
-	`, from, to).Scan(&summary.TotalUsers)
+	if organizer == nil {
+		err = r.db.Pool.QueryRow(ctx, `
+			SELECT COUNT(*) 
+			FROM users 
+			WHERE created_at BETWEEN $1 AND $2
+		`, from, to).Scan(&summary.TotalUsers)
+	} else {
+		err = r.db.Pool.QueryRow(ctx, `
+			SELECT COUNT(DISTINCT user_id)
+			FROM bookings
+			WHERE created_at BETWEEN $1 AND $2 AND status = 'booked'
+			  AND event_id IN (SELECT event_id FROM event_organizers WHERE user_id = $3)
+		`, from, to, *organizer).Scan(&summary.TotalUsers)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +92,8 @@ func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*
 			END
 		FROM events 
 		WHERE created_at BETWEEN $1 AND $2
-	`, from, to).Scan(&summary.CapacityUtilization)
+		  AND ($3::uuid IS NULL OR id IN (SELECT event_id FROM event_organizers WHERE user_id = $3))
+	`, from, to, organizer).Scan(&summary.CapacityUtilization)
 	if err != nil {
 		return nil, err
 	}
@@ -89,10 +104,11 @@ func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*
 		FROM events e
 		LEFT JOIN bookings b ON e.id = b.event_id AND b.status = 'booked' AND b.created_at BETWEEN $1 AND $2
 		WHERE e.created_at BETWEEN $1 AND $2
+		  AND ($3::uuid IS NULL OR e.id IN (SELECT event_id FROM event_organizers WHERE user_id = $3))
 		GROUP BY e.id, e.name, e.likes
 		ORDER BY bookings DESC, e.likes DESC
 		LIMIT 10
-	`, from, to)
+	`, from, to, organizer)
 	if err != nil {
 		return nil, err
 	}
@@ -110,10 +126,18 @@ func (r *AdminRepository) GetSummary(ctx context.Context, from, to time.Time) (*
 	return summary, nil
 }
 
-func (r *AdminRepository) CancelEvent(ctx context.Context, eventID string) error {
+// CancelEvent cancels the event with its bookings and waitlist and calls apply with the
+// status it had, in the same transaction. pgx.ErrNoRows is returned for an unknown event.
+func (r *AdminRepository) CancelEvent(ctx context.Context, eventID string, apply func(tx pgx.Tx, previousStatus string) error) error {
 	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var previous string
+		err := tx.QueryRow(ctx, `SELECT status FROM events WHERE id = $1 FOR UPDATE`, eventID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+
 		// Update event status
-		_, err := tx.Exec(ctx, `
+		_, err = tx.Exec(ctx, `
 			UPDATE events 
 			SET status = 'cancelled', updated_at = now() 
 			WHERE id = $1
@@ -141,81 +165,40 @@ func (r *AdminRepository) CancelEvent(ctx context.Context, eventID string) error
 		if err != nil {
 			return err
 		}
-		return err
+		return apply(tx, previous)
 	})
 }
 
-func (r *AdminRepository) UpdateEvent(ctx context.Context, eventID string, updates map[string]interface{}) error {
-	// Build dynamic update query
-	query := "UPDATE events SET "
-	args := []interface{}{}
-	argIndex := 1
-
-	for field, value := range updates {
-		if argIndex > 1 {
-			query += ", "
-		}
-		query += field + " = $" + fmt.Sprintf("%d", argIndex)
-		args = append(args, value)
-		argIndex++
-	}
-
-	query += ", updated_at = now() WHERE id = $" + fmt.Sprintf("%d", argIndex)
-	args = append(args, eventID)
-
-	result, err := r.db.Pool.Exec(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
-	}
-
-	return nil
+func (r *AdminRepository) CreateAdminFromUser(ctx context.Context, userID string, apply func(tx pgx.Tx, previous string) error) error {
+	return r.setRole(ctx, userID, "admin", "", apply)
 }
 
-func (r *AdminRepository) CreateAdminFromUser(ctx context.Context, userID string) error {
-	query := `UPDATE users SET role = 'admin', updated_at = now() WHERE id = $1`
-
-	result, err := r.db.Pool.Exec(ctx, query, userID)
-	if err != nil {
-		return err
-	}
-
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
-	}
-
-	return nil
+func (r *AdminRepository) RemoveAdmin(ctx context.Context, userID string, apply func(tx pgx.Tx, previous string) error) error {
+	return r.setRole(ctx, userID, "user", "admin", apply)
 }
 
-func (r *AdminRepository) RemoveAdmin(ctx context.Context, userID string) error {
-	query := `UPDATE users SET role = 'user', updated_at = now() WHERE id = $1 AND role = 'admin'`
-
-	result, err := r.db.Pool.Exec(ctx, query, userID)
-	if err != nil {
-		return err
-	}
-
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
-	}
-
-	return nil
-}
-
-func (r *AdminRepository) RemoveUser(ctx context.Context, userID string) error {
-	query := `DELETE FROM users WHERE id = $1 AND role != 'admin'`
-
-	result, err := r.db.Pool.Exec(ctx, query, userID)
+// RemoveUser deletes a user who is not an admin and calls apply with the deleted user, in
+// the same transaction. pgx.ErrNoRows is returned if there is no such user or they are
+// an admin.
+func (r *AdminRepository) RemoveUser(ctx context.Context, userID string, apply func(tx pgx.Tx, removed *users.User) error) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		u := &users.User{}
+		err := tx.QueryRow(ctx, `
+			DELETE FROM users WHERE id = $1 AND role != 'admin'
+			RETURNING id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, email_verified_at, created_at, updated_at
+		`, userID).Scan(
+			&u.ID, &u.Name, &u.Email, &u.Phone, &u.PasswordHash,
+			&u.OAuthProvider, &u.OAuthSub, &u.Role, &u.EmailVerifiedAt, &u.CreatedAt, &u.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		return apply(tx, u)
+	})
 	if err != nil {
 		return err
 	}
 
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
-	}
-
+	r.roleChanged(ctx, userID)
 	return nil
 }
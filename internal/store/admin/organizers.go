@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles a user can have on an event they organize.
+const (
+	EventOwner  = "owner"
+	EventMember = "member"
+)
+
+// EventOrganizer is a user allowed to manage an event.
+type EventOrganizer struct {
+	EventID   string    `json:"event_id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	AddedBy   *string   `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *AdminRepository) CreateOrganizerFromUser(ctx context.Context, userID string, apply func(tx pgx.Tx, previous string) error) error {
+	return r.setRole(ctx, userID, "organizer", "user", apply)
+}
+
+// RemoveOrganizer turns an organizer back into a user. Their event memberships are kept
+// but give no access unless they become an organizer again.
+func (r *AdminRepository) RemoveOrganizer(ctx context.Context, userID string, apply func(tx pgx.Tx, previous string) error) error {
+	return r.setRole(ctx, userID, "user", "organizer", apply)
+}
+
+// EventOrganizerRole returns the user's role on the event, or "" if they do not organize it.
+func (r *AdminRepository) EventOrganizerRole(ctx context.Context, eventID, userID string) (string, error) {
+	var role string
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT role FROM event_organizers WHERE event_id = $1 AND user_id = $2
+	`, eventID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// AddEventOrganizerTx makes the user an organizer of the event inside the caller's
+// transaction. Adding an existing organizer changes nothing.
+func AddEventOrganizerTx(ctx context.Context, tx pgx.Tx, eventID, userID, role, addedBy string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO event_organizers (event_id, user_id, role, added_by)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+		ON CONFLICT (event_id, user_id) DO NOTHING
+	`, eventID, userID, role, addedBy)
+	return err
+}
+
+// AddEventOrganizer makes the user an organizer of the event and calls apply in the same
+// transaction.
+func (r *AdminRepository) AddEventOrganizer(ctx context.Context, eventID, userID, role, addedBy string, apply func(tx pgx.Tx) error) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := AddEventOrganizerTx(ctx, tx, eventID, userID, role, addedBy); err != nil {
+			return err
+		}
+		return apply(tx)
+	})
+}
+
+// RemoveEventOrganizer removes a member from the event and calls apply in the same
+// transaction; owners cannot be removed. pgx.ErrNoRows means the user is not a member.
+func (r *AdminRepository) RemoveEventOrganizer(ctx context.Context, eventID, userID string, apply func(tx pgx.Tx) error) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			DELETE FROM event_organizers WHERE event_id = $1 AND user_id = $2 AND role = 'member'
+		`, eventID, userID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return apply(tx)
+	})
+}
+
+func (r *AdminRepository) ListEventOrganizers(ctx context.Context, eventID string) ([]*EventOrganizer, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT o.event_id, o.user_id, u.name, u.email, o.role, o.added_by, o.created_at
+		FROM event_organizers o
+		JOIN users u ON u.id = o.user_id
+		WHERE o.event_id = $1
+		ORDER BY o.role = 'owner' DESC, o.created_at
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizers := []*EventOrganizer{}
+	for rows.Next() {
+		o := &EventOrganizer{}
+		if err := rows.Scan(&o.EventID, &o.UserID, &o.Name, &o.Email, &o.Role, &o.AddedBy, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		organizers = append(organizers, o)
+	}
+	return organizers, rows.Err()
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// RoleCache is told when a user's role changes so it stops serving the old one.
+type RoleCache interface {
+	Invalidate(ctx context.Context, userID string) error
+}
+
+// SetRoleCache installs the cache invalidated by CreateAdminFromUser, RemoveAdmin and
+// RemoveUser.
+func (r *AdminRepository) SetRoleCache(c RoleCache) {
+	r.roles = c
+}
+
+// UserRole returns the role of the user, or "" if there is no such user.
+func (r *AdminRepository) UserRole(ctx context.Context, userID string) (string, error) {
+	var role string
+	err := r.db.Pool.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// setRole gives the user role if their current role is from, or whatever it is when from
+// is empty, and calls apply with their previous role in the same transaction. pgx.ErrNoRows
+// is returned if there is no such user or their role is not from.
+func (r *AdminRepository) setRole(ctx context.Context, userID, role, from string, apply func(tx pgx.Tx, previous string) error) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var previous string
+		err := tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+		if from != "" && previous != from {
+			return pgx.ErrNoRows
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET role = $2, updated_at = now() WHERE id = $1`, userID, role); err != nil {
+			return err
+		}
+		return apply(tx, previous)
+	})
+	if err != nil {
+		return err
+	}
+
+	r.roleChanged(ctx, userID)
+	return nil
+}
+
+func (r *AdminRepository) roleChanged(ctx context.Context, userID string) {
+	if r.roles == nil {
+		return
+	}
+	if err := r.roles.Invalidate(ctx, userID); err != nil {
+		r.log.Error("Failed to invalidate cached role", zap.Error(err), zap.String("user_id", userID))
+	}
+}
@@ -0,0 +1,119 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+// APIKey is a partner credential. Requests made with it act as UserID, limited to Scopes.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	UserID     string     `json:"user_id"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rate_limit"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedBy  *string    `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key may still be used.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+type APIKeysRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewAPIKeysRepository(db *store.DB, log *zap.Logger) *APIKeysRepository {
+	return &APIKeysRepository{db: db, log: log}
+}
+
+const selectKey = `
+	SELECT id, name, prefix, key_hash, user_id, scopes, rate_limit, expires_at, last_used_at,
+	       revoked_at, created_by, created_at
+	FROM api_keys`
+
+func (r *APIKeysRepository) Create(ctx context.Context, k *APIKey) error {
+	var createdBy *string
+	if k.CreatedBy != nil && *k.CreatedBy != "" {
+		createdBy = k.CreatedBy
+	}
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, rate_limit, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, k.Name, k.Prefix, k.KeyHash, k.UserID, k.Scopes, k.RateLimit, k.ExpiresAt, createdBy).Scan(&k.ID, &k.CreatedAt)
+}
+
+// GetByPrefix returns the key with the given prefix, or nil.
+func (r *APIKeysRepository) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	k, err := scanKey(r.db.Pool.QueryRow(ctx, selectKey+` WHERE prefix = $1`, prefix))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// List returns all keys, newest first, including revoked and expired ones.
+func (r *APIKeysRepository) List(ctx context.Context, limit, offset int) ([]*APIKey, error) {
+	rows, err := r.db.Pool.Query(ctx, selectKey+` ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke stops the key from working; pgx.ErrNoRows means no such active key.
+func (r *APIKeysRepository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.Pool.Exec(ctx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// TouchLastUsed records that the key was used. It writes at most once a minute per key so
+// busy keys do not turn every request into a write.
+func (r *APIKeysRepository) TouchLastUsed(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE api_keys
+		SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`, id)
+	return err
+}
+
+func scanKey(row pgx.Row) (*APIKey, error) {
+	k := &APIKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.KeyHash, &k.UserID, &k.Scopes, &k.RateLimit,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedBy, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
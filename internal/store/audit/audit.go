@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+// Target types of audit entries.
+const (
+	TargetEvent = "event"
+	TargetUser  = "user"
+)
+
+// Entry is one admin action. Entries are never updated or deleted.
+type Entry struct {
+	ID         int64           `json:"id"`
+	ActorID    *string         `json:"actor_id"`
+	ActorRole  string          `json:"actor_role"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type Filter struct {
+	ActorID    string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+type AuditRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewAuditRepository(db *store.DB, log *zap.Logger) *AuditRepository {
+	return &AuditRepository{db: db, log: log}
+}
+
+// AppendTx appends the entry inside the transaction making the change it describes, so
+// the change and its entry are committed or rolled back together.
+func AppendTx(ctx context.Context, tx pgx.Tx, e *Entry) error {
+	return tx.QueryRow(ctx, `
+		INSERT INTO admin_audit (actor_id, actor_role, action, target_type, target_id, before, after, ip, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`, e.ActorID, e.ActorRole, e.Action, e.TargetType, e.TargetID, nullJSON(e.Before), nullJSON(e.After), e.IP, e.RequestID).Scan(&e.ID, &e.CreatedAt)
+}
+
+// List returns entries matching the filter, newest first.
+func (r *AuditRepository) List(ctx context.Context, f Filter) ([]*Entry, error) {
+	var conds []string
+	var args []any
+	if f.ActorID != "" {
+		args = append(args, f.ActorID)
+		conds = append(conds, fmt.Sprintf("actor_id = $%d", len(args)))
+	}
+	if f.TargetType != "" {
+		args = append(args, f.TargetType)
+		conds = append(conds, fmt.Sprintf("target_type = $%d", len(args)))
+	}
+	if f.TargetID != "" {
+		args = append(args, f.TargetID)
+		conds = append(conds, fmt.Sprintf("target_id = $%d", len(args)))
+	}
+	if f.From != nil {
+		args = append(args, *f.From)
+		conds = append(conds, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if f.To != nil {
+		args = append(args, *f.To)
+		conds = append(conds, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query := fmt.Sprintf(`
+		SELECT id, actor_id, actor_role, action, target_type, target_id, before, after, ip, request_id, created_at
+		FROM admin_audit
+		%s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		e := &Entry{}
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorRole, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.IP, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// nullJSON stores an empty snapshot as NULL rather than invalid JSON.
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
@@ -0,0 +1,35 @@
+package bookings
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Booking audit actions, as allowed by the booking_audit check constraint.
+const (
+	AuditCreated    = "created"
+	AuditCancelled  = "cancelled"
+	AuditWaitlisted = "waitlisted"
+	AuditExpired    = "expired"
+	AuditFinalized  = "finalized"
+	AuditPromoted   = "promoted"
+)
+
+// AuditTx appends a booking_audit row inside the caller's transaction. bookingID is nil
+// for waitlist actions that have no booking yet.
+func AuditTx(ctx context.Context, tx pgx.Tx, bookingID *string, eventID, userID, action string, payload any) error {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO booking_audit (booking_id, event_id, user_id, action, payload)
+		VALUES ($1, $2, $3, $4, $5)
+	`, bookingID, eventID, userID, action, data)
+	return err
+}
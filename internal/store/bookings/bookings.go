@@ -3,26 +3,39 @@ package bookings
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/outbox"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/releases"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+)
+
+var (
+	ErrNotPending     = errors.New("booking is not pending")
+	ErrNotCancellable = errors.New("booking cannot be cancelled")
+	ErrSeatNotBooked  = errors.New("seat is not part of the booking")
+	ErrLastSeats      = errors.New("cancelling every seat needs a full cancellation")
 )
 
 type Booking struct {
-	ID             string    `json:"id"`
-	UserID         string    `json:"user_id"`
-	EventID        string    `json:"event_id"`
-	Status         string    `json:"status"`
-	Seats          []byte    `json:"seats"` // JSON array of seat labels
-	IdempotencyKey string    `json:"idempotency_key,omitempty"`
-	AmountPaid     float64   `json:"amount_paid"`
-	PaymentStatus  string    `json:"payment_status"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Version        int       `json:"version"`
+	ID              string    `json:"id"`
+	UserID          string    `json:"user_id"`
+	EventID         string    `json:"event_id"`
+	Status          string    `json:"status"`
+	Seats           []byte    `json:"seats"` // JSON array of seat labels
+	TierID          *string   `json:"tier_id,omitempty"`
+	PaymentIntentID *string   `json:"payment_intent_id,omitempty"`
+	IdempotencyKey  string    `json:"idempotency_key,omitempty"`
+	AmountPaid      float64   `json:"amount_paid"`
+	PaymentStatus   string    `json:"payment_status"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Version         int       `json:"version"`
 }
 
 type BookingsRepository struct {
@@ -34,37 +47,73 @@ func NewBookingsRepository(db *store.DB, log *zap.Logger) *BookingsRepository {
 	return &BookingsRepository{db: db, log: log}
 }
 
-func (r *BookingsRepository) CreatePending(ctx context.Context, userID string, eventID string, idempotencyKey *string, seats []byte) (*Booking, error) {
-	query := `
-		INSERT INTO bookings (user_id, event_id, status, idempotency_key, payment_status, seats)
-		VALUES ($1, $2, 'pending', $3, 'pending', $4)
-		RETURNING id, created_at, updated_at, version`
+// CreatePendingWithMessage inserts a pending booking, holds its seats until heldUntil and
+// writes an outbox message built from the new booking, all in one transaction. If any seat
+// is taken a *seats.SeatsUnavailableError is returned and nothing is written. tierID is the
+// ticket tier chosen for seats that are not bound to a tier.
+func (r *BookingsRepository) CreatePendingWithMessage(ctx context.Context, userID string, eventID string, idempotencyKey *string, seatsJSON []byte, tierID *string, heldUntil time.Time, topic string, buildPayload func(*Booking) ([]byte, error)) (*Booking, error) {
+	var booking *Booking
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		booking, err = CreatePendingTx(ctx, tx, userID, eventID, idempotencyKey, seatsJSON, tierID, heldUntil, topic, buildPayload)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CreatePendingTx is CreatePendingWithMessage inside the caller's transaction.
+func CreatePendingTx(ctx context.Context, tx pgx.Tx, userID string, eventID string, idempotencyKey *string, seatsJSON []byte, tierID *string, heldUntil time.Time, topic string, buildPayload func(*Booking) ([]byte, error)) (*Booking, error) {
+	var seatLabels []string
+	if len(seatsJSON) > 0 {
+		if err := json.Unmarshal(seatsJSON, &seatLabels); err != nil {
+			return nil, err
+		}
+	}
 
 	booking := &Booking{
 		UserID:        userID,
 		EventID:       eventID,
 		Status:        "pending",
 		PaymentStatus: "pending",
-		Seats:         seats,
+		Seats:         seatsJSON,
+		TierID:        tierID,
 	}
 
 	if idempotencyKey != nil {
 		booking.IdempotencyKey = *idempotencyKey
 	}
 
-	err := r.db.Pool.QueryRow(ctx, query, userID, eventID, idempotencyKey, seats).
+	err := tx.QueryRow(ctx, `
+		INSERT INTO bookings (user_id, event_id, status, idempotency_key, payment_status, seats, tier_id)
+		VALUES ($1, $2, 'pending', $3, 'pending', $4, $5)
+		RETURNING id, created_at, updated_at, version
+	`, userID, eventID, idempotencyKey, seatsJSON, tierID).
 		Scan(&booking.ID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := seats.HoldSeatsTx(ctx, tx, eventID, seatLabels, booking.ID, heldUntil); err != nil {
+		return nil, err
+	}
+
+	payload, err := buildPayload(booking)
+	if err != nil {
+		return nil, err
+	}
+	if err := outbox.Enqueue(ctx, tx, topic, eventID, payload); err != nil {
+		return nil, err
+	}
 	return booking, nil
 }
 
 func (r *BookingsRepository) GetByID(ctx context.Context, id string) (*Booking, error) {
 	query := `
 		SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
-		       payment_status, created_at, updated_at, version
+		       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
 		FROM bookings
 		WHERE id = $1`
 
@@ -72,7 +121,7 @@ func (r *BookingsRepository) GetByID(ctx context.Context, id string) (*Booking,
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
 		&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
 		&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
-		&booking.PaymentStatus, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+		&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -87,7 +136,7 @@ func (r *BookingsRepository) GetByID(ctx context.Context, id string) (*Booking,
 func (r *BookingsRepository) GetByIdempotency(ctx context.Context, key string) (*Booking, error) {
 	query := `
 		SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
-		       payment_status, created_at, updated_at, version
+		       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
 		FROM bookings
 		WHERE idempotency_key = $1`
 
@@ -95,7 +144,7 @@ func (r *BookingsRepository) GetByIdempotency(ctx context.Context, key string) (
 	err := r.db.Pool.QueryRow(ctx, query, key).Scan(
 		&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
 		&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
-		&booking.PaymentStatus, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+		&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -110,7 +159,7 @@ func (r *BookingsRepository) GetByIdempotency(ctx context.Context, key string) (
 func (r *BookingsRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*Booking, error) {
 	query := `
 		SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
-		       payment_status, created_at, updated_at, version
+		       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
 		FROM bookings
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -128,7 +177,7 @@ func (r *BookingsRepository) ListByUser(ctx context.Context, userID string, limi
 		err := rows.Scan(
 			&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
 			&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
-			&booking.PaymentStatus, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+			&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -142,7 +191,7 @@ func (r *BookingsRepository) ListByUser(ctx context.Context, userID string, limi
 func (r *BookingsRepository) ListByEvent(ctx context.Context, eventID string, limit, offset int) ([]*Booking, error) {
 	query := `
 		SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
-		       payment_status, created_at, updated_at, version
+		       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
 		FROM bookings
 		WHERE event_id = $1
 		ORDER BY created_at DESC
@@ -160,7 +209,7 @@ func (r *BookingsRepository) ListByEvent(ctx context.Context, eventID string, li
 		err := rows.Scan(
 			&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
 			&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
-			&booking.PaymentStatus, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+			&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -171,6 +220,54 @@ func (r *BookingsRepository) ListByEvent(ctx context.Context, eventID string, li
 	return bookings, nil
 }
 
+// ForEachByEvent calls fn with every booking of the event, in pages of up to pageSize in
+// ID order, until all are read or fn returns an error. Paging by ID means bookings
+// created or updated meanwhile cannot shift a page and make it skip or repeat rows.
+func (r *BookingsRepository) ForEachByEvent(ctx context.Context, eventID string, pageSize int, fn func([]*Booking) error) error {
+	after := "00000000-0000-0000-0000-000000000000"
+	for {
+		rows, err := r.db.Pool.Query(ctx, `
+			SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
+			       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
+			FROM bookings
+			WHERE event_id = $1 AND id > $2
+			ORDER BY id
+			LIMIT $3`, eventID, after, pageSize)
+		if err != nil {
+			return err
+		}
+
+		var page []*Booking
+		for rows.Next() {
+			booking := &Booking{}
+			err := rows.Scan(
+				&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
+				&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
+				&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+			)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, booking)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
 func (r *BookingsRepository) UpdateStatus(ctx context.Context, id, status string) error {
 	query := `UPDATE bookings SET status = $1, updated_at = now() WHERE id = $2`
 
@@ -186,21 +283,39 @@ func (r *BookingsRepository) UpdateStatus(ctx context.Context, id, status string
 	return nil
 }
 
-func (r *BookingsRepository) UpdatePaymentStatus(ctx context.Context, id, paymentStatus string, amountPaid float64) error {
-	query := `
-		UPDATE bookings 
-		SET payment_status = $1, amount_paid = $2
-		WHERE id = $3`
+// UpdatePaymentStatus moves the booking's payment status from one value to another and
+// runs apply in the same transaction, so ledger postings commit together with the status.
+// pgx.ErrNoRows is returned if the booking is unknown or its status is no longer from, so
+// of two concurrent changes only one succeeds. amount_paid keeps the amount originally
+// charged; what was refunded lives in the ledger.
+func (r *BookingsRepository) UpdatePaymentStatus(ctx context.Context, id, from, to string, apply func(tx pgx.Tx) error) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE bookings
+			SET payment_status = $1, updated_at = now()
+			WHERE id = $2 AND payment_status = $3`, to, id, from)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		if apply == nil {
+			return nil
+		}
+		return apply(tx)
+	})
+}
 
-	result, err := r.db.Pool.Exec(ctx, query, paymentStatus, amountPaid, id)
+// SetPaymentIntent records the gateway payment intent the booking is paid with.
+func (r *BookingsRepository) SetPaymentIntent(ctx context.Context, id, intentID string) error {
+	result, err := r.db.Pool.Exec(ctx, `UPDATE bookings SET payment_intent_id = $1, updated_at = now() WHERE id = $2`, intentID, id)
 	if err != nil {
 		return err
 	}
-
 	if result.RowsAffected() == 0 {
 		return pgx.ErrNoRows
 	}
-
 	return nil
 }
 
@@ -219,134 +334,212 @@ func (r *BookingsRepository) UpdateSeats(ctx context.Context, id string, seats [
 	return nil
 }
 
-func (r *BookingsRepository) CancelBookingTx(ctx context.Context, bookingID string) (*Booking, bool, error) {
-	tx, err := r.db.Pool.Begin(ctx)
-	if err != nil {
-		return nil, false, err
-	}
-	defer tx.Rollback(ctx)
-
-	// Get booking
+// CancelBookingTx cancels a live booking and frees its seats. The freed seats are
+// recorded as a release in the same transaction; the caller hands it on.
+func (r *BookingsRepository) CancelBookingTx(ctx context.Context, bookingID string) (*Booking, bool, *releases.Release, error) {
 	var booking Booking
-	err = tx.QueryRow(ctx, `
-		SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
-		       payment_status, created_at, updated_at, version
-		FROM bookings
-		WHERE id = $1
-	`, bookingID).Scan(
-		&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
-		&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
-		&booking.PaymentStatus, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
-	)
-	if err != nil {
-		return nil, false, err
-	}
+	var wasBooked bool
+	var rel *releases.Release
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Get booking
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
+			       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
+			FROM bookings
+			WHERE id = $1
+			FOR UPDATE
+		`, bookingID).Scan(
+			&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
+			&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
+			&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+		)
+		if err != nil {
+			return err
+		}
 
-	// Check if booking was actually booked (not just pending)
-	wasBooked := booking.Status == "booked"
+		// Only live bookings can be cancelled; this also stops seats and tokens being released twice
+		if booking.Status != "pending" && booking.Status != "booked" {
+			return ErrNotCancellable
+		}
 
-	// Update booking status
-	_, err = tx.Exec(ctx, `
-		UPDATE bookings 
-		SET status = 'cancelled', updated_at = now() 
-		WHERE id = $1
-	`, bookingID)
-	if err != nil {
-		return nil, false, err
-	}
+		// Check if booking was actually booked (not just pending)
+		wasBooked = booking.Status == "booked"
 
-	// If it was booked, update event reserved count and release seats
-	if wasBooked {
+		// Update booking status
 		_, err = tx.Exec(ctx, `
-			UPDATE events 
-			SET reserved = reserved - 1 
+			UPDATE bookings 
+			SET status = 'cancelled', updated_at = now() 
 			WHERE id = $1
-		`, booking.EventID)
+		`, bookingID)
 		if err != nil {
-			return nil, false, err
+			return err
 		}
 
-		// Release seats - mark them as available again
-		var seatLabels []string
-		if len(booking.Seats) > 0 {
-			err = json.Unmarshal(booking.Seats, &seatLabels)
+		// If it was booked, update event reserved count
+		if wasBooked {
+			_, err = tx.Exec(ctx, `
+				UPDATE events 
+				SET reserved = reserved - 1 
+				WHERE id = $1
+			`, booking.EventID)
 			if err != nil {
-				return nil, false, err
+				return err
 			}
+		}
 
-			for _, seatLabel := range seatLabels {
-				_, err = tx.Exec(ctx, `
-				UPDATE seats 
-				SET status = 'available', held_by_booking = NULL, held_until = NULL, updated_at = now()
-				WHERE event_id = $1 AND seat_label = $2
-			`, booking.EventID, seatLabel)
-				if err != nil {
-					return nil, false, err
-				}
-			}
+		// Release seats held or booked by this booking - mark them as available again
+		if err = seats.ReleaseBookingSeatsTx(ctx, tx, booking.EventID, booking.ID); err != nil {
+			return err
 		}
-	}
 
-	err = tx.Commit(ctx)
+		// Their tokens stay held until the release is handed on
+		var labels []string
+		if len(booking.Seats) > 0 {
+			if err := json.Unmarshal(booking.Seats, &labels); err != nil {
+				return err
+			}
+		}
+		rel, err = releases.EnqueueTx(ctx, tx, booking.EventID, booking.ID, labels, booking.TierID)
+		return err
+	})
 	if err != nil {
-		return nil, false, err
+		return nil, false, nil, err
 	}
 
 	booking.Status = "cancelled"
-	return &booking, wasBooked, nil
+	return &booking, wasBooked, rel, nil
 }
 
-func (r *BookingsRepository) FinalizeBooking(ctx context.Context, bookingID string, seats []byte, amountPaid float64) error {
-	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
-		// Get event_id for updating seats table
-		var eventID string
-		err := tx.QueryRow(ctx, `SELECT event_id FROM bookings WHERE id = $1`, bookingID).Scan(&eventID)
+// CancelSeats releases some seats of a booked booking. release is called with the locked
+// booking and the seats it keeps; it returns the share of amount_paid the released seats
+// account for and may write ledger postings in tx. The booking keeps its other seats; the
+// released ones are recorded as a seat release for the caller to hand on.
+func (r *BookingsRepository) CancelSeats(ctx context.Context, bookingID string, labels []string, release func(tx pgx.Tx, b *Booking, kept []string) (float64, error)) (*Booking, *releases.Release, error) {
+	var booking Booking
+	var rel *releases.Release
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id, event_id, status, seats, idempotency_key, amount_paid, 
+			       payment_status, tier_id, payment_intent_id, created_at, updated_at, version
+			FROM bookings
+			WHERE id = $1
+			FOR UPDATE
+		`, bookingID).Scan(
+			&booking.ID, &booking.UserID, &booking.EventID, &booking.Status,
+			&booking.Seats, &booking.IdempotencyKey, &booking.AmountPaid,
+			&booking.PaymentStatus, &booking.TierID, &booking.PaymentIntentID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version,
+		)
 		if err != nil {
 			return err
 		}
+		if booking.Status != "booked" {
+			return ErrNotCancellable
+		}
 
-		// Update booking
-		_, err = tx.Exec(ctx, `
-		UPDATE bookings 
-		SET status = 'booked', seats = $1, amount_paid = $2, payment_status = 'paid', updated_at = now() 
-		WHERE id = $3 AND status = 'pending'
-	`, seats, amountPaid, bookingID)
+		var current []string
+		if len(booking.Seats) > 0 {
+			if err := json.Unmarshal(booking.Seats, &current); err != nil {
+				return err
+			}
+		}
+		cancel := map[string]bool{}
+		for _, l := range labels {
+			cancel[l] = true
+		}
+		var kept []string
+		for _, l := range current {
+			if !cancel[l] {
+				kept = append(kept, l)
+			}
+		}
+		if len(current)-len(kept) != len(cancel) {
+			return ErrSeatNotBooked
+		}
+		if len(kept) == 0 {
+			return ErrLastSeats
+		}
+
+		share, err := release(tx, &booking, kept)
 		if err != nil {
 			return err
 		}
 
-		// Update seats table - mark seats as booked
-		// Parse seats JSON and update each seat individually
-		var seatLabels []string
-		if len(seats) > 0 {
-			err = json.Unmarshal(seats, &seatLabels)
-			if err != nil {
-				return err
-			}
+		keptJSON, err := json.Marshal(kept)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE bookings
+			SET seats = $1, amount_paid = GREATEST(amount_paid - $2, 0), updated_at = now(), version = version + 1
+			WHERE id = $3
+			RETURNING seats, amount_paid, updated_at, version
+		`, keptJSON, share, bookingID).Scan(&booking.Seats, &booking.AmountPaid, &booking.UpdatedAt, &booking.Version)
+		if err != nil {
+			return err
+		}
 
-			for _, seatLabel := range seatLabels {
-				_, err = tx.Exec(ctx, `
-				UPDATE seats 
-				SET status = 'booked', held_by_booking = $1, held_until = NULL, updated_at = now()
-				WHERE event_id = $2 AND seat_label = $3
-			`, bookingID, eventID, seatLabel)
-				if err != nil {
-					return err
-				}
-			}
+		if err := seats.ReleaseBookingLabelsTx(ctx, tx, booking.EventID, booking.ID, labels); err != nil {
+			return err
 		}
+		rel, err = releases.EnqueueTx(ctx, tx, booking.EventID, booking.ID, labels, booking.TierID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &booking, rel, nil
+}
 
-		// Update event reserved count
-		_, err = tx.Exec(ctx, `
+func (r *BookingsRepository) FinalizeBooking(ctx context.Context, bookingID string, seatsJSON []byte, amountPaid float64) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return FinalizeBookingTx(ctx, tx, bookingID, seatsJSON, amountPaid, nil)
+	})
+}
+
+// FinalizeBookingTx marks a pending booking as booked and paid inside the caller's
+// transaction, turning its held seats into booked ones. intentID, if set, records the
+// payment intent the booking was paid with.
+func FinalizeBookingTx(ctx context.Context, tx pgx.Tx, bookingID string, seatsJSON []byte, amountPaid float64, intentID *string) error {
+	// Get event_id for updating seats table
+	var eventID string
+	err := tx.QueryRow(ctx, `SELECT event_id FROM bookings WHERE id = $1`, bookingID).Scan(&eventID)
+	if err != nil {
+		return err
+	}
+
+	// Update booking
+	result, err := tx.Exec(ctx, `
+		UPDATE bookings 
+		SET status = 'booked', seats = $1, amount_paid = $2, payment_status = 'paid',
+		    payment_intent_id = COALESCE($3, payment_intent_id), updated_at = now() 
+		WHERE id = $4 AND status = 'pending'
+	`, seatsJSON, amountPaid, intentID, bookingID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotPending
+	}
+
+	// Update seats table - the held seats become booked
+	var seatLabels []string
+	if len(seatsJSON) > 0 {
+		err = json.Unmarshal(seatsJSON, &seatLabels)
+		if err != nil {
+			return err
+		}
+	}
+	if err = seats.BookSeatsTx(ctx, tx, eventID, seatLabels, bookingID); err != nil {
+		return err
+	}
+
+	// Update event reserved count
+	_, err = tx.Exec(ctx, `
 		UPDATE events 
 		SET reserved = reserved + 1 
 		WHERE id = $1
 	`, eventID)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
+	return err
 }
 
 func (r *BookingsRepository) GetBookingStatus(ctx context.Context, bookingID string) (string, error) {
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+)
+
+// ErrSeatLabels is returned when the seat labels given do not match the capacity change.
+var ErrSeatLabels = errors.New("seat labels do not match the capacity change")
+
+// ErrCapacityChanged is returned when the capacity is no longer what the caller last read.
+var ErrCapacityChanged = errors.New("capacity was changed concurrently")
+
+// CapacityBelowReservedError is returned when a capacity decrease would drop below the
+// seats that are already held or booked.
+type CapacityBelowReservedError struct {
+	Capacity int
+	Reserved int
+}
+
+func (e *CapacityBelowReservedError) Error() string {
+	return fmt.Sprintf("capacity %d is below the %d seats already held or booked", e.Capacity, e.Reserved)
+}
+
+// CapacityChange is the outcome of ChangeCapacity.
+type CapacityChange struct {
+	EventID          string   `json:"event_id"`
+	PreviousCapacity int      `json:"previous_capacity"`
+	Capacity         int      `json:"capacity"`
+	AddedSeats       []string `json:"added_seats"`
+	RemovedSeats     []string `json:"removed_seats"`
+}
+
+// ChangeCapacity moves the event's capacity from the given value to a new one, adding the given seat labels when it grows and
+// removing available seats when it shrinks; remove picks the labels to drop, otherwise the
+// last available labels go. The event row is locked, and ErrCapacityChanged is returned if
+// another change got there first.
+// A decrease below the held and booked seats returns a *CapacityBelowReservedError, and
+// pgx.ErrNoRows is returned for an unknown event. apply is called with the change in the
+// same transaction.
+func (r *EventsRepository) ChangeCapacity(ctx context.Context, eventID string, from, capacity int, add, remove []string, apply func(tx pgx.Tx, change *CapacityChange) error) (*CapacityChange, error) {
+	change := &CapacityChange{EventID: eventID, Capacity: capacity, AddedSeats: []string{}, RemovedSeats: []string{}}
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `SELECT capacity FROM events WHERE id = $1 FOR UPDATE`, eventID).Scan(&change.PreviousCapacity)
+		if err != nil {
+			return err
+		}
+		if change.PreviousCapacity != from {
+			return ErrCapacityChanged
+		}
+
+		delta := capacity - change.PreviousCapacity
+		switch {
+		case delta > 0:
+			if len(add) != delta {
+				return fmt.Errorf("%w: %d new seat labels are needed to raise capacity from %d to %d", ErrSeatLabels, delta, change.PreviousCapacity, capacity)
+			}
+			if err := seats.AddSeatsTx(ctx, tx, eventID, add); err != nil {
+				return err
+			}
+			change.AddedSeats = add
+		case delta < 0:
+			var reserved int
+			err := tx.QueryRow(ctx, `
+				SELECT COUNT(*) FROM seats WHERE event_id = $1 AND status <> 'available'
+			`, eventID).Scan(&reserved)
+			if err != nil {
+				return err
+			}
+			if capacity < reserved {
+				return &CapacityBelowReservedError{Capacity: capacity, Reserved: reserved}
+			}
+			if len(remove) > 0 && len(remove) != -delta {
+				return fmt.Errorf("%w: %d seat labels are needed to lower capacity from %d to %d", ErrSeatLabels, -delta, change.PreviousCapacity, capacity)
+			}
+			if change.RemovedSeats, err = seats.RemoveAvailableSeatsTx(ctx, tx, eventID, -delta, remove); err != nil {
+				return err
+			}
+		default:
+			return apply(tx, change)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE events SET capacity = $2, updated_at = now() WHERE id = $1`, eventID, capacity)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE event_capacity SET capacity = $2 WHERE event_id = $1`, eventID, capacity)
+		if err != nil {
+			return err
+		}
+		return apply(tx, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrStale is returned when the event was updated after the version the caller read.
+var ErrStale = errors.New("event was modified since it was read")
+
+// FieldChange is one field's old and new value in an event change.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Change is a recorded admin edit of an event.
+type Change struct {
+	ID        int64                  `json:"id"`
+	EventID   string                 `json:"event_id"`
+	ChangedBy *string                `json:"changed_by"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ETag identifies the version of the event, which changes with every update.
+func (e *Event) ETag() string {
+	return strconv.Quote(strconv.FormatInt(e.UpdatedAt.UnixMicro(), 10))
+}
+
+// Patch locks the event, checks it is still at version (its updated_at) and calls apply to
+// change it in memory; apply returns the diff of what it changed. The editable columns are
+// written back and the diff is recorded in event_changes in the same transaction, and
+// saved is then called with the event as stored, still in the transaction. With an empty
+// diff nothing is written and saved is not called. pgx.ErrNoRows is returned for an
+// unknown event.
+func (r *EventsRepository) Patch(ctx context.Context, id string, version time.Time, changedBy string, apply func(e *Event) (map[string]FieldChange, error), saved func(tx pgx.Tx, e *Event) error) (*Event, error) {
+	event := &Event{}
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata,
+			       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
+			FROM events
+			WHERE id = $1
+			FOR UPDATE`, id).Scan(
+			&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
+			&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
+			&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
+			&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		// updated_at is stored to the microsecond
+		if event.UpdatedAt.UnixMicro() != version.UnixMicro() {
+			return ErrStale
+		}
+
+		diff, err := apply(event)
+		if err != nil {
+			return err
+		}
+		if len(diff) == 0 {
+			return nil
+		}
+
+		err = tx.QueryRow(ctx, `
+			UPDATE events
+			SET name = $2, venue = $3, category = $4, start_time = $5, end_time = $6, metadata = $7,
+			    ticket_price = $8, cancellation_fee = $9, maximum_tickets_per_booking = $10, updated_at = now()
+			WHERE id = $1
+			RETURNING updated_at`,
+			id, event.Name, event.Venue, event.Category, event.StartTime, event.EndTime, event.Metadata,
+			event.TicketPrice, event.CancellationFee, event.MaximumTicketsPerBooking).Scan(&event.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		changes, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		var by *string
+		if changedBy != "" {
+			by = &changedBy
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO event_changes (event_id, changed_by, changes)
+			VALUES ($1, $2, $3)
+		`, id, by, changes)
+		if err != nil {
+			return err
+		}
+		return saved(tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// ListChanges returns the recorded edits of the event, newest first.
+func (r *EventsRepository) ListChanges(ctx context.Context, eventID string, limit, offset int) ([]*Change, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, event_id, changed_by, changes, created_at
+		FROM event_changes
+		WHERE event_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`, eventID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*Change{}
+	for rows.Next() {
+		c := &Change{}
+		var raw []byte
+		if err := rows.Scan(&c.ID, &c.EventID, &c.ChangedBy, &raw, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &c.Changes); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/audit"
+)
+
+// testRepo connects to the migrated database in TEST_POSTGRES_URL, or skips the test.
+func testRepo(t *testing.T) (*EventsRepository, *store.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	db, err := store.NewDB(context.Background(), url, 5)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return NewEventsRepository(db, zap.NewNop()), db
+}
+
+func TestPatchWithoutChangesIsNotAudited(t *testing.T) {
+	repo, db := testRepo(t)
+	ctx := context.Background()
+
+	var e Event
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO events (name, capacity) VALUES ('patch test', 1) RETURNING id, updated_at
+	`).Scan(&e.ID, &e.UpdatedAt)
+	if err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM admin_audit WHERE target_type = $1 AND target_id = $2`, audit.TargetEvent, e.ID)
+		db.Pool.Exec(ctx, `DELETE FROM events WHERE id = $1`, e.ID)
+	})
+
+	// saved writes the audit entry the way the admin service does
+	calls := 0
+	_, err = repo.Patch(ctx, e.ID, e.UpdatedAt, "", func(*Event) (map[string]FieldChange, error) {
+		return nil, nil
+	}, func(tx pgx.Tx, saved *Event) error {
+		calls++
+		return audit.AppendTx(ctx, tx, &audit.Entry{
+			ActorRole:  "admin",
+			Action:     "event.update",
+			TargetType: audit.TargetEvent,
+			TargetID:   saved.ID,
+		})
+	})
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("saved called %d times for an empty diff, want 0", calls)
+	}
+
+	var entries, changes int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM admin_audit WHERE target_type = $1 AND target_id = $2),
+		       (SELECT COUNT(*) FROM event_changes WHERE event_id = $2::uuid)
+	`, audit.TargetEvent, e.ID).Scan(&entries, &changes)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if entries != 0 || changes != 0 {
+		t.Fatalf("no-op patch wrote %d audit entries and %d changes, want none", entries, changes)
+	}
+}
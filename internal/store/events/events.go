@@ -26,6 +26,7 @@ type Event struct {
 	CancellationFee          float64   `json:"cancellation_fee"`
 	Likes                    int       `json:"likes"`
 	MaximumTicketsPerBooking int       `json:"maximum_tickets_per_booking"`
+	VenueID                  *string   `json:"venue_id,omitempty"`
 	CreatedAt                time.Time `json:"created_at"`
 	UpdatedAt                time.Time `json:"updated_at"`
 }
@@ -39,22 +40,24 @@ func NewEventsRepository(db *store.DB, log *zap.Logger) *EventsRepository {
 	return &EventsRepository{db: db, log: log}
 }
 
-func (r *EventsRepository) Create(ctx context.Context, event *Event) (*Event, error) {
+// Create inserts the event, filling in its ID and timestamps, and calls apply in the same
+// transaction.
+func (r *EventsRepository) Create(ctx context.Context, event *Event, apply func(tx pgx.Tx) error) (*Event, error) {
 	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
 		query := `
-		INSERT INTO events (name, venue, start_time, end_time, category, capacity, metadata, status, ticket_price, cancellation_fee, maximum_tickets_per_booking)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO events (name, venue, start_time, end_time, category, capacity, metadata, status, ticket_price, cancellation_fee, maximum_tickets_per_booking, venue_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at`
 
 		err := tx.QueryRow(ctx, query,
 			event.Name, event.Venue, event.StartTime, event.EndTime, event.Category,
 			event.Capacity, event.Metadata, event.Status, event.TicketPrice,
-			event.CancellationFee, event.MaximumTicketsPerBooking).
+			event.CancellationFee, event.MaximumTicketsPerBooking, event.VenueID).
 			Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt)
 		if err != nil {
 			return err
 		}
-		return err
+		return apply(tx)
 	})
 	return event, err
 }
@@ -62,7 +65,7 @@ func (r *EventsRepository) Create(ctx context.Context, event *Event) (*Event, er
 func (r *EventsRepository) Get(ctx context.Context, id string) (*Event, error) {
 	query := `
 		SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata, 
-		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, created_at, updated_at
+		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
 		FROM events
 		WHERE id = $1`
 
@@ -71,7 +74,7 @@ func (r *EventsRepository) Get(ctx context.Context, id string) (*Event, error) {
 		&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
 		&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
 		&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
-		&event.MaximumTicketsPerBooking, &event.CreatedAt, &event.UpdatedAt,
+		&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -86,7 +89,7 @@ func (r *EventsRepository) Get(ctx context.Context, id string) (*Event, error) {
 func (r *EventsRepository) List(ctx context.Context, limit, offset int, q string, from, to *time.Time) ([]*Event, error) {
 	query := `
 		SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata, 
-		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, created_at, updated_at
+		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
 		FROM events
 		WHERE 1=1`
 
@@ -127,7 +130,7 @@ func (r *EventsRepository) List(ctx context.Context, limit, offset int, q string
 			&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
 			&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
 			&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
-			&event.MaximumTicketsPerBooking, &event.CreatedAt, &event.UpdatedAt,
+			&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -141,7 +144,7 @@ func (r *EventsRepository) List(ctx context.Context, limit, offset int, q string
 func (r *EventsRepository) ListAll(ctx context.Context, limit, offset int) ([]*Event, error) {
 	query := `
 		SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata, 
-		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, created_at, updated_at
+		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
 		FROM events
 		WHERE (end_time IS NULL OR end_time > NOW())
 		ORDER BY start_time ASC
@@ -160,7 +163,7 @@ func (r *EventsRepository) ListAll(ctx context.Context, limit, offset int) ([]*E
 			&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
 			&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
 			&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
-			&event.MaximumTicketsPerBooking, &event.CreatedAt, &event.UpdatedAt,
+			&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -174,7 +177,7 @@ func (r *EventsRepository) ListAll(ctx context.Context, limit, offset int) ([]*E
 func (r *EventsRepository) ListUpcoming(ctx context.Context, limit, offset int) ([]*Event, error) {
 	query := `
 		SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata, 
-		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, created_at, updated_at
+		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
 		FROM events
 		WHERE start_time > NOW() AND status = 'upcoming'
 		ORDER BY start_time ASC
@@ -193,7 +196,7 @@ func (r *EventsRepository) ListUpcoming(ctx context.Context, limit, offset int)
 			&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
 			&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
 			&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
-			&event.MaximumTicketsPerBooking, &event.CreatedAt, &event.UpdatedAt,
+			&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -207,7 +210,7 @@ func (r *EventsRepository) ListUpcoming(ctx context.Context, limit, offset int)
 func (r *EventsRepository) ListPopular(ctx context.Context, limit, offset int) ([]*Event, error) {
 	query := `
 		SELECT id, name, venue, start_time, end_time, category, capacity, reserved, metadata, 
-		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, created_at, updated_at
+		       status, ticket_price, cancellation_fee, likes, maximum_tickets_per_booking, venue_id, created_at, updated_at
 		FROM events
 		WHERE status = 'upcoming'
 		ORDER BY likes DESC, start_time ASC
@@ -226,7 +229,7 @@ func (r *EventsRepository) ListPopular(ctx context.Context, limit, offset int) (
 			&event.ID, &event.Name, &event.Venue, &event.StartTime, &event.EndTime,
 			&event.Category, &event.Capacity, &event.Reserved, &event.Metadata,
 			&event.Status, &event.TicketPrice, &event.CancellationFee, &event.Likes,
-			&event.MaximumTicketsPerBooking, &event.CreatedAt, &event.UpdatedAt,
+			&event.MaximumTicketsPerBooking, &event.VenueID, &event.CreatedAt, &event.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
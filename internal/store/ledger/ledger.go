@@ -0,0 +1,338 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+const (
+	KindCharge          = "charge"
+	KindRefund          = "refund"
+	KindCancellationFee = "cancellation_fee"
+	KindAdjustment      = "adjustment"
+)
+
+// Accounts. Debits are positive and credits negative, so customer_funds normally carries a
+// credit balance: money received for a booking that is still owed to the customer.
+const (
+	AccountProviderCash  = "provider_cash"
+	AccountCustomerFunds = "customer_funds"
+	AccountFeeRevenue    = "fee_revenue"
+	AccountAdjustments   = "adjustments"
+)
+
+var ErrUnbalanced = errors.New("ledger entries do not balance")
+
+type Entry struct {
+	Account string `json:"account"`
+	Amount  Money  `json:"amount"`
+}
+
+type Transaction struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	EventID     string    `json:"event_id"`
+	BookingID   *string   `json:"booking_id"`
+	ProviderRef *string   `json:"provider_ref"`
+	Amount      Money     `json:"amount"`
+	Memo        string    `json:"memo"`
+	CreatedAt   time.Time `json:"created_at"`
+	Entries     []Entry   `json:"entries"`
+}
+
+// Balance sums the ledger for a booking or an event. CustomerFunds is shown as the amount
+// still owed to customers.
+type Balance struct {
+	Charged          Money `json:"charged"`
+	Refunded         Money `json:"refunded"`
+	CancellationFees Money `json:"cancellation_fees"`
+	Adjustments      Money `json:"adjustments"`
+	ProviderCash     Money `json:"provider_cash"`
+	CustomerFunds    Money `json:"customer_funds"`
+	FeeRevenue       Money `json:"fee_revenue"`
+}
+
+// BookingTotals is what the ledger has charged and refunded for one booking.
+type BookingTotals struct {
+	BookingID string  `json:"booking_id"`
+	IntentID  *string `json:"intent_id"`
+	Charged   Money   `json:"charged"`
+	Refunded  Money   `json:"refunded"`
+}
+
+type Filter struct {
+	EventID   string
+	BookingID string
+	Kind      string
+	Limit     int
+	Offset    int
+}
+
+type LedgerRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewLedgerRepository(db *store.DB, log *zap.Logger) *LedgerRepository {
+	return &LedgerRepository{db: db, log: log}
+}
+
+// RecordTx appends a transaction and its entries inside the caller's transaction. The
+// entries must sum to zero.
+func RecordTx(ctx context.Context, tx pgx.Tx, t *Transaction) error {
+	var sum Money
+	for _, e := range t.Entries {
+		sum += e.Amount
+	}
+	if len(t.Entries) < 2 || sum != 0 {
+		return ErrUnbalanced
+	}
+
+	// Amounts are sent as whole cents; Money's String form must not reach the driver
+	err := tx.QueryRow(ctx, `
+		INSERT INTO ledger_transactions (kind, event_id, booking_id, provider_ref, amount, memo)
+		VALUES ($1, $2, $3, $4, $5::numeric / 100, $6)
+		RETURNING id, created_at
+	`, t.Kind, t.EventID, t.BookingID, t.ProviderRef, int64(t.Amount), t.Memo).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for _, e := range t.Entries {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (transaction_id, account, event_id, booking_id, amount)
+			VALUES ($1, $2, $3, $4, $5::numeric / 100)
+		`, t.ID, e.Account, t.EventID, t.BookingID, int64(e.Amount))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChargeTx records money captured by the provider for a booking.
+func ChargeTx(ctx context.Context, tx pgx.Tx, eventID, bookingID, intentID string, amount Money) error {
+	return RecordTx(ctx, tx, &Transaction{
+		Kind:        KindCharge,
+		EventID:     eventID,
+		BookingID:   &bookingID,
+		ProviderRef: &intentID,
+		Amount:      amount,
+		Entries: []Entry{
+			{Account: AccountProviderCash, Amount: amount},
+			{Account: AccountCustomerFunds, Amount: -amount},
+		},
+	})
+}
+
+// RefundTx records money returned to the customer through the provider.
+func RefundTx(ctx context.Context, tx pgx.Tx, eventID, bookingID, refundID string, amount Money) error {
+	return RecordTx(ctx, tx, &Transaction{
+		Kind:        KindRefund,
+		EventID:     eventID,
+		BookingID:   &bookingID,
+		ProviderRef: &refundID,
+		Amount:      amount,
+		Entries: []Entry{
+			{Account: AccountCustomerFunds, Amount: amount},
+			{Account: AccountProviderCash, Amount: -amount},
+		},
+	})
+}
+
+// CancellationFeeTx records a fee kept from the customer's funds on cancellation.
+func CancellationFeeTx(ctx context.Context, tx pgx.Tx, eventID, bookingID string, fee Money) error {
+	return RecordTx(ctx, tx, &Transaction{
+		Kind:      KindCancellationFee,
+		EventID:   eventID,
+		BookingID: &bookingID,
+		Amount:    fee,
+		Entries: []Entry{
+			{Account: AccountCustomerFunds, Amount: fee},
+			{Account: AccountFeeRevenue, Amount: -fee},
+		},
+	})
+}
+
+// Refund records a provider refund in its own transaction, for refunds that do not
+// change any booking.
+func (r *LedgerRepository) Refund(ctx context.Context, eventID, bookingID, refundID string, amount Money) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return RefundTx(ctx, tx, eventID, bookingID, refundID, amount)
+	})
+}
+
+// Adjust records a manual correction. A positive amount debits account, a negative one
+// credits it; the adjustments account takes the other side.
+func (r *LedgerRepository) Adjust(ctx context.Context, eventID string, bookingID *string, account string, amount Money, memo string) (*Transaction, error) {
+	t := &Transaction{
+		Kind:      KindAdjustment,
+		EventID:   eventID,
+		BookingID: bookingID,
+		Amount:    abs(amount),
+		Memo:      memo,
+		Entries: []Entry{
+			{Account: account, Amount: amount},
+			{Account: AccountAdjustments, Amount: -amount},
+		},
+	}
+	if err := r.db.WithTx(ctx, func(tx pgx.Tx) error { return RecordTx(ctx, tx, t) }); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func abs(m Money) Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// List returns transactions with their entries, newest first.
+func (r *LedgerRepository) List(ctx context.Context, f Filter) ([]*Transaction, error) {
+	var conds []string
+	var args []any
+	if f.EventID != "" {
+		args = append(args, f.EventID)
+		conds = append(conds, fmt.Sprintf("event_id = $%d", len(args)))
+	}
+	if f.BookingID != "" {
+		args = append(args, f.BookingID)
+		conds = append(conds, fmt.Sprintf("booking_id = $%d", len(args)))
+	}
+	if f.Kind != "" {
+		args = append(args, f.Kind)
+		conds = append(conds, fmt.Sprintf("kind = $%d", len(args)))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query := fmt.Sprintf(`
+		SELECT id, kind, event_id, booking_id, provider_ref, (amount * 100)::bigint, memo, created_at
+		FROM ledger_transactions
+		%s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*Transaction
+	byID := map[int64]*Transaction{}
+	var ids []int64
+	for rows.Next() {
+		t := &Transaction{}
+		if err := rows.Scan(&t.ID, &t.Kind, &t.EventID, &t.BookingID, &t.ProviderRef, &t.Amount, &t.Memo, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+		byID[t.ID] = t
+		ids = append(ids, t.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return txs, nil
+	}
+
+	entries, err := r.db.Pool.Query(ctx, `
+		SELECT transaction_id, account, (amount * 100)::bigint
+		FROM ledger_entries
+		WHERE transaction_id = ANY($1)
+		ORDER BY id
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+	for entries.Next() {
+		var id int64
+		var e Entry
+		if err := entries.Scan(&id, &e.Account, &e.Amount); err != nil {
+			return nil, err
+		}
+		byID[id].Entries = append(byID[id].Entries, e)
+	}
+	return txs, entries.Err()
+}
+
+func (r *LedgerRepository) BookingBalance(ctx context.Context, bookingID string) (*Balance, error) {
+	return r.balance(ctx, "booking_id", bookingID)
+}
+
+func (r *LedgerRepository) EventBalance(ctx context.Context, eventID string) (*Balance, error) {
+	return r.balance(ctx, "event_id", eventID)
+}
+
+// balance sums transactions by kind and entries by account. column is never user input.
+func (r *LedgerRepository) balance(ctx context.Context, column, id string) (*Balance, error) {
+	var b Balance
+	err := r.db.Pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT
+			(COALESCE(SUM(amount) FILTER (WHERE kind = 'charge'), 0) * 100)::bigint,
+			(COALESCE(SUM(amount) FILTER (WHERE kind = 'refund'), 0) * 100)::bigint,
+			(COALESCE(SUM(amount) FILTER (WHERE kind = 'cancellation_fee'), 0) * 100)::bigint
+		FROM ledger_transactions
+		WHERE %s = $1
+	`, column), id).Scan(&b.Charged, &b.Refunded, &b.CancellationFees)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT
+			(COALESCE(SUM(amount) FILTER (WHERE account = 'provider_cash'), 0) * 100)::bigint,
+			(COALESCE(-SUM(amount) FILTER (WHERE account = 'customer_funds'), 0) * 100)::bigint,
+			(COALESCE(-SUM(amount) FILTER (WHERE account = 'fee_revenue'), 0) * 100)::bigint,
+			(COALESCE(SUM(amount) FILTER (WHERE account = 'adjustments'), 0) * 100)::bigint
+		FROM ledger_entries
+		WHERE %s = $1
+	`, column), id).Scan(&b.ProviderCash, &b.CustomerFunds, &b.FeeRevenue, &b.Adjustments)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// EventTotals returns the charged and refunded totals of every booking of the event that
+// appears in the ledger.
+func (r *LedgerRepository) EventTotals(ctx context.Context, eventID string) ([]*BookingTotals, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT booking_id::text,
+		       MAX(provider_ref) FILTER (WHERE kind = 'charge'),
+		       (COALESCE(SUM(amount) FILTER (WHERE kind = 'charge'), 0) * 100)::bigint,
+		       (COALESCE(SUM(amount) FILTER (WHERE kind = 'refund'), 0) * 100)::bigint
+		FROM ledger_transactions
+		WHERE event_id = $1 AND booking_id IS NOT NULL
+		GROUP BY booking_id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []*BookingTotals
+	for rows.Next() {
+		t := &BookingTotals{}
+		if err := rows.Scan(&t.BookingID, &t.IntentID, &t.Charged, &t.Refunded); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,75 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money is an amount in minor currency units (cents). The ledger stores NUMERIC(12,2) and
+// works in whole cents in Go, so sums and balance checks are exact. In JSON it is a
+// decimal number of major units, such as 12.50.
+type Money int64
+
+// MoneyFromFloat rounds a float amount from outside the ledger, such as a provider
+// response, to the nearest cent.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 100))
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) String() string {
+	sign, v := "", int64(m)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON parses a decimal number with at most two decimal places, without going
+// through a float.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	v, err := ParseMoney(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// ParseMoney parses a decimal amount such as "12", "-3.5" or "12.50".
+func ParseMoney(s string) (Money, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 2 || strings.HasPrefix(frac, "-") || strings.HasPrefix(frac, "+") {
+		return 0, ErrInvalidMoney
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 || units > math.MaxInt64/100-1 {
+		return 0, ErrInvalidMoney
+	}
+	cents := int64(0)
+	if frac != "" {
+		frac += strings.Repeat("0", 2-len(frac))
+		if cents, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return 0, ErrInvalidMoney
+		}
+	}
+	v := units*100 + cents
+	if neg {
+		v = -v
+	}
+	return Money(v), nil
+}
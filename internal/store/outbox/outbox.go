@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+type Message struct {
+	ID        int64     `json:"id"`
+	Topic     string    `json:"topic"`
+	Key       string    `json:"key"`
+	Payload   []byte    `json:"payload"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OutboxRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewOutboxRepository(db *store.DB, log *zap.Logger) *OutboxRepository {
+	return &OutboxRepository{db: db, log: log}
+}
+
+// Enqueue writes a message inside the caller's transaction so it is only ever relayed if
+// the state change that produced it commits.
+func Enqueue(ctx context.Context, tx pgx.Tx, topic, key string, payload []byte) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO outbox (topic, message_key, payload)
+		VALUES ($1, $2, $3)
+	`, topic, key, payload)
+	return err
+}
+
+// MaxAttempts is how many times a message is published before it is parked as failed.
+// Failed messages stay in the table with their last error for an operator to inspect.
+const MaxAttempts = 10
+
+// maxBackoff caps the wait between publish attempts of a message.
+const maxBackoff = 5 * time.Minute
+
+// RelayBatch locks up to limit unsent messages that are due, hands each one to publish and
+// marks the published ones as sent. Rows are locked with SKIP LOCKED so several relays
+// can run side by side. A failed publish records the error on its row, schedules the row
+// again with exponential backoff and moves on to the next message; after MaxAttempts the
+// row is marked failed and no longer relayed. Messages are published in id order within a
+// batch, but concurrent relays and retries mean no ordering is guaranteed, not even per
+// key, so consumers must not depend on it. A crash between publish and commit re-sends
+// the batch, which makes delivery at-least-once.
+func (r *OutboxRepository) RelayBatch(ctx context.Context, limit int, publish func(Message) error) (int, error) {
+	sent := 0
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, topic, message_key, payload, attempts, created_at
+			FROM outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`, limit)
+		if err != nil {
+			return err
+		}
+
+		var messages []Message
+		for rows.Next() {
+			var m Message
+			if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload, &m.Attempts, &m.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			messages = append(messages, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			if perr := publish(m); perr != nil {
+				if err := r.recordFailure(ctx, tx, m, perr); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = now(), attempts = attempts + 1 WHERE id = $1`, m.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// recordFailure stores the publish error and either schedules the next attempt or, once
+// the message has used up its attempts, parks it as failed.
+func (r *OutboxRepository) recordFailure(ctx context.Context, tx pgx.Tx, m Message, perr error) error {
+	attempts := m.Attempts + 1
+	if attempts >= MaxAttempts {
+		r.log.Error("outbox message failed permanently",
+			zap.Int64("id", m.ID), zap.String("topic", m.Topic), zap.Int("attempts", attempts), zap.Error(perr))
+		_, err := tx.Exec(ctx, `
+			UPDATE outbox SET attempts = $1, last_error = $2, failed_at = now() WHERE id = $3
+		`, attempts, perr.Error(), m.ID)
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE outbox SET attempts = $1, last_error = $2, next_attempt_at = $3 WHERE id = $4
+	`, attempts, perr.Error(), time.Now().Add(backoff(attempts)), m.ID)
+	return err
+}
+
+// backoff doubles the wait with every attempt, starting at one second.
+func backoff(attempts int) time.Duration {
+	d := time.Second << (attempts - 1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// PurgeSent deletes messages that were sent before the given time.
+func (r *OutboxRepository) PurgeSent(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
@@ -0,0 +1,49 @@
+package payments
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+type WebhooksRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewWebhooksRepository(db *store.DB, log *zap.Logger) *WebhooksRepository {
+	return &WebhooksRepository{db: db, log: log}
+}
+
+// Process records a provider webhook event and runs apply in the same transaction, so an
+// event is applied at most once. It returns true without calling apply if the event was
+// already recorded. If apply fails nothing is recorded and the provider's retry is
+// processed again.
+func (r *WebhooksRepository) Process(ctx context.Context, eventID, eventType string, payload []byte, apply func(tx pgx.Tx) error) (bool, error) {
+	duplicate := false
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			INSERT INTO payment_webhook_events (event_id, event_type, payload)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (event_id) DO NOTHING
+		`, eventID, eventType, payload)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			duplicate = true
+			return nil
+		}
+		if apply == nil {
+			return nil
+		}
+		return apply(tx)
+	})
+	if err != nil {
+		return false, err
+	}
+	return duplicate, nil
+}
@@ -0,0 +1,134 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+// Lease is how long the worker that wrote or claimed a release has to hand its seats on
+// before another worker may retry it.
+const Lease = 2 * time.Minute
+
+var ErrDone = errors.New("seat release already handed on")
+
+// Release is a set of freed seats whose event and tier tokens are still held. It is
+// written in the transaction that frees the seats and completed once the tokens went to a
+// waitlist offer or back to the bucket, so a crash in between never loses them.
+type Release struct {
+	ID        string    `json:"id"`
+	EventID   string    `json:"event_id"`
+	SourceID  string    `json:"source_id"`
+	Seats     []string  `json:"seats"`
+	TierID    *string   `json:"tier_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const releaseColumns = `id, event_id, source_id, seats, tier_id, created_at`
+
+func scanRelease(row pgx.Row) (*Release, error) {
+	rel := &Release{}
+	var seatsJSON []byte
+	if err := row.Scan(&rel.ID, &rel.EventID, &rel.SourceID, &seatsJSON, &rel.TierID, &rel.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(seatsJSON, &rel.Seats); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+type ReleasesRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewReleasesRepository(db *store.DB, log *zap.Logger) *ReleasesRepository {
+	return &ReleasesRepository{db: db, log: log}
+}
+
+// EnqueueTx records the seats freed from sourceID inside the caller's transaction. The
+// release starts leased to the caller, which is expected to hand it on right after the
+// commit. It returns nil when there are no seats.
+func EnqueueTx(ctx context.Context, tx pgx.Tx, eventID, sourceID string, seatLabels []string, tierID *string) (*Release, error) {
+	if len(seatLabels) == 0 {
+		return nil, nil
+	}
+	seatsJSON, err := json.Marshal(seatLabels)
+	if err != nil {
+		return nil, err
+	}
+	return scanRelease(tx.QueryRow(ctx, `
+		INSERT INTO seat_releases (event_id, source_id, seats, tier_id, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+releaseColumns,
+		eventID, sourceID, seatsJSON, tierID, time.Now().Add(Lease)))
+}
+
+// ClaimDue leases up to limit pending releases whose previous lease ran out, oldest first.
+// Concurrent workers claim disjoint releases.
+func (r *ReleasesRepository) ClaimDue(ctx context.Context, now time.Time, limit int) ([]*Release, error) {
+	var claimed []*Release
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+releaseColumns+`
+			FROM seat_releases
+			WHERE done_at IS NULL AND locked_until <= $1
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, now, limit)
+		if err != nil {
+			return err
+		}
+		ids := []string{}
+		for rows.Next() {
+			rel, err := scanRelease(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			claimed = append(claimed, rel)
+			ids = append(ids, rel.ID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `UPDATE seat_releases SET locked_until = $1 WHERE id = ANY($2)`, now.Add(Lease), ids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// CompleteTx marks the release handed on inside the caller's transaction. It returns
+// ErrDone if another worker completed it first.
+func CompleteTx(ctx context.Context, tx pgx.Tx, id string) error {
+	result, err := tx.Exec(ctx, `UPDATE seat_releases SET done_at = now() WHERE id = $1 AND done_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDone
+	}
+	return nil
+}
+
+// Complete marks the release handed on.
+func (r *ReleasesRepository) Complete(ctx context.Context, id string) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return CompleteTx(ctx, tx, id)
+	})
+}
@@ -2,6 +2,9 @@ package seats
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -21,6 +24,16 @@ type Seat struct {
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
+// SeatsUnavailableError is returned when some of the requested seats could not be held
+// or booked. Labels lists the seats that were already taken or do not exist.
+type SeatsUnavailableError struct {
+	Labels []string
+}
+
+func (e *SeatsUnavailableError) Error() string {
+	return fmt.Sprintf("seats not available: %s", strings.Join(e.Labels, ", "))
+}
+
 type SeatsRepository struct {
 	db  *store.DB
 	log *zap.Logger
@@ -36,6 +49,7 @@ func (r *SeatsRepository) CreateSeats(ctx context.Context, eventID string, seatL
 			_, err := tx.Exec(ctx, `
 				INSERT INTO seats (event_id, seat_label, status)
 				VALUES ($1, $2, 'available')
+				ON CONFLICT (event_id, seat_label) DO NOTHING
 			`, eventID, label)
 			if err != nil {
 				return err
@@ -110,36 +124,90 @@ func (r *SeatsRepository) ReleaseSeats(ctx context.Context, eventID string, seat
 
 func (r *SeatsRepository) BookSeats(ctx context.Context, eventID string, seatLabels []string, bookingID string) error {
 	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
-		for _, label := range seatLabels {
-			_, err := tx.Exec(ctx, `
-				UPDATE seats 
-				SET status = 'booked', held_by_booking = $1, held_until = NULL, updated_at = now()
-				WHERE event_id = $2 AND seat_label = $3 AND status = 'held'
-			`, bookingID, eventID, label)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return BookSeatsTx(ctx, tx, eventID, seatLabels, bookingID)
 	})
 }
 
+// BookSeatsTx turns the booking's held seats into booked seats. Every label must be
+// held by this booking, otherwise a *SeatsUnavailableError is returned.
+func BookSeatsTx(ctx context.Context, tx pgx.Tx, eventID string, seatLabels []string, bookingID string) error {
+	var unavailable []string
+	for _, label := range seatLabels {
+		result, err := tx.Exec(ctx, `
+			UPDATE seats 
+			SET status = 'booked', held_until = NULL, updated_at = now()
+			WHERE event_id = $1 AND seat_label = $2 AND status = 'held' AND held_by_booking = $3
+		`, eventID, label, bookingID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			unavailable = append(unavailable, label)
+		}
+	}
+
+	if len(unavailable) > 0 {
+		return &SeatsUnavailableError{Labels: unavailable}
+	}
+	return nil
+}
+
+// HoldSeats holds all requested seats for a booking or none of them.
 func (r *SeatsRepository) HoldSeats(ctx context.Context, eventID string, seatLabels []string, bookingID string, heldUntil time.Time) error {
 	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
-		for _, label := range seatLabels {
-			_, err := tx.Exec(ctx, `
-				UPDATE seats 
-				SET status = 'held', held_by_booking = $1, held_until = $2, updated_at = now()
-				WHERE event_id = $3 AND seat_label = $4 AND status = 'available'
-			`, bookingID, heldUntil, eventID, label)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return HoldSeatsTx(ctx, tx, eventID, seatLabels, bookingID, heldUntil)
 	})
 }
 
+// HoldSeatsTx holds the seats inside the caller's transaction. If any label is not
+// available it returns a *SeatsUnavailableError and the caller must roll back.
+// Labels are updated in sorted order so concurrent holds lock rows consistently.
+func HoldSeatsTx(ctx context.Context, tx pgx.Tx, eventID string, seatLabels []string, bookingID string, heldUntil time.Time) error {
+	labels := append([]string(nil), seatLabels...)
+	sort.Strings(labels)
+
+	var unavailable []string
+	for _, label := range labels {
+		result, err := tx.Exec(ctx, `
+			UPDATE seats 
+			SET status = 'held', held_by_booking = $1, held_until = $2, updated_at = now()
+			WHERE event_id = $3 AND seat_label = $4 AND status = 'available'
+		`, bookingID, heldUntil, eventID, label)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			unavailable = append(unavailable, label)
+		}
+	}
+
+	if len(unavailable) > 0 {
+		return &SeatsUnavailableError{Labels: unavailable}
+	}
+	return nil
+}
+
+// ReleaseBookingSeatsTx frees every seat held or booked by the booking.
+func ReleaseBookingSeatsTx(ctx context.Context, tx pgx.Tx, eventID, bookingID string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE seats 
+		SET status = 'available', held_by_booking = NULL, held_until = NULL, updated_at = now()
+		WHERE event_id = $1 AND held_by_booking = $2
+	`, eventID, bookingID)
+	return err
+}
+
+// ReleaseBookingLabelsTx frees the given seats of the booking, leaving its other seats
+// untouched.
+func ReleaseBookingLabelsTx(ctx context.Context, tx pgx.Tx, eventID, bookingID string, seatLabels []string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE seats 
+		SET status = 'available', held_by_booking = NULL, held_until = NULL, updated_at = now()
+		WHERE event_id = $1 AND held_by_booking = $2 AND seat_label = ANY($3)
+	`, eventID, bookingID, seatLabels)
+	return err
+}
+
 func (r *SeatsRepository) GetAvailableSeats(ctx context.Context, eventID string) ([]string, error) {
 	query := `
 		SELECT seat_label 
@@ -164,3 +232,105 @@ func (r *SeatsRepository) GetAvailableSeats(ctx context.Context, eventID string)
 
 	return seats, nil
 }
+
+// AddSeatsTx creates available seats inside the caller's transaction. Labels the event
+// already has are returned as a *SeatsUnavailableError; the unique index on the event's
+// labels makes this hold against concurrent inserts too.
+func AddSeatsTx(ctx context.Context, tx pgx.Tx, eventID string, seatLabels []string) error {
+	rows, err := tx.Query(ctx, `
+		INSERT INTO seats (event_id, seat_label, status)
+		SELECT $1, label, 'available'
+		FROM unnest($2::text[]) AS label
+		ON CONFLICT (event_id, seat_label) DO NOTHING
+		RETURNING seat_label
+	`, eventID, seatLabels)
+	if err != nil {
+		return err
+	}
+	inserted := map[string]bool{}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			rows.Close()
+			return err
+		}
+		inserted[label] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var existing []string
+	for _, label := range seatLabels {
+		if !inserted[label] {
+			existing = append(existing, label)
+		}
+	}
+	if len(existing) > 0 {
+		return &SeatsUnavailableError{Labels: existing}
+	}
+	return nil
+}
+
+// RemoveAvailableSeatsTx deletes n available seats inside the caller's transaction and
+// returns their labels. The given labels are removed if any, otherwise the last available
+// labels are. Labels that are held, booked or missing are returned as a
+// *SeatsUnavailableError.
+func RemoveAvailableSeatsTx(ctx context.Context, tx pgx.Tx, eventID string, n int, seatLabels []string) ([]string, error) {
+	var rows pgx.Rows
+	var err error
+	if len(seatLabels) > 0 {
+		rows, err = tx.Query(ctx, `
+			DELETE FROM seats
+			WHERE event_id = $1 AND status = 'available' AND seat_label = ANY($2)
+			RETURNING seat_label
+		`, eventID, seatLabels)
+	} else {
+		rows, err = tx.Query(ctx, `
+			DELETE FROM seats
+			WHERE event_id = $1 AND id IN (
+				SELECT id FROM seats
+				WHERE event_id = $1 AND status = 'available'
+				ORDER BY seat_label DESC
+				LIMIT $2
+				FOR UPDATE
+			)
+			RETURNING seat_label
+		`, eventID, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		removed = append(removed, label)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(seatLabels) > 0 && len(removed) < len(seatLabels) {
+		gone := make(map[string]bool, len(removed))
+		for _, label := range removed {
+			gone[label] = true
+		}
+		var unavailable []string
+		for _, label := range seatLabels {
+			if !gone[label] {
+				unavailable = append(unavailable, label)
+			}
+		}
+		return nil, &SeatsUnavailableError{Labels: unavailable}
+	}
+	if len(removed) < n {
+		return nil, &SeatsUnavailableError{}
+	}
+	return removed, nil
+}
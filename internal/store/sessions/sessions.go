@@ -0,0 +1,169 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+var (
+	ErrInvalidToken = errors.New("refresh token is invalid or expired")
+	// ErrTokenReused means a refresh token was presented after it had been rotated, so
+	// it may have been stolen. Its whole family is revoked.
+	ErrTokenReused = errors.New("refresh token was already used")
+)
+
+// RefreshToken is one link of a family of rotating refresh tokens. Only the hash of the
+// token is stored.
+type RefreshToken struct {
+	ID              string
+	FamilyID        string
+	UserID          string
+	TokenHash       string
+	AccessJTI       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+}
+
+// AccessGrant is an access token issued with a refresh token, to be denylisted when the
+// family is revoked.
+type AccessGrant struct {
+	JTI       string
+	ExpiresAt time.Time
+}
+
+type SessionsRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewSessionsRepository(db *store.DB, log *zap.Logger) *SessionsRepository {
+	return &SessionsRepository{db: db, log: log}
+}
+
+// Create stores the first token of a new family, or of the family set on t.
+func (r *SessionsRepository) Create(ctx context.Context, t *RefreshToken) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return insertTx(ctx, tx, t)
+	})
+}
+
+// Rotate exchanges the token with the given hash for next, which joins the same family and
+// user. A token that was already rotated revokes its family and returns ErrTokenReused with
+// the family's access grants; revoked, expired and unknown tokens return ErrInvalidToken.
+func (r *SessionsRepository) Rotate(ctx context.Context, hash string, next *RefreshToken) ([]AccessGrant, error) {
+	var grants []AccessGrant
+	reused := false
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var id string
+		var expiresAt time.Time
+		var rotatedAt, revokedAt *time.Time
+		err := tx.QueryRow(ctx, `
+			SELECT id, family_id, user_id, expires_at, rotated_at, revoked_at
+			FROM refresh_tokens
+			WHERE token_hash = $1
+			FOR UPDATE
+		`, hash).Scan(&id, &next.FamilyID, &next.UserID, &expiresAt, &rotatedAt, &revokedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if revokedAt != nil || !expiresAt.After(time.Now()) {
+			return ErrInvalidToken
+		}
+		if rotatedAt != nil {
+			// Committed on purpose: the family stays revoked even though the call fails
+			reused = true
+			grants, err = revokeFamilyTx(ctx, tx, next.FamilyID)
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET rotated_at = now() WHERE id = $1`, id); err != nil {
+			return err
+		}
+		return insertTx(ctx, tx, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return grants, ErrTokenReused
+	}
+	return nil, nil
+}
+
+// RevokeByHash revokes the family of the token with the given hash and returns its access
+// grants. Unknown tokens revoke nothing.
+func (r *SessionsRepository) RevokeByHash(ctx context.Context, hash string) ([]AccessGrant, error) {
+	var grants []AccessGrant
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var familyID string
+		err := tx.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, hash).Scan(&familyID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		grants, err = revokeFamilyTx(ctx, tx, familyID)
+		return err
+	})
+	return grants, err
+}
+
+// RevokeUser revokes every family of the user, signing them out everywhere.
+func (r *SessionsRepository) RevokeUser(ctx context.Context, userID string) ([]AccessGrant, error) {
+	var grants []AccessGrant
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		grants, err = revokeTx(ctx, tx, "user_id", userID)
+		return err
+	})
+	return grants, err
+}
+
+func insertTx(ctx context.Context, tx pgx.Tx, t *RefreshToken) error {
+	return tx.QueryRow(ctx, `
+		INSERT INTO refresh_tokens (family_id, user_id, token_hash, access_jti, access_expires_at, expires_at)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6)
+		RETURNING id, family_id
+	`, t.FamilyID, t.UserID, t.TokenHash, t.AccessJTI, t.AccessExpiresAt, t.ExpiresAt).Scan(&t.ID, &t.FamilyID)
+}
+
+func revokeFamilyTx(ctx context.Context, tx pgx.Tx, familyID string) ([]AccessGrant, error) {
+	return revokeTx(ctx, tx, "family_id", familyID)
+}
+
+// revokeTx revokes the tokens matching column and returns the access grants that have not
+// expired yet. column is never user input.
+func revokeTx(ctx context.Context, tx pgx.Tx, column, id string) ([]AccessGrant, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = COALESCE(revoked_at, now())
+		WHERE `+column+` = $1
+		RETURNING access_jti, access_expires_at
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []AccessGrant
+	for rows.Next() {
+		var g AccessGrant
+		if err := rows.Scan(&g.JTI, &g.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if g.ExpiresAt.After(time.Now()) {
+			grants = append(grants, g)
+		}
+	}
+	return grants, rows.Err()
+}
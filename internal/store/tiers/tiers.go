@@ -0,0 +1,145 @@
+package tiers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+var (
+	// ErrEmptyZone is returned when a zone tier matches none of the event's seats.
+	ErrEmptyZone = errors.New("no seats of the event are in this price zone")
+	// ErrQuotaExceedsZone is returned when a zone tier's quota is larger than its zone.
+	ErrQuotaExceedsZone = errors.New("quota exceeds the number of seats in the price zone")
+)
+
+type Tier struct {
+	ID            string     `json:"id"`
+	EventID       string     `json:"event_id"`
+	Name          string     `json:"name"`
+	Price         float64    `json:"price"`
+	Quota         int        `json:"quota"`
+	SaleStartsAt  *time.Time `json:"sale_starts_at,omitempty"`
+	SaleEndsAt    *time.Time `json:"sale_ends_at,omitempty"`
+	MaxPerBooking int        `json:"max_per_booking"`
+	PriceZone     string     `json:"price_zone,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type TiersRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewTiersRepository(db *store.DB, log *zap.Logger) *TiersRepository {
+	return &TiersRepository{db: db, log: log}
+}
+
+// Create inserts the tier. A tier with a price zone is bound to the event seats generated
+// from venue seats in that zone; if it has no quota, the quota becomes the number of seats
+// bound. apply is called with the tier in the same transaction.
+func (r *TiersRepository) Create(ctx context.Context, t *Tier, apply func(tx pgx.Tx) error) (*Tier, error) {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Zone tiers default their quota to the zone size, which is only known after binding
+		quota := t.Quota
+		if quota <= 0 {
+			quota = 1
+		}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO ticket_tiers (event_id, name, price, quota, sale_starts_at, sale_ends_at, max_per_booking, price_zone)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, created_at, updated_at
+		`, t.EventID, t.Name, t.Price, quota, t.SaleStartsAt, t.SaleEndsAt, t.MaxPerBooking, t.PriceZone).
+			Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if t.PriceZone == "" {
+			return apply(tx)
+		}
+		result, err := tx.Exec(ctx, `
+			UPDATE seats s
+			SET tier_id = $1
+			FROM events e
+			JOIN venue_seats vs ON vs.venue_id = e.venue_id
+			WHERE e.id = $2 AND s.event_id = $2 AND s.seat_label = vs.label AND vs.price_zone = $3
+		`, t.ID, t.EventID, t.PriceZone)
+		if err != nil {
+			return err
+		}
+		bound := int(result.RowsAffected())
+		if bound == 0 {
+			return ErrEmptyZone
+		}
+		if t.Quota > bound {
+			return ErrQuotaExceedsZone
+		}
+		if t.Quota <= 0 {
+			t.Quota = bound
+			if _, err := tx.Exec(ctx, `UPDATE ticket_tiers SET quota = $1 WHERE id = $2`, t.Quota, t.ID); err != nil {
+				return err
+			}
+		}
+		return apply(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *TiersRepository) ListByEvent(ctx context.Context, eventID string) ([]*Tier, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, event_id, name, price, quota, sale_starts_at, sale_ends_at, max_per_booking, price_zone, created_at, updated_at
+		FROM ticket_tiers
+		WHERE event_id = $1
+		ORDER BY price DESC, name
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tiers []*Tier
+	for rows.Next() {
+		t := &Tier{}
+		err := rows.Scan(&t.ID, &t.EventID, &t.Name, &t.Price, &t.Quota, &t.SaleStartsAt, &t.SaleEndsAt,
+			&t.MaxPerBooking, &t.PriceZone, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers, rows.Err()
+}
+
+// SeatTiers returns the tier each of the given seats is bound to. Seats without a tier are
+// left out.
+func (r *TiersRepository) SeatTiers(ctx context.Context, eventID string, labels []string) (map[string]string, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT seat_label, tier_id
+		FROM seats
+		WHERE event_id = $1 AND seat_label = ANY($2) AND tier_id IS NOT NULL
+	`, eventID, labels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bound := make(map[string]string)
+	for rows.Next() {
+		var label, tierID string
+		if err := rows.Scan(&label, &tierID); err != nil {
+			return nil, err
+		}
+		bound[label] = tierID
+	}
+	return bound, rows.Err()
+}
@@ -0,0 +1,131 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TwoFactor is a user's TOTP state. Secret is encrypted by the caller; it is set while
+// enrollment is pending and EnabledAt is nil until the first code is confirmed.
+type TwoFactor struct {
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+// GetTwoFactor returns the user's TOTP state, or nil for an unknown user.
+func (r *UsersRepository) GetTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	tf := &TwoFactor{}
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT totp_secret, totp_enabled_at, totp_last_step
+		FROM users
+		WHERE id = $1`, userID).Scan(&tf.Secret, &tf.EnabledAt, &tf.LastStep)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tf, nil
+}
+
+// SetPendingTOTP stores a new secret awaiting confirmation. pgx.ErrNoRows means the user
+// is unknown or already has 2FA enabled.
+func (r *UsersRepository) SetPendingTOTP(ctx context.Context, userID, secret string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET totp_secret = $2, totp_last_step = 0, updated_at = now()
+		WHERE id = $1 AND totp_enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// EnableTOTP turns on 2FA with the pending secret and replaces the recovery codes.
+func (r *UsersRepository) EnableTOTP(ctx context.Context, userID string, codeHashes []string) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE users
+			SET totp_enabled_at = now(), updated_at = now()
+			WHERE id = $1 AND totp_secret <> '' AND totp_enabled_at IS NULL`, userID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return replaceRecoveryCodesTx(ctx, tx, userID, codeHashes)
+	})
+}
+
+// DisableTOTP removes the secret and recovery codes.
+func (r *UsersRepository) DisableTOTP(ctx context.Context, userID string) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE users
+			SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, updated_at = now()
+			WHERE id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// UseTOTPStep records step as the last accepted one. It returns false if that step or a
+// later one was already used, which means the code is being replayed.
+func (r *UsersRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET totp_last_step = $2
+		WHERE id = $1 AND totp_last_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode spends the unused recovery code with the given hash, reporting whether
+// there was one.
+func (r *UsersRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE recovery_codes
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// ReplaceRecoveryCodes swaps all of the user's recovery codes for new ones.
+func (r *UsersRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return replaceRecoveryCodesTx(ctx, tx, userID, codeHashes)
+	})
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func (r *UsersRepository) RemainingRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodesTx(ctx context.Context, tx pgx.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])`, userID, codeHashes)
+	return err
+}
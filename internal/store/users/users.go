@@ -11,16 +11,18 @@ import (
 )
 
 type User struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	Email         string    `json:"email"`
-	Phone         string    `json:"phone"`
-	PasswordHash  string    `json:"-"` // Don't expose in JSON
-	OAuthProvider string    `json:"oauth_provider,omitempty"`
-	OAuthSub      string    `json:"oauth_sub,omitempty"`
-	Role          string    `json:"role"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Phone         string `json:"phone"`
+	PasswordHash  string `json:"-"` // Don't expose in JSON
+	OAuthProvider string `json:"oauth_provider,omitempty"`
+	OAuthSub      string `json:"oauth_sub,omitempty"`
+	Role          string `json:"role"`
+	// EmailVerifiedAt is nil until the user confirms they own the email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type UsersRepository struct {
@@ -34,11 +36,11 @@ func NewUsersRepository(db *store.DB, log *zap.Logger) *UsersRepository {
 
 func (r *UsersRepository) Create(ctx context.Context, user *User) (*User, error) {
 	query := `
-		INSERT INTO users (name, email, phone, password_hash, role)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (name, email, phone, password_hash, oauth_provider, oauth_sub, role, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.Pool.QueryRow(ctx, query, user.Name, user.Email, user.Phone, user.PasswordHash, user.Role).
+	err := r.db.Pool.QueryRow(ctx, query, user.Name, user.Email, user.Phone, user.PasswordHash, user.OAuthProvider, user.OAuthSub, user.Role, user.EmailVerifiedAt).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -49,14 +51,14 @@ func (r *UsersRepository) Create(ctx context.Context, user *User) (*User, error)
 
 func (r *UsersRepository) GetByID(ctx context.Context, id string) (*User, error) {
 	query := `
-		SELECT id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, created_at, updated_at
+		SELECT id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, email_verified_at, created_at, updated_at
 		FROM users
 		WHERE id = $1`
 
 	user := &User{}
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
 		&user.ID, &user.Name, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.OAuthProvider, &user.OAuthSub, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.OAuthProvider, &user.OAuthSub, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -70,14 +72,14 @@ func (r *UsersRepository) GetByID(ctx context.Context, id string) (*User, error)
 
 func (r *UsersRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, created_at, updated_at
+		SELECT id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, email_verified_at, created_at, updated_at
 		FROM users
 		WHERE email = $1`
 
 	user := &User{}
 	err := r.db.Pool.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Name, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.OAuthProvider, &user.OAuthSub, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.OAuthProvider, &user.OAuthSub, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -89,6 +91,78 @@ func (r *UsersRepository) GetByEmail(ctx context.Context, email string) (*User,
 	return user, nil
 }
 
+// GetByOAuth returns the user signed in with the given external identity, or nil.
+func (r *UsersRepository) GetByOAuth(ctx context.Context, provider, sub string) (*User, error) {
+	query := `
+		SELECT id, name, email, phone, password_hash, oauth_provider, oauth_sub, role, email_verified_at, created_at, updated_at
+		FROM users
+		WHERE oauth_provider = $1 AND oauth_sub = $2 AND oauth_sub <> ''`
+
+	user := &User{}
+	err := r.db.Pool.QueryRow(ctx, query, provider, sub).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Phone, &user.PasswordHash,
+		&user.OAuthProvider, &user.OAuthSub, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// LinkOAuth attaches an external identity to a user that has verified their email and has
+// no identity yet; pgx.ErrNoRows means the user is already linked or unverified.
+func (r *UsersRepository) LinkOAuth(ctx context.Context, userID, provider, sub string) error {
+	query := `
+		UPDATE users
+		SET oauth_provider = $2, oauth_sub = $3, updated_at = now()
+		WHERE id = $1 AND oauth_sub = '' AND email_verified_at IS NOT NULL`
+
+	result, err := r.db.Pool.Exec(ctx, query, userID, provider, sub)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user owns email. pgx.ErrNoRows means the user is gone
+// or their address is no longer email.
+func (r *UsersRepository) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+		WHERE id = $1 AND email = $2`
+
+	result, err := r.db.Pool.Exec(ctx, query, userID, email)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// IsEmailVerified reports whether the user has verified their email; unknown users have not.
+func (r *UsersRepository) IsEmailVerified(ctx context.Context, userID string) (bool, error) {
+	var verified bool
+	err := r.db.Pool.QueryRow(ctx, `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&verified)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return verified, err
+}
+
 func (r *UsersRepository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
 	query := `
 		UPDATE users 
@@ -0,0 +1,278 @@
+package venues
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+// ErrVenueInUse is returned when deleting a venue that events still refer to.
+var ErrVenueInUse = errors.New("venue is used by one or more events")
+
+type Venue struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Address   string          `json:"address"`
+	Metadata  json.RawMessage `json:"metadata"`
+	SeatCount int             `json:"seat_count"`
+	Sections  []*Section      `json:"sections,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type Section struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PriceZone string `json:"price_zone"`
+	Position  int    `json:"position"`
+	Rows      []*Row `json:"rows"`
+}
+
+type Row struct {
+	Label string  `json:"label"`
+	Seats []*Seat `json:"seats"`
+}
+
+// Seat is a seat in the venue template. Status is only set when the seat is read as part
+// of an event seat map.
+type Seat struct {
+	ID         string  `json:"id"`
+	Number     int     `json:"number"`
+	Label      string  `json:"label"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Accessible bool    `json:"accessible"`
+	PriceZone  string  `json:"price_zone"`
+	Status     string  `json:"status,omitempty"`
+}
+
+type VenuesRepository struct {
+	db  *store.DB
+	log *zap.Logger
+}
+
+func NewVenuesRepository(db *store.DB, log *zap.Logger) *VenuesRepository {
+	return &VenuesRepository{db: db, log: log}
+}
+
+// Create stores the venue together with its whole layout in one transaction. Sections
+// are stored in the given order; seats take their section's price zone unless they
+// specify their own.
+func (r *VenuesRepository) Create(ctx context.Context, v *Venue) (*Venue, error) {
+	if len(v.Metadata) == 0 {
+		v.Metadata = json.RawMessage(`{}`)
+	}
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO venues (name, address, metadata)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at, updated_at
+		`, v.Name, v.Address, v.Metadata).Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		v.SeatCount = 0
+		for i, section := range v.Sections {
+			section.Position = i
+			err := tx.QueryRow(ctx, `
+				INSERT INTO venue_sections (venue_id, name, price_zone, position)
+				VALUES ($1, $2, $3, $4)
+				RETURNING id
+			`, v.ID, section.Name, section.PriceZone, section.Position).Scan(&section.ID)
+			if err != nil {
+				return err
+			}
+
+			for rowPos, row := range section.Rows {
+				for _, seat := range row.Seats {
+					if seat.PriceZone == "" {
+						seat.PriceZone = section.PriceZone
+					}
+					err := tx.QueryRow(ctx, `
+						INSERT INTO venue_seats (venue_id, section_id, row_label, row_position, seat_number, label, x, y, accessible, price_zone)
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+						RETURNING id
+					`, v.ID, section.ID, row.Label, rowPos, seat.Number, seat.Label, seat.X, seat.Y, seat.Accessible, seat.PriceZone).Scan(&seat.ID)
+					if err != nil {
+						return err
+					}
+					v.SeatCount++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Get returns the venue with its full layout, or nil if it does not exist.
+func (r *VenuesRepository) Get(ctx context.Context, id string) (*Venue, error) {
+	v := &Venue{}
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT v.id, v.name, v.address, v.metadata, v.created_at, v.updated_at,
+			(SELECT COUNT(*) FROM venue_seats s WHERE s.venue_id = v.id)
+		FROM venues v
+		WHERE v.id = $1
+	`, id).Scan(&v.ID, &v.Name, &v.Address, &v.Metadata, &v.CreatedAt, &v.UpdatedAt, &v.SeatCount)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT sec.id, sec.name, sec.price_zone, sec.position,
+			s.id, s.row_label, s.seat_number, s.label, s.x, s.y, s.accessible, s.price_zone, ''
+		FROM venue_sections sec
+		JOIN venue_seats s ON s.section_id = sec.id
+		WHERE sec.venue_id = $1
+		ORDER BY sec.position, s.row_position, s.seat_number
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	v.Sections, err = scanLayout(rows)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// List returns venues without their layouts.
+func (r *VenuesRepository) List(ctx context.Context, limit, offset int) ([]*Venue, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT v.id, v.name, v.address, v.metadata, v.created_at, v.updated_at,
+			(SELECT COUNT(*) FROM venue_seats s WHERE s.venue_id = v.id)
+		FROM venues v
+		ORDER BY v.name
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var venues []*Venue
+	for rows.Next() {
+		v := &Venue{}
+		if err := rows.Scan(&v.ID, &v.Name, &v.Address, &v.Metadata, &v.CreatedAt, &v.UpdatedAt, &v.SeatCount); err != nil {
+			return nil, err
+		}
+		venues = append(venues, v)
+	}
+	return venues, rows.Err()
+}
+
+// Update changes the venue details. The layout is immutable once created because
+// events copy their seats from it.
+func (r *VenuesRepository) Update(ctx context.Context, id, name, address string, metadata json.RawMessage) error {
+	if len(metadata) == 0 {
+		metadata = json.RawMessage(`{}`)
+	}
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE venues SET name = $1, address = $2, metadata = $3 WHERE id = $4
+	`, name, address, metadata, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *VenuesRepository) Delete(ctx context.Context, id string) error {
+	var inUse bool
+	if err := r.db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM events WHERE venue_id = $1)`, id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrVenueInUse
+	}
+
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM venues WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GenerateEventSeats creates an available seat for the event for every seat in the venue
+// template and returns how many were created.
+func (r *VenuesRepository) GenerateEventSeats(ctx context.Context, eventID, venueID string) (int, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO seats (event_id, seat_label, status)
+		SELECT $1, label, 'available'
+		FROM venue_seats
+		WHERE venue_id = $2
+		ON CONFLICT (event_id, seat_label) DO NOTHING
+	`, eventID, venueID)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// SeatMap returns the venue layout of an event with each seat's live status from the
+// seats table. Seats missing from the event are reported as unavailable.
+func (r *VenuesRepository) SeatMap(ctx context.Context, eventID, venueID string) ([]*Section, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT sec.id, sec.name, sec.price_zone, sec.position,
+			s.id, s.row_label, s.seat_number, s.label, s.x, s.y, s.accessible, s.price_zone,
+			COALESCE(es.status, 'unavailable')
+		FROM venue_sections sec
+		JOIN venue_seats s ON s.section_id = sec.id
+		LEFT JOIN seats es ON es.event_id = $1 AND es.seat_label = s.label
+		WHERE sec.venue_id = $2
+		ORDER BY sec.position, s.row_position, s.seat_number
+	`, eventID, venueID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLayout(rows)
+}
+
+// scanLayout folds rows ordered by section, row and seat into the nested layout.
+func scanLayout(rows pgx.Rows) ([]*Section, error) {
+	defer rows.Close()
+
+	var sections []*Section
+	var section *Section
+	var row *Row
+	for rows.Next() {
+		var sec Section
+		var rowLabel string
+		seat := &Seat{}
+		err := rows.Scan(&sec.ID, &sec.Name, &sec.PriceZone, &sec.Position,
+			&seat.ID, &rowLabel, &seat.Number, &seat.Label, &seat.X, &seat.Y, &seat.Accessible, &seat.PriceZone, &seat.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		if section == nil || section.ID != sec.ID {
+			section = &sec
+			sections = append(sections, section)
+			row = nil
+		}
+		if row == nil || row.Label != rowLabel {
+			row = &Row{Label: rowLabel}
+			section.Rows = append(section.Rows, row)
+		}
+		row.Seats = append(row.Seats, seat)
+	}
+	return sections, rows.Err()
+}
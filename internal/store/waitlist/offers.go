@@ -0,0 +1,262 @@
+package waitlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/releases"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/seats"
+)
+
+var ErrOfferClosed = errors.New("offer is no longer open")
+
+// Offer is a set of freed seats offered to a waitlisted user. While the offer is open its
+// seats are held with the offer ID as the holding booking.
+type Offer struct {
+	ID          string     `json:"id"`
+	EventID     string     `json:"event_id"`
+	WaitlistID  string     `json:"waitlist_id"`
+	UserID      string     `json:"user_id"`
+	Seats       []string   `json:"seats"`
+	TierID      *string    `json:"tier_id"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	BookingID   *string    `json:"booking_id,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// Release records the seats freed when the offer was declined or expired
+	Release *releases.Release `json:"-"`
+}
+
+const offerColumns = `id, event_id, waitlist_id, user_id, seats, tier_id, status, expires_at, booking_id, responded_at, created_at`
+
+func scanOffer(row pgx.Row) (*Offer, error) {
+	o := &Offer{}
+	var seatsJSON []byte
+	err := row.Scan(&o.ID, &o.EventID, &o.WaitlistID, &o.UserID, &seatsJSON, &o.TierID, &o.Status,
+		&o.ExpiresAt, &o.BookingID, &o.RespondedAt, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(seatsJSON, &o.Seats); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// CreateOffer offers the seats to the waitlist entry until expiresAt, holding them and
+// marking the entry notified in the same transaction. apply, if set, runs in that
+// transaction too. If a seat was taken meanwhile a *seats.SeatsUnavailableError is
+// returned and nothing is written.
+func (r *WaitlistRepository) CreateOffer(ctx context.Context, eventID, waitlistID, userID string, seatLabels []string, tierID *string, expiresAt time.Time, apply func(tx pgx.Tx) error) (*Offer, error) {
+	seatsJSON, err := json.Marshal(seatLabels)
+	if err != nil {
+		return nil, err
+	}
+	var offer *Offer
+	err = r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		offer, err = scanOffer(tx.QueryRow(ctx, `
+			INSERT INTO waitlist_offers (event_id, waitlist_id, user_id, seats, tier_id, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING `+offerColumns,
+			eventID, waitlistID, userID, seatsJSON, tierID, expiresAt))
+		if err != nil {
+			return err
+		}
+		if err := seats.HoldSeatsTx(ctx, tx, eventID, seatLabels, offer.ID, expiresAt); err != nil {
+			return err
+		}
+		if err := MarkNotifiedTx(ctx, tx, eventID, waitlistID); err != nil {
+			return err
+		}
+		return bookings.AuditTx(ctx, tx, nil, eventID, userID, bookings.AuditPromoted, map[string]any{"offer_id": offer.ID, "seats": seatLabels})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+func (r *WaitlistRepository) GetOffer(ctx context.Context, id string) (*Offer, error) {
+	offer, err := scanOffer(r.db.Pool.QueryRow(ctx, `SELECT `+offerColumns+` FROM waitlist_offers WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return offer, err
+}
+
+// ListOffers returns the user's open offers.
+func (r *WaitlistRepository) ListOffers(ctx context.Context, userID string) ([]*Offer, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+offerColumns+`
+		FROM waitlist_offers
+		WHERE user_id = $1 AND status = 'offered' AND expires_at > now()
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var offers []*Offer
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	return offers, rows.Err()
+}
+
+// AcceptOffer closes the user's open offer and releases its seat holds, then calls create
+// in the same transaction to book the seats; create returns the new booking ID. The
+// waitlist entry is removed.
+func (r *WaitlistRepository) AcceptOffer(ctx context.Context, id, userID string, create func(tx pgx.Tx, o *Offer) (string, error)) (*Offer, error) {
+	var offer *Offer
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		offer, err = lockOpenOffer(ctx, tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if !offer.ExpiresAt.After(time.Now()) {
+			return ErrOfferClosed
+		}
+		if err := seats.ReleaseBookingLabelsTx(ctx, tx, offer.EventID, offer.ID, offer.Seats); err != nil {
+			return err
+		}
+		bookingID, err := create(tx, offer)
+		if err != nil {
+			return err
+		}
+		if err := closeOfferTx(ctx, tx, offer, "accepted", &bookingID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM waitlist WHERE event_id = $1 AND id = $2`, offer.EventID, offer.WaitlistID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// DeclineOffer closes the user's open offer, frees its seats and takes the user off the
+// waitlist. The freed seats are recorded in the offer's Release.
+func (r *WaitlistRepository) DeclineOffer(ctx context.Context, id, userID string) (*Offer, error) {
+	var offer *Offer
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		offer, err = lockOpenOffer(ctx, tx, id, userID)
+		if err != nil {
+			return err
+		}
+		return releaseOfferTx(ctx, tx, offer, "declined")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// ClaimExpiredOffers closes up to limit open offers past their expiry, freeing their seats
+// and taking their users off the waitlist. Concurrent workers claim disjoint offers. The
+// freed seats are recorded in each offer's Release in the same transaction, so they are
+// handed on even if the caller stops before doing so.
+func (r *WaitlistRepository) ClaimExpiredOffers(ctx context.Context, now time.Time, limit int) ([]*Offer, error) {
+	var offers []*Offer
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+offerColumns+`
+			FROM waitlist_offers
+			WHERE status = 'offered' AND expires_at <= $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, now, limit)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			o, err := scanOffer(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			offers = append(offers, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, o := range offers {
+			if err := releaseOfferTx(ctx, tx, o, "expired"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// lockOpenOffer locks the user's offer, returning pgx.ErrNoRows if it does not exist and
+// ErrOfferClosed if it was already answered or expired.
+func lockOpenOffer(ctx context.Context, tx pgx.Tx, id, userID string) (*Offer, error) {
+	offer, err := scanOffer(tx.QueryRow(ctx, `
+		SELECT `+offerColumns+`
+		FROM waitlist_offers
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status != "offered" {
+		return nil, ErrOfferClosed
+	}
+	return offer, nil
+}
+
+func releaseOfferTx(ctx context.Context, tx pgx.Tx, o *Offer, status string) error {
+	if err := seats.ReleaseBookingLabelsTx(ctx, tx, o.EventID, o.ID, o.Seats); err != nil {
+		return err
+	}
+	if err := closeOfferTx(ctx, tx, o, status, nil); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE waitlist SET opted_out = true WHERE event_id = $1 AND id = $2`, o.EventID, o.WaitlistID); err != nil {
+		return err
+	}
+	rel, err := releases.EnqueueTx(ctx, tx, o.EventID, o.ID, o.Seats, o.TierID)
+	if err != nil {
+		return err
+	}
+	o.Release = rel
+	return nil
+}
+
+func closeOfferTx(ctx context.Context, tx pgx.Tx, o *Offer, status string, bookingID *string) error {
+	err := tx.QueryRow(ctx, `
+		UPDATE waitlist_offers
+		SET status = $1, booking_id = $2, responded_at = now()
+		WHERE id = $3
+		RETURNING responded_at
+	`, status, bookingID, o.ID).Scan(&o.RespondedAt)
+	if err != nil {
+		return err
+	}
+	o.Status = status
+	o.BookingID = bookingID
+	return nil
+}
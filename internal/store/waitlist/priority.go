@@ -0,0 +1,169 @@
+package waitlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Priority groups. Users in a group the event has a rule for are promoted before everyone
+// with a lower priority, whatever their position.
+const (
+	GroupMember           = "member"
+	GroupPreviousAttendee = "previous_attendee"
+	GroupAccessibility    = "accessibility"
+)
+
+type PriorityRule struct {
+	Group    string `json:"group"`
+	Priority int    `json:"priority"`
+}
+
+// priorityQuery picks the highest-priority rule of the event that the user qualifies for.
+// %[1]s and %[2]s are the SQL expressions of the event and user IDs. A previous attendee
+// holds a booking for another event that has already ended.
+const priorityQuery = `
+	SELECT r.priority, r.grp
+	FROM waitlist_priority_rules r
+	JOIN users u ON u.id = %[2]s
+	WHERE r.event_id = %[1]s AND (
+		(r.grp = 'member' AND u.member) OR
+		(r.grp = 'accessibility' AND u.accessibility_needs) OR
+		(r.grp = 'previous_attendee' AND EXISTS (
+			SELECT 1 FROM bookings b JOIN events e ON e.id = b.event_id
+			WHERE b.user_id = u.id AND b.status = 'booked' AND b.event_id <> r.event_id AND e.end_time < now()
+		))
+	)
+	ORDER BY r.priority DESC
+	LIMIT 1`
+
+// priorityTx returns the user's priority on the event's waitlist and the group it comes
+// from, or 0 and nil when no rule applies.
+func priorityTx(ctx context.Context, tx pgx.Tx, eventID, userID string) (int, *string, error) {
+	var priority int
+	var group *string
+	err := tx.QueryRow(ctx, fmt.Sprintf(priorityQuery, "$1::uuid", "$2::uuid"), eventID, userID).Scan(&priority, &group)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, nil
+	}
+	return priority, group, err
+}
+
+// refreshPrioritiesTx recomputes the priority of the active entries matching cond, which
+// compares a column of x with $1. It returns how many entries were updated.
+func refreshPrioritiesTx(ctx context.Context, tx pgx.Tx, cond string, arg any) (int64, error) {
+	result, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE waitlist w
+		SET priority = COALESCE(p.priority, 0), priority_group = p.grp
+		FROM waitlist x
+		LEFT JOIN LATERAL (%s) p ON true
+		WHERE w.event_id = x.event_id AND w.id = x.id AND x.opted_out = false AND %s
+	`, fmt.Sprintf(priorityQuery, "x.event_id", "x.user_id"), cond), arg)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const priorityRulesQuery = `
+	SELECT grp, priority FROM waitlist_priority_rules
+	WHERE event_id = $1
+	ORDER BY priority DESC, grp`
+
+// PriorityRules returns the event's rules, highest priority first.
+func (r *WaitlistRepository) PriorityRules(ctx context.Context, eventID string) ([]PriorityRule, error) {
+	rows, err := r.db.Pool.Query(ctx, priorityRulesQuery, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPriorityRules(rows)
+}
+
+func priorityRulesTx(ctx context.Context, tx pgx.Tx, eventID string) ([]PriorityRule, error) {
+	rows, err := tx.Query(ctx, priorityRulesQuery, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPriorityRules(rows)
+}
+
+func scanPriorityRules(rows pgx.Rows) ([]PriorityRule, error) {
+	defer rows.Close()
+	rules := []PriorityRule{}
+	for rows.Next() {
+		var rule PriorityRule
+		if err := rows.Scan(&rule.Group, &rule.Priority); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SetPriorityRules replaces the event's rules and re-ranks the users already waiting. apply
+// is called with the rules before and after in the same transaction, which holds the event
+// row so concurrent changes apply one after the other. It returns how many active entries
+// were re-ranked, and pgx.ErrNoRows for an unknown event.
+func (r *WaitlistRepository) SetPriorityRules(ctx context.Context, eventID string, rules []PriorityRule, apply func(tx pgx.Tx, before, after []PriorityRule) error) (int64, error) {
+	var n int64
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var id string
+		if err := tx.QueryRow(ctx, `SELECT id FROM events WHERE id = $1 FOR UPDATE`, eventID).Scan(&id); err != nil {
+			return err
+		}
+		before, err := priorityRulesTx(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM waitlist_priority_rules WHERE event_id = $1`, eventID); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO waitlist_priority_rules (event_id, grp, priority)
+				VALUES ($1, $2, $3)
+			`, eventID, rule.Group, rule.Priority)
+			if err != nil {
+				return err
+			}
+		}
+		n, err = refreshPrioritiesTx(ctx, tx, "x.event_id = $1", eventID)
+		if err != nil {
+			return err
+		}
+		after, err := priorityRulesTx(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		return apply(tx, before, after)
+	})
+	return n, err
+}
+
+// SetUserGroups records whether the user is a member and has accessibility needs, and
+// re-ranks the user's active waitlist entries. apply is called with the groups the user
+// had before, in the same transaction. It returns pgx.ErrNoRows for an unknown user.
+func (r *WaitlistRepository) SetUserGroups(ctx context.Context, userID string, member, accessibilityNeeds bool, apply func(tx pgx.Tx, member, accessibilityNeeds bool) error) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var wasMember, hadAccessibilityNeeds bool
+		err := tx.QueryRow(ctx, `
+			SELECT member, accessibility_needs FROM users WHERE id = $1 FOR UPDATE
+		`, userID).Scan(&wasMember, &hadAccessibilityNeeds)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE users SET member = $2, accessibility_needs = $3, updated_at = now()
+			WHERE id = $1
+		`, userID, member, accessibilityNeeds)
+		if err != nil {
+			return err
+		}
+		if _, err := refreshPrioritiesTx(ctx, tx, "x.user_id = $1", userID); err != nil {
+			return err
+		}
+		return apply(tx, wasMember, hadAccessibilityNeeds)
+	})
+}
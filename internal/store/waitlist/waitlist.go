@@ -2,21 +2,26 @@ package waitlist
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 
 	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store/bookings"
 )
 
 type WaitlistEntry struct {
-	ID         string `json:"id"`
-	EventID    string `json:"event_id"`
-	UserID     string `json:"user_id"`
-	Position   int    `json:"position"`
-	OptedOut   bool   `json:"opted_out"`
-	NotifiedAt string `json:"notified_at,omitempty"`
-	CreatedAt  string `json:"created_at"`
+	ID            string `json:"id"`
+	EventID       string `json:"event_id"`
+	UserID        string `json:"user_id"`
+	Position      int    `json:"position"`
+	Priority      int    `json:"priority"`
+	PriorityGroup string `json:"priority_group,omitempty"`
+	OptedOut      bool   `json:"opted_out"`
+	NotifiedAt    string `json:"notified_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
 }
 
 type WaitlistRepository struct {
@@ -28,27 +33,53 @@ func NewWaitlistRepository(db *store.DB, log *zap.Logger) *WaitlistRepository {
 	return &WaitlistRepository{db: db, log: log}
 }
 
+// errAlreadyWaiting rolls back the position bump when the user already has an entry.
+var errAlreadyWaiting = errors.New("already on the waitlist")
+
+// Add puts the user at the end of the event's waitlist and returns their position. A user
+// already waiting keeps their entry and position; a user who opted out joins again at the
+// end. Positions come from a per-event counter row, so concurrent joins never share one.
+// The entry's priority comes from the event's priority rules the user qualifies for.
 func (r *WaitlistRepository) Add(ctx context.Context, eventID, userID string) (int, error) {
-	// Get the next position
 	var position int
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT COALESCE(MAX(position), 0) + 1 
-		FROM waitlist 
-		WHERE event_id = $1 AND opted_out = false
-	`, eventID).Scan(&position)
-	if err != nil {
-		return 0, err
-	}
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// The upsert locks the counter row until commit, serialising joins per event
+		err := tx.QueryRow(ctx, `
+			INSERT INTO waitlist_counters (event_id, last_position)
+			VALUES ($1, 1)
+			ON CONFLICT (event_id) DO UPDATE SET last_position = waitlist_counters.last_position + 1
+			RETURNING last_position
+		`, eventID).Scan(&position)
+		if err != nil {
+			return err
+		}
 
-	// Insert the waitlist entry
-	query := `
-		INSERT INTO waitlist (event_id, user_id, position, opted_out)
-		VALUES ($1, $2, $3, false)
-		RETURNING id`
+		// Checked under the lock, so a concurrent join by the same user is already visible
+		err = tx.QueryRow(ctx, `
+			SELECT position FROM waitlist
+			WHERE event_id = $1 AND user_id = $2 AND opted_out = false
+		`, eventID, userID).Scan(&position)
+		if err == nil {
+			return errAlreadyWaiting
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
 
-	var id string
-	err = r.db.Pool.QueryRow(ctx, query, eventID, userID, position).Scan(&id)
-	if err != nil {
+		priority, group, err := priorityTx(ctx, tx, eventID, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO waitlist (event_id, user_id, position, priority, priority_group, opted_out)
+			VALUES ($1, $2, $3, $4, $5, false)
+		`, eventID, userID, position, priority, group)
+		if err != nil {
+			return err
+		}
+		return bookings.AuditTx(ctx, tx, nil, eventID, userID, bookings.AuditWaitlisted, map[string]any{"position": position, "priority": priority})
+	})
+	if err != nil && !errors.Is(err, errAlreadyWaiting) {
 		return 0, err
 	}
 
@@ -74,7 +105,7 @@ func (r *WaitlistRepository) OptOut(ctx context.Context, eventID, userID string)
 	query := `
 		UPDATE waitlist 
 		SET opted_out = true 
-		WHERE event_id = $1 AND user_id = $2`
+		WHERE event_id = $1 AND user_id = $2 AND opted_out = false`
 
 	result, err := r.db.Pool.Exec(ctx, query, eventID, userID)
 	if err != nil {
@@ -88,12 +119,14 @@ func (r *WaitlistRepository) OptOut(ctx context.Context, eventID, userID string)
 	return nil
 }
 
+// NextActive returns the first entry that has neither opted out nor been sent an offer,
+// highest priority first and then in join order.
 func (r *WaitlistRepository) NextActive(ctx context.Context, eventID string) (string, string, int, error) {
 	query := `
 		SELECT id, user_id, position 
 		FROM waitlist 
-		WHERE event_id = $1 AND opted_out = false 
-		ORDER BY position ASC 
+		WHERE event_id = $1 AND opted_out = false AND notified_at IS NULL
+		ORDER BY priority DESC, position ASC
 		LIMIT 1`
 
 	var id, userID string
@@ -124,12 +157,13 @@ func (r *WaitlistRepository) Count(ctx context.Context, eventID string) (int, er
 	return count, nil
 }
 
+// ListByEvent returns the event's entries in promotion order, opted-out entries last.
 func (r *WaitlistRepository) ListByEvent(ctx context.Context, eventID string, limit, offset int) ([]*WaitlistEntry, error) {
 	query := `
-		SELECT id, event_id, user_id, position, opted_out, notified_at, created_at
+		SELECT id, event_id, user_id, position, priority, priority_group, opted_out, notified_at, created_at
 		FROM waitlist 
 		WHERE event_id = $1 
-		ORDER BY position ASC
+		ORDER BY opted_out, priority DESC, position ASC
 		LIMIT $2 OFFSET $3`
 
 	rows, err := r.db.Pool.Query(ctx, query, eventID, limit, offset)
@@ -141,14 +175,17 @@ func (r *WaitlistRepository) ListByEvent(ctx context.Context, eventID string, li
 	var entries []*WaitlistEntry
 	for rows.Next() {
 		entry := &WaitlistEntry{}
-		var notifiedAt *string
+		var notifiedAt, group *string
 		err := rows.Scan(
-			&entry.ID, &entry.EventID, &entry.UserID, &entry.Position,
-			&entry.OptedOut, &notifiedAt, &entry.CreatedAt,
+			&entry.ID, &entry.EventID, &entry.UserID, &entry.Position, &entry.Priority,
+			&group, &entry.OptedOut, &notifiedAt, &entry.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if group != nil {
+			entry.PriorityGroup = *group
+		}
 		if notifiedAt != nil {
 			entry.NotifiedAt = *notifiedAt
 		}
@@ -158,10 +195,17 @@ func (r *WaitlistRepository) ListByEvent(ctx context.Context, eventID string, li
 	return entries, nil
 }
 
-func (r *WaitlistRepository) MarkNotified(ctx context.Context, id string) error {
-	query := `UPDATE waitlist SET notified_at = now() WHERE id = $1`
+// MarkNotified records that the entry was sent an offer. An entry with an offer is skipped
+// by NextActive.
+func (r *WaitlistRepository) MarkNotified(ctx context.Context, eventID, id string) error {
+	return r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return MarkNotifiedTx(ctx, tx, eventID, id)
+	})
+}
 
-	result, err := r.db.Pool.Exec(ctx, query, id)
+// MarkNotifiedTx is MarkNotified inside the caller's transaction.
+func MarkNotifiedTx(ctx context.Context, tx pgx.Tx, eventID, id string) error {
+	result, err := tx.Exec(ctx, `UPDATE waitlist SET notified_at = now() WHERE event_id = $1 AND id = $2`, eventID, id)
 	if err != nil {
 		return err
 	}
@@ -172,3 +216,46 @@ func (r *WaitlistRepository) MarkNotified(ctx context.Context, id string) error
 
 	return nil
 }
+
+// Standing is where a user is on an event's waitlist.
+type Standing struct {
+	Position     int       `json:"position"`
+	Ahead        int       `json:"ahead"`
+	Priority     int       `json:"priority"`
+	JoinedAt     time.Time `json:"joined_at"`
+	OfferPending bool      `json:"offer_pending"`
+}
+
+// Standing returns the user's active entry with the number of active entries ahead of it,
+// or nil if the user is not waiting. Position counts only active entries still waiting for
+// an offer, in the order NextActive promotes them.
+func (r *WaitlistRepository) Standing(ctx context.Context, eventID, userID string) (*Standing, error) {
+	var st Standing
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT w.priority, w.created_at, w.notified_at IS NOT NULL,
+		       (SELECT COUNT(*) FROM waitlist a
+		        WHERE a.event_id = w.event_id AND a.opted_out = false AND a.notified_at IS NULL
+		          AND (a.priority > w.priority OR (a.priority = w.priority AND a.position < w.position)))
+		FROM waitlist w
+		WHERE w.event_id = $1 AND w.user_id = $2 AND w.opted_out = false
+	`, eventID, userID).Scan(&st.Priority, &st.JoinedAt, &st.OfferPending, &st.Ahead)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st.Position = st.Ahead + 1
+	return &st, nil
+}
+
+// Promotions counts waitlist promotions since the given time, for one event or, with an
+// empty eventID, for all events.
+func (r *WaitlistRepository) Promotions(ctx context.Context, eventID string, since time.Time) (int, error) {
+	var n int
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM booking_audit
+		WHERE action = 'promoted' AND created_at >= $2 AND ($1 = '' OR event_id::text = $1)
+	`, eventID, since).Scan(&n)
+	return n, err
+}
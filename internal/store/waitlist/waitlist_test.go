@@ -0,0 +1,211 @@
+package waitlist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/samirwankhede/lewly-pgpyewj/internal/store"
+)
+
+// testRepo connects to the migrated database in TEST_POSTGRES_URL, or skips the test.
+func testRepo(t *testing.T) (*WaitlistRepository, *store.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	db, err := store.NewDB(context.Background(), url, 20)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return NewWaitlistRepository(db, zap.NewNop()), db
+}
+
+// testEvent creates an event with n users; the rows are deleted when the test ends.
+func testEvent(t *testing.T, db *store.DB, n int) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	var eventID string
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO events (name, capacity) VALUES ('waitlist test', 1) RETURNING id
+	`).Scan(&eventID)
+	if err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	userIDs := make([]string, n)
+	for i := range userIDs {
+		err := db.Pool.QueryRow(ctx, `
+			INSERT INTO users (email) VALUES ($1) RETURNING id
+		`, fmt.Sprintf("waitlist-%s-%d@example.com", eventID, i)).Scan(&userIDs[i])
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM booking_audit WHERE event_id = $1`, eventID)
+		db.Pool.Exec(ctx, `DELETE FROM users WHERE id = ANY($1)`, userIDs)
+		db.Pool.Exec(ctx, `DELETE FROM events WHERE id = $1`, eventID)
+	})
+	return eventID, userIDs
+}
+
+func TestAddConcurrentPositions(t *testing.T) {
+	repo, db := testRepo(t)
+	const n = 20
+	eventID, userIDs := testEvent(t, db, n)
+
+	positions := make([]int, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range userIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			positions[i], errs[i] = repo.Add(context.Background(), eventID, userIDs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("add user %d: %v", i, err)
+		}
+	}
+	sort.Ints(positions)
+	for i, p := range positions {
+		if p != i+1 {
+			t.Fatalf("positions = %v, want 1..%d without duplicates", positions, n)
+		}
+	}
+
+	// The stored entries match what Add returned
+	rows, err := db.Pool.Query(context.Background(), `
+		SELECT position FROM waitlist WHERE event_id = $1 AND opted_out = false ORDER BY position
+	`, eventID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	defer rows.Close()
+	var stored []int
+	for rows.Next() {
+		var p int
+		if err := rows.Scan(&p); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		stored = append(stored, p)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	if fmt.Sprint(stored) != fmt.Sprint(positions) {
+		t.Fatalf("stored positions = %v, want %v", stored, positions)
+	}
+}
+
+func TestAddAgainAfterOptOut(t *testing.T) {
+	repo, db := testRepo(t)
+	ctx := context.Background()
+	eventID, userIDs := testEvent(t, db, 2)
+	user, other := userIDs[0], userIDs[1]
+
+	first, err := repo.Add(ctx, eventID, user)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if first != 1 {
+		t.Fatalf("first position = %d, want 1", first)
+	}
+
+	// Joining again while waiting keeps the entry
+	again, err := repo.Add(ctx, eventID, user)
+	if err != nil {
+		t.Fatalf("add again: %v", err)
+	}
+	if again != first {
+		t.Fatalf("position on repeated join = %d, want %d", again, first)
+	}
+
+	if _, err := repo.Add(ctx, eventID, other); err != nil {
+		t.Fatalf("add other: %v", err)
+	}
+	if err := repo.OptOut(ctx, eventID, user); err != nil {
+		t.Fatalf("opt out: %v", err)
+	}
+
+	// The opted-out entry stays as history and the user joins at the end
+	rejoined, err := repo.Add(ctx, eventID, user)
+	if err != nil {
+		t.Fatalf("add after opt out: %v", err)
+	}
+	if rejoined != 3 {
+		t.Fatalf("position after opt out = %d, want 3", rejoined)
+	}
+
+	var active, optedOut int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE opted_out = false), COUNT(*) FILTER (WHERE opted_out = true)
+		FROM waitlist WHERE event_id = $1 AND user_id = $2
+	`, eventID, user).Scan(&active, &optedOut)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if active != 1 || optedOut != 1 {
+		t.Fatalf("entries = %d active, %d opted out; want 1 and 1", active, optedOut)
+	}
+}
+
+func TestStandingSkipsOffered(t *testing.T) {
+	repo, db := testRepo(t)
+	ctx := context.Background()
+	eventID, userIDs := testEvent(t, db, 3)
+
+	ids := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		if _, err := repo.Add(ctx, eventID, userID); err != nil {
+			t.Fatalf("add user %d: %v", i, err)
+		}
+		err := db.Pool.QueryRow(ctx, `
+			SELECT id FROM waitlist WHERE event_id = $1 AND user_id = $2 AND opted_out = false
+		`, eventID, userID).Scan(&ids[i])
+		if err != nil {
+			t.Fatalf("entry of user %d: %v", i, err)
+		}
+	}
+
+	// The first user has an offer out, so NextActive promotes the second one next
+	if err := repo.MarkNotified(ctx, eventID, ids[0]); err != nil {
+		t.Fatalf("mark notified: %v", err)
+	}
+	_, next, _, err := repo.NextActive(ctx, eventID)
+	if err != nil {
+		t.Fatalf("next active: %v", err)
+	}
+	if next != userIDs[1] {
+		t.Fatalf("next active = %s, want the second user", next)
+	}
+
+	for i, want := range []int{0, 1} {
+		st, err := repo.Standing(ctx, eventID, userIDs[i+1])
+		if err != nil {
+			t.Fatalf("standing of user %d: %v", i+1, err)
+		}
+		if st == nil || st.Ahead != want || st.Position != want+1 {
+			t.Fatalf("standing of user %d = %+v, want %d ahead", i+1, st, want)
+		}
+	}
+
+	st, err := repo.Standing(ctx, eventID, userIDs[0])
+	if err != nil {
+		t.Fatalf("standing of offered user: %v", err)
+	}
+	if st == nil || !st.OfferPending {
+		t.Fatalf("standing of offered user = %+v, want a pending offer", st)
+	}
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
+)
+
+const (
+	offerPollInterval = 10 * time.Second
+	offerBatchSize    = 100
+)
+
+// OfferScheduler expires waitlist offers that were not answered in time and cascades their
+// seats to the next user. Several workers can run it at once; each offer is claimed by one.
+type OfferScheduler struct {
+	log     *zap.Logger
+	service *bookingsService.OffersService
+}
+
+func NewOfferScheduler(log *zap.Logger, service *bookingsService.OffersService) *OfferScheduler {
+	return &OfferScheduler{log: log, service: service}
+}
+
+func (o *OfferScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(offerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			o.poll(ctx)
+		}
+	}
+}
+
+func (o *OfferScheduler) poll(ctx context.Context) {
+	for {
+		n, err := o.service.ExpireDue(ctx, offerBatchSize)
+		if err != nil {
+			o.log.Error("failed to expire waitlist offers", zap.Error(err))
+			return
+		}
+		// Keep draining while there is a backlog
+		if n < offerBatchSize {
+			return
+		}
+	}
+}
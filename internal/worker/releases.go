@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	bookingsService "github.com/samirwankhede/lewly-pgpyewj/internal/service/bookings"
+)
+
+const (
+	releasePollInterval = 30 * time.Second
+	releaseBatchSize    = 100
+)
+
+// ReleaseScheduler hands on freed seats whose release was not completed by the process that
+// freed them, passing them to the waitlist or their tokens back to the bucket. Several
+// workers can run it at once; each release is leased by one.
+type ReleaseScheduler struct {
+	log     *zap.Logger
+	service *bookingsService.OffersService
+}
+
+func NewReleaseScheduler(log *zap.Logger, service *bookingsService.OffersService) *ReleaseScheduler {
+	return &ReleaseScheduler{log: log, service: service}
+}
+
+func (r *ReleaseScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(releasePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.poll(ctx)
+		}
+	}
+}
+
+func (r *ReleaseScheduler) poll(ctx context.Context) {
+	for {
+		n, err := r.service.HandOffDue(ctx, releaseBatchSize)
+		if err != nil {
+			r.log.Error("failed to hand off seat releases", zap.Error(err))
+			return
+		}
+		// Keep draining while there is a backlog
+		if n < releaseBatchSize {
+			return
+		}
+	}
+}
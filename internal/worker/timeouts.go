@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	redisx "github.com/samirwankhede/lewly-pgpyewj/internal/redis"
+	workerService "github.com/samirwankhede/lewly-pgpyewj/internal/service/worker"
+)
+
+const (
+	timeoutPollInterval = 5 * time.Second
+	timeoutLease        = time.Minute
+	timeoutBatchSize    = 100
+)
+
+// TimeoutScheduler polls the durable timeout bucket and expires bookings whose payment
+// deadline has passed. Several workers can run it at once; each due booking is claimed
+// by exactly one of them.
+type TimeoutScheduler struct {
+	log     *zap.Logger
+	service *workerService.FinalizeService
+	bucket  *redisx.TimeoutBucket
+}
+
+func NewTimeoutScheduler(log *zap.Logger, service *workerService.FinalizeService, bucket *redisx.TimeoutBucket) *TimeoutScheduler {
+	return &TimeoutScheduler{
+		log:     log,
+		service: service,
+		bucket:  bucket,
+	}
+}
+
+func (t *TimeoutScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(timeoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			t.poll(ctx)
+		}
+	}
+}
+
+func (t *TimeoutScheduler) poll(ctx context.Context) {
+	for {
+		due, err := t.bucket.ClaimDue(ctx, time.Now(), timeoutLease, timeoutBatchSize)
+		if err != nil {
+			t.log.Error("failed to claim due booking timeouts", zap.Error(err))
+			return
+		}
+
+		for _, d := range due {
+			if err := t.service.HandleDueTimeout(ctx, d); err != nil {
+				// Left leased, it becomes due again once the lease expires
+				t.log.Error("failed to handle booking timeout", zap.Error(err), zap.String("booking_id", d.BookingID))
+			}
+		}
+
+		// Keep draining while there is a backlog
+		if len(due) < timeoutBatchSize {
+			return
+		}
+	}
+}